@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,6 +29,8 @@ type APIServer struct {
 	ProcessingTime   time.Duration
 	Database         engine.Component
 	Cache            engine.Component
+	Queue            engine.Component // writes are handed to it instead of done inline
+	Search           engine.Component // answers searches; writes are indexed into it too
 	healthy          bool
 	metrics          *engine.Metrics
 	metricsMutex     sync.RWMutex
@@ -72,6 +75,12 @@ func NewAPIServer(id, region string, size InstanceSize) *APIServer {
 	return api
 }
 
+// cacheWriter is a cache that can take writes or have keys invalidated
+type cacheWriter interface {
+	HasBackend() bool
+	Invalidate(key string)
+}
+
 func (api *APIServer) SetDatabase(db engine.Component) {
 	api.Database = db
 }
@@ -80,6 +89,14 @@ func (api *APIServer) SetCache(cache engine.Component) {
 	api.Cache = cache
 }
 
+func (api *APIServer) SetQueue(queue engine.Component) {
+	api.Queue = queue
+}
+
+func (api *APIServer) SetSearch(search engine.Component) {
+	api.Search = search
+}
+
 func (api *APIServer) GetID() string {
 	return api.ID
 }
@@ -88,6 +105,10 @@ func (api *APIServer) GetType() string {
 	return "api-server"
 }
 
+func (api *APIServer) GetRegion() string {
+	return api.Region
+}
+
 func (api *APIServer) Process(req *engine.Request) (*engine.Response, error) {
 	start := time.Now()
 	
@@ -137,10 +158,26 @@ func (api *APIServer) Process(req *engine.Request) (*engine.Response, error) {
 	var resp *engine.Response
 	var err error
 
-	if api.Cache != nil && req.Type == engine.RequestTypeRead {
+	writeCache, cacheWrites := api.Cache.(cacheWriter)
+	queued := api.Queue != nil && req.Type == engine.RequestTypeWrite && req.Source != api.Queue.GetID()
+
+	if queued {
+		// Consumers apply the write later; the client only waits for the
+		// queue to take it
+		resp, err = api.Queue.Process(req)
+	} else if api.Search != nil && req.Type == engine.RequestTypeRead && strings.HasPrefix(req.Path, "/api/search") {
+		resp, err = api.Search.Process(req)
+	} else if api.Cache != nil && req.Type == engine.RequestTypeRead {
+		resp, err = api.Cache.Process(req)
+	} else if req.Type == engine.RequestTypeWrite && cacheWrites && writeCache.HasBackend() {
+		// The cache sits in front of the database and applies its write policy
 		resp, err = api.Cache.Process(req)
 	} else if api.Database != nil {
 		resp, err = api.Database.Process(req)
+		if req.Type == engine.RequestTypeWrite && cacheWrites {
+			// Cache-aside done by the application: drop the now-stale copy
+			writeCache.Invalidate(req.Path)
+		}
 	} else {
 		resp = &engine.Response{
 			RequestID: req.ID,
@@ -151,6 +188,12 @@ func (api *APIServer) Process(req *engine.Request) (*engine.Response, error) {
 		}
 	}
 
+	if api.Search != nil && !queued && req.Type == engine.RequestTypeWrite && err == nil && resp != nil && resp.Success {
+		// Dual write: the client waits for the index too, and a failed
+		// index leaves search out of step with the database
+		api.Search.Process(req)
+	}
+
 	totalLatency := time.Since(start)
 	
 	api.metricsMutex.Lock()
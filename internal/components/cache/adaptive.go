@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"hash/fnv"
+)
+
+const (
+	// 2Q: share of capacity for first-time keys, and how many bytes of
+	// recently evicted first-time keys are remembered
+	twoQInShare    = 0.25
+	twoQGhostShare = 0.5
+
+	// W-TinyLFU: share of capacity for the admission window
+	tinyLFUWindowShare = 0.01
+	sketchWidth        = 4096
+	sketchDepth        = 4
+	sketchMaxCount     = 15
+)
+
+// twoQEvictor keeps first-time keys in a small FIFO (A1in). Keys evicted
+// from it are remembered in a ghost list (A1out); only keys requested again
+// while remembered enter the main LRU (Am), which keeps scans out of it.
+type twoQEvictor struct {
+	in    *keyList
+	ghost *keyList
+	main  *keyList
+}
+
+func newTwoQ() *twoQEvictor {
+	return &twoQEvictor{in: newKeyList(), ghost: newKeyList(), main: newKeyList()}
+}
+
+func (e *twoQEvictor) Record(key string) {}
+
+func (e *twoQEvictor) Hit(key string) {
+	e.main.moveToFront(key)
+}
+
+func (e *twoQEvictor) Insert(key string, size int64, capacity int64) []string {
+	if _, remembered := e.ghost.remove(key); remembered {
+		e.main.pushFront(key, size)
+	} else {
+		e.in.pushFront(key, size)
+	}
+
+	evicted := make([]string, 0)
+	for e.in.bytes+e.main.bytes > capacity {
+		if e.in.bytes > int64(float64(capacity)*twoQInShare) || e.main.len() == 0 {
+			node, _ := e.in.popBack()
+			evicted = append(evicted, node.key)
+			e.ghost.pushFront(node.key, node.size)
+			for e.ghost.bytes > int64(float64(capacity)*twoQGhostShare) {
+				e.ghost.popBack()
+			}
+		} else {
+			node, _ := e.main.popBack()
+			evicted = append(evicted, node.key)
+		}
+	}
+	return evicted
+}
+
+func (e *twoQEvictor) Remove(key string) {
+	if _, removed := e.in.remove(key); !removed {
+		e.main.remove(key)
+	}
+}
+
+// arcEvictor is the Adaptive Replacement Cache: T1 holds keys seen once and
+// T2 keys seen again, with ghost lists B1 and B2 remembering what each
+// recently evicted. A miss that hits a ghost list shifts the target size of
+// T1 towards recency (B1) or frequency (B2).
+type arcEvictor struct {
+	t1, t2 *keyList
+	b1, b2 *keyList
+	target int64 // target bytes for T1
+}
+
+func newARC() *arcEvictor {
+	return &arcEvictor{t1: newKeyList(), t2: newKeyList(), b1: newKeyList(), b2: newKeyList()}
+}
+
+func (e *arcEvictor) Record(key string) {}
+
+func (e *arcEvictor) Hit(key string) {
+	if size, found := e.t1.remove(key); found {
+		e.t2.pushFront(key, size)
+		return
+	}
+	e.t2.moveToFront(key)
+}
+
+func (e *arcEvictor) Insert(key string, size int64, capacity int64) []string {
+	evicted := make([]string, 0)
+
+	switch {
+	case e.b1.contains(key):
+		delta := size
+		if e.b1.bytes > 0 && e.b2.bytes > e.b1.bytes {
+			delta = size * (e.b2.bytes / e.b1.bytes)
+		}
+		e.target = min(e.target+delta, capacity)
+		e.b1.remove(key)
+		evicted = e.replace(size, capacity, false, evicted)
+		e.t2.pushFront(key, size)
+
+	case e.b2.contains(key):
+		delta := size
+		if e.b2.bytes > 0 && e.b1.bytes > e.b2.bytes {
+			delta = size * (e.b1.bytes / e.b2.bytes)
+		}
+		e.target = max(e.target-delta, 0)
+		e.b2.remove(key)
+		evicted = e.replace(size, capacity, true, evicted)
+		e.t2.pushFront(key, size)
+
+	default:
+		evicted = e.replace(size, capacity, false, evicted)
+		e.t1.pushFront(key, size)
+	}
+
+	// Keep the directory bounded: T1+B1 within the capacity and everything
+	// within twice the capacity
+	for e.t1.bytes+e.b1.bytes > capacity && e.b1.len() > 0 {
+		e.b1.popBack()
+	}
+	for e.t1.bytes+e.t2.bytes+e.b1.bytes+e.b2.bytes > 2*capacity && e.b2.len() > 0 {
+		e.b2.popBack()
+	}
+
+	if e.t1.bytes+e.t2.bytes > capacity {
+		// Larger than the whole cache
+		e.Remove(key)
+		evicted = append(evicted, key)
+	}
+	return evicted
+}
+
+// replace frees room for size bytes, taking from T1 while it is over its
+// target and from T2 otherwise, remembering the evicted keys in the ghosts
+func (e *arcEvictor) replace(size, capacity int64, inB2 bool, evicted []string) []string {
+	for e.t1.bytes+e.t2.bytes+size > capacity && e.t1.len()+e.t2.len() > 0 {
+		fromT1 := e.t1.len() > 0 && (e.t1.bytes > e.target || (inB2 && e.t1.bytes >= e.target) || e.t2.len() == 0)
+		if fromT1 {
+			node, _ := e.t1.popBack()
+			e.b1.pushFront(node.key, node.size)
+			evicted = append(evicted, node.key)
+		} else {
+			node, _ := e.t2.popBack()
+			e.b2.pushFront(node.key, node.size)
+			evicted = append(evicted, node.key)
+		}
+	}
+	return evicted
+}
+
+func (e *arcEvictor) Remove(key string) {
+	if _, removed := e.t1.remove(key); !removed {
+		e.t2.remove(key)
+	}
+}
+
+// frequencySketch is a count-min sketch of recent access frequencies.
+// Counters are halved periodically so old popularity fades.
+type frequencySketch struct {
+	counters  [sketchDepth][sketchWidth]uint8
+	additions int
+}
+
+func (s *frequencySketch) indexes(key string) [sketchDepth]int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	hash := h.Sum64()
+
+	var indexes [sketchDepth]int
+	for row := 0; row < sketchDepth; row++ {
+		// Derive one index per row from the two halves of the hash
+		combined := uint32(hash) + uint32(row)*uint32(hash>>32)
+		indexes[row] = int(combined % sketchWidth)
+	}
+	return indexes
+}
+
+func (s *frequencySketch) increment(key string) {
+	for row, index := range s.indexes(key) {
+		if s.counters[row][index] < sketchMaxCount {
+			s.counters[row][index]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= 10*sketchWidth {
+		for row := range s.counters {
+			for i := range s.counters[row] {
+				s.counters[row][i] /= 2
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(key string) uint8 {
+	estimate := uint8(sketchMaxCount)
+	for row, index := range s.indexes(key) {
+		estimate = min(estimate, s.counters[row][index])
+	}
+	return estimate
+}
+
+// tinyLFUEvictor is W-TinyLFU: new keys enter a small LRU window; keys
+// leaving it only get into the main SLRU if the sketch says they are
+// requested more often than the key they would displace.
+type tinyLFUEvictor struct {
+	sketch    frequencySketch
+	window    *keyList
+	probation *keyList
+	protected *keyList
+	capacity  int64
+}
+
+func newTinyLFU() *tinyLFUEvictor {
+	return &tinyLFUEvictor{window: newKeyList(), probation: newKeyList(), protected: newKeyList()}
+}
+
+func (e *tinyLFUEvictor) Record(key string) {
+	e.sketch.increment(key)
+}
+
+func (e *tinyLFUEvictor) Hit(key string) {
+	if e.window.contains(key) {
+		e.window.moveToFront(key)
+		return
+	}
+	slruHit(e.probation, e.protected, key, e.protectedLimit())
+}
+
+func (e *tinyLFUEvictor) mainLimit() int64 {
+	return e.capacity - int64(float64(e.capacity)*tinyLFUWindowShare)
+}
+
+func (e *tinyLFUEvictor) protectedLimit() int64 {
+	return int64(float64(e.mainLimit()) * slruProtectedShare)
+}
+
+func (e *tinyLFUEvictor) Insert(key string, size int64, capacity int64) []string {
+	e.capacity = capacity
+	e.window.pushFront(key, size)
+
+	evicted := make([]string, 0)
+	for e.window.bytes > capacity-e.mainLimit() {
+		candidate, _ := e.window.popBack()
+		if !e.admit(candidate, &evicted) {
+			evicted = append(evicted, candidate.key)
+			continue
+		}
+		e.probation.pushFront(candidate.key, candidate.size)
+	}
+	return evicted
+}
+
+// admit makes room in the main space for a candidate leaving the window,
+// evicting main keys it is more popular than. It refuses the candidate once
+// it meets a victim at least as popular.
+func (e *tinyLFUEvictor) admit(candidate *keyNode, evicted *[]string) bool {
+	if candidate.size > e.mainLimit() {
+		return false
+	}
+
+	for e.probation.bytes+e.protected.bytes+candidate.size > e.mainLimit() {
+		segment := e.probation
+		if segment.len() == 0 {
+			segment = e.protected
+		}
+		victim, _ := segment.back()
+		if e.sketch.estimate(candidate.key) <= e.sketch.estimate(victim.key) {
+			return false
+		}
+		segment.popBack()
+		*evicted = append(*evicted, victim.key)
+	}
+	return true
+}
+
+func (e *tinyLFUEvictor) Remove(key string) {
+	for _, segment := range []*keyList{e.window, e.probation, e.protected} {
+		if _, removed := segment.remove(key); removed {
+			return
+		}
+	}
+}
@@ -15,8 +15,49 @@ const (
 	EvictionLFU   EvictionPolicy = "lfu"
 	EvictionFIFO  EvictionPolicy = "fifo"
 	EvictionRandom EvictionPolicy = "random"
+	EvictionSLRU    EvictionPolicy = "slru"
+	EvictionTwoQ    EvictionPolicy = "2q"
+	EvictionARC     EvictionPolicy = "arc"
+	EvictionTinyLFU EvictionPolicy = "w-tinylfu"
 )
 
+func GetEvictionPolicies() []EvictionPolicy {
+	return []EvictionPolicy{
+		EvictionLRU,
+		EvictionLFU,
+		EvictionFIFO,
+		EvictionRandom,
+		EvictionSLRU,
+		EvictionTwoQ,
+		EvictionARC,
+		EvictionTinyLFU,
+	}
+}
+
+// CacheStats counts how reads fared against the cache
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+	UsedBytes int64
+
+	StaleReads      int64
+	DirtyEntries    int
+	Flushed         int64
+	CoalescedWrites int64
+	LostWrites      int64 // acknowledged write-back writes that never reached the backend
+
+	Stampede StampedeStats
+}
+
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
 type CacheEntry struct {
 	Key        string
 	Data       []byte
@@ -24,6 +65,11 @@ type CacheEntry struct {
 	Expiry     time.Time
 	AccessTime time.Time
 	AccessCount int64
+	Version    int64 // backend version the data was read at
+	Dirty      bool  // written under write-back and not yet flushed
+	Delta      time.Duration // how long the backend took to produce it
+	NotFound   bool
+	writes     int64
 }
 
 type Cache struct {
@@ -33,7 +79,10 @@ type Cache struct {
 	Capacity      int64
 	UsedCapacity  int64
 	Policy        EvictionPolicy
+	WritePolicy   WritePolicy
+	FlushInterval time.Duration
 	TTL           time.Duration
+	Protection    StampedeProtection
 	ReadLatency   time.Duration
 	WriteLatency  time.Duration
 	Backend       engine.Component
@@ -42,6 +91,13 @@ type Cache struct {
 	metricsMutex  sync.RWMutex
 	entries       map[string]*CacheEntry
 	entriesMutex  sync.RWMutex
+	evictor       evictor
+	evictorPolicy EvictionPolicy
+	flights       FlightGroup
+	stats         CacheStats
+	lastFlush     time.Time
+	flushing      int32
+	flushCounter  uint64
 	costPerHour   float64
 }
 
@@ -52,12 +108,17 @@ func NewCache(id, cacheType, region string, capacity int64, policy EvictionPolic
 		Region:       region,
 		Capacity:     capacity,
 		Policy:       policy,
+		WritePolicy:  WriteInvalidate,
+		FlushInterval: 5 * time.Second,
 		TTL:          ttl,
+		Protection:   DefaultStampedeProtection(),
 		ReadLatency:  time.Millisecond,
 		WriteLatency: 2 * time.Millisecond,
 		healthy:      true,
 		metrics:      &engine.Metrics{},
 		entries:      make(map[string]*CacheEntry),
+		evictor:      newEvictor(policy),
+		evictorPolicy: policy,
 		costPerHour:  0.02,
 	}
 }
@@ -74,6 +135,10 @@ func (c *Cache) GetType() string {
 	return fmt.Sprintf("cache-%s", c.Type)
 }
 
+func (c *Cache) GetRegion() string {
+	return c.Region
+}
+
 func (c *Cache) Process(req *engine.Request) (*engine.Response, error) {
 	start := time.Now()
 	
@@ -98,9 +163,19 @@ func (c *Cache) Process(req *engine.Request) (*engine.Response, error) {
 		}, fmt.Errorf("cache is unhealthy")
 	}
 
+	if req.Type == engine.RequestTypeWrite {
+		return c.processWrite(req, start)
+	}
+
 	if req.Type == engine.RequestTypeRead {
-		if entry := c.get(req.Path); entry != nil {
+		if entry, freshness := c.get(req.Path); entry != nil {
+			if freshness == Stale {
+				c.revalidate(req)
+			}
 			time.Sleep(c.ReadLatency)
+			if c.isStale(entry) {
+				c.recordStaleRead()
+			}
 			
 			totalLatency := time.Since(start)
 			
@@ -110,22 +185,28 @@ func (c *Cache) Process(req *engine.Request) (*engine.Response, error) {
 			c.metrics.AverageLatency = time.Duration(int64(c.metrics.TotalLatency) / c.metrics.RequestCount)
 			c.metricsMutex.Unlock()
 			
-			return &engine.Response{
+			resp := &engine.Response{
 				RequestID: req.ID,
 				Success:   true,
 				Latency:   totalLatency,
 				DataSize:  entry.Size,
 				CacheHit:  true,
 				HopsTrace: []string{c.ID},
-			}, nil
+			}
+			if entry.NotFound {
+				resp.Metadata = map[string]interface{}{"not_found": true}
+			}
+			return resp, nil
 		}
 	}
 
 	if c.Backend != nil {
-		resp, err := c.Backend.Process(req)
-		
-		if err == nil && resp.Success && req.Type == engine.RequestTypeRead {
-			c.set(req.Path, resp.DataSize)
+		var resp *engine.Response
+		var err error
+		if req.Type == engine.RequestTypeRead {
+			resp, err = c.fetch(req)
+		} else {
+			resp, err = c.Backend.Process(req)
 		}
 		
 		if resp != nil {
@@ -148,32 +229,130 @@ func (c *Cache) Process(req *engine.Request) (*engine.Response, error) {
 	}, fmt.Errorf("cache miss and no backend")
 }
 
-func (c *Cache) get(key string) *CacheEntry {
-	c.entriesMutex.RLock()
-	defer c.entriesMutex.RUnlock()
+// get looks a key up. Entries are returned while Fresh or Stale; Expired
+// and RefreshEarly lookups return nil and count as misses.
+func (c *Cache) get(key string) (*CacheEntry, Freshness) {
+	c.entriesMutex.Lock()
+	defer c.entriesMutex.Unlock()
+	
+	c.evictor.Record(key)
 	
 	entry, exists := c.entries[key]
 	if !exists {
-		return nil
+		c.stats.Misses++
+		return nil, Expired
 	}
 	
-	if time.Now().After(entry.Expiry) {
-		go c.evict(key)
-		return nil
+	// Dirty entries hold the only copy of their data, so they outlive the TTL
+	freshness := Fresh
+	if !entry.Dirty {
+		freshness = c.Protection.Freshness(entry.Expiry, entry.Delta, time.Now())
+	}
+	
+	switch freshness {
+	case Expired:
+		c.removeLocked(key)
+		c.stats.Misses++
+		return nil, freshness
+	case RefreshEarly:
+		c.stats.Stampede.EarlyRefreshes++
+		c.stats.Misses++
+		return nil, freshness
+	case Stale:
+		c.stats.Stampede.StaleServed++
+	}
+	if entry.NotFound {
+		c.stats.Stampede.NegativeHits++
 	}
 	
 	entry.AccessTime = time.Now()
 	entry.AccessCount++
+	c.evictor.Hit(key)
+	c.stats.Hits++
 	
-	return entry
+	copied := *entry
+	return &copied, freshness
 }
 
-func (c *Cache) set(key string, size int64) {
+// fetch loads a missed key from the backend, sharing one fetch between
+// concurrent misses when coalescing is on
+func (c *Cache) fetch(req *engine.Request) (*engine.Response, error) {
+	if !c.Protection.Coalesce {
+		return c.load(req)
+	}
+	
+	resp, err, shared := c.flights.Do(req.Path, func() (*engine.Response, error) {
+		return c.load(req)
+	})
+	if shared {
+		c.entriesMutex.Lock()
+		c.stats.Stampede.Coalesced++
+		c.entriesMutex.Unlock()
+		if resp != nil {
+			resp.RequestID = req.ID
+		}
+	}
+	return resp, err
+}
+
+func (c *Cache) load(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+	resp, err := c.Backend.Process(req)
+	delta := time.Since(start)
+	
 	c.entriesMutex.Lock()
-	defer c.entriesMutex.Unlock()
+	c.stats.Stampede.BackendFetches++
+	dirtyEvicted := make([]*CacheEntry, 0)
+	if err == nil && resp != nil && resp.Success {
+		if ttl, cacheable := c.Protection.TTLFor(resp, c.TTL); cacheable {
+			dirtyEvicted = c.set(req.Path, resp.DataSize, responseVersion(resp), false)
+			if entry, exists := c.entries[req.Path]; exists {
+				entry.Expiry = time.Now().Add(ttl)
+				entry.Delta = delta
+				entry.NotFound = IsNotFound(resp)
+			}
+		}
+	}
+	c.entriesMutex.Unlock()
 	
-	for c.UsedCapacity+size > c.Capacity && len(c.entries) > 0 {
-		c.evictOne()
+	if len(dirtyEvicted) > 0 {
+		go c.writeBack(dirtyEvicted)
+	}
+	return resp, err
+}
+
+// revalidate refreshes a stale entry in the background, once no matter how
+// many reads are served it in the meantime
+func (c *Cache) revalidate(req *engine.Request) {
+	if c.flights.InFlight(req.Path) {
+		return
+	}
+	
+	refresh := *req
+	refresh.ID = req.ID + "-revalidate"
+	go c.flights.Do(req.Path, func() (*engine.Response, error) {
+		return c.load(&refresh)
+	})
+}
+
+// set caches a key and returns the dirty entries evicted to make room, which
+// the caller must write back once it has released entriesMutex
+func (c *Cache) set(key string, size int64, version int64, dirty bool) []*CacheEntry {
+	dirtyEvicted := c.syncPolicy()
+	c.removeLocked(key)
+	
+	admitted := true
+	for _, evictKey := range c.evictor.Insert(key, size, c.Capacity) {
+		if evictKey == key {
+			admitted = false
+			continue
+		}
+		if evicted := c.dropLocked(evictKey); evicted != nil && evicted.Dirty {
+			dirtyEvicted = append(dirtyEvicted, evicted)
+		}
+	}
+	if !admitted {
+		return dirtyEvicted
 	}
 	
 	entry := &CacheEntry{
@@ -183,55 +362,75 @@ func (c *Cache) set(key string, size int64) {
 		Expiry:      time.Now().Add(c.TTL),
 		AccessTime:  time.Now(),
 		AccessCount: 1,
+		Version:     version,
+		Dirty:       dirty,
 	}
 	
 	c.entries[key] = entry
 	c.UsedCapacity += size
+	return dirtyEvicted
 }
 
 func (c *Cache) evict(key string) {
 	c.entriesMutex.Lock()
 	defer c.entriesMutex.Unlock()
 	
+	c.removeLocked(key)
+}
+
+func (c *Cache) removeLocked(key string) {
 	if entry, exists := c.entries[key]; exists {
 		c.UsedCapacity -= entry.Size
 		delete(c.entries, key)
+		c.evictor.Remove(key)
 	}
 }
 
-func (c *Cache) evictOne() {
-	var evictKey string
-	var oldestTime time.Time = time.Now()
-	var lowestCount int64 = int64(^uint64(0) >> 1)
+// dropLocked removes an entry the evictor already let go of
+func (c *Cache) dropLocked(key string) *CacheEntry {
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil
+	}
+	c.UsedCapacity -= entry.Size
+	delete(c.entries, key)
+	c.stats.Evictions++
+	return entry
+}
+
+// syncPolicy rebuilds the evictor when the policy was changed, carrying the
+// cached keys over in no particular order
+func (c *Cache) syncPolicy() []*CacheEntry {
+	dirtyEvicted := make([]*CacheEntry, 0)
+	if c.evictorPolicy == c.Policy {
+		return dirtyEvicted
+	}
 	
-	switch c.Policy {
-	case EvictionLRU:
-		for key, entry := range c.entries {
-			if entry.AccessTime.Before(oldestTime) {
-				oldestTime = entry.AccessTime
-				evictKey = key
-			}
-		}
-	case EvictionLFU:
-		for key, entry := range c.entries {
-			if entry.AccessCount < lowestCount {
-				lowestCount = entry.AccessCount
-				evictKey = key
+	c.evictor = newEvictor(c.Policy)
+	c.evictorPolicy = c.Policy
+	for key, entry := range c.entries {
+		for _, evictKey := range c.evictor.Insert(key, entry.Size, c.Capacity) {
+			if evicted := c.dropLocked(evictKey); evicted != nil && evicted.Dirty {
+				dirtyEvicted = append(dirtyEvicted, evicted)
 			}
 		}
-	default:
-		for key := range c.entries {
-			evictKey = key
-			break
-		}
 	}
+	return dirtyEvicted
+}
+
+func (c *Cache) GetStats() CacheStats {
+	c.entriesMutex.RLock()
+	defer c.entriesMutex.RUnlock()
 	
-	if evictKey != "" {
-		if entry, exists := c.entries[evictKey]; exists {
-			c.UsedCapacity -= entry.Size
-			delete(c.entries, evictKey)
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.UsedBytes = c.UsedCapacity
+	for _, entry := range c.entries {
+		if entry.Dirty {
+			stats.DirtyEntries++
 		}
 	}
+	return stats
 }
 
 func (c *Cache) GetMetrics() *engine.Metrics {
@@ -241,10 +440,11 @@ func (c *Cache) GetMetrics() *engine.Metrics {
 	metricsCopy := *c.metrics
 	if metricsCopy.RequestCount > 0 {
 		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
-		
-		cacheHits := metricsCopy.SuccessCount
-		metricsCopy.CacheHitRate = float64(cacheHits) / float64(metricsCopy.RequestCount)
 	}
+	stats := c.GetStats()
+	metricsCopy.CacheHitRate = stats.HitRate()
+	metricsCopy.CoalescedRequests = stats.Stampede.Coalesced
+	metricsCopy.BackendLoadSaved = stats.Stampede.LoadSaved()
 	return &metricsCopy
 }
 
@@ -259,6 +459,21 @@ func (c *Cache) IsHealthy() bool {
 	return c.healthy
 }
 
+// SetHealthy(false) models the cache node dying: its memory is gone, and
+// with it any write-back writes that were not flushed yet
 func (c *Cache) SetHealthy(healthy bool) {
+	if c.healthy && !healthy {
+		c.entriesMutex.Lock()
+		for _, entry := range c.entries {
+			if entry.Dirty {
+				c.stats.LostWrites++
+			}
+		}
+		c.entries = make(map[string]*CacheEntry)
+		c.evictor = newEvictor(c.Policy)
+		c.evictorPolicy = c.Policy
+		c.UsedCapacity = 0
+		c.entriesMutex.Unlock()
+	}
 	c.healthy = healthy
 }
@@ -0,0 +1,548 @@
+package cache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+type ClusterRouting string
+
+const (
+	// Smart clients hash keys to nodes themselves, like Redis Cluster
+	// clients. There is no extra hop, but clients only learn about topology
+	// changes when they refresh their copy of the slot map.
+	RoutingClient ClusterRouting = "client"
+	// A proxy such as twemproxy or mcrouter routes every request. It always
+	// knows the current topology but adds a hop.
+	RoutingProxy ClusterRouting = "proxy"
+)
+
+func GetClusterRoutings() []ClusterRouting {
+	return []ClusterRouting{RoutingClient, RoutingProxy}
+}
+
+const (
+	// Virtual nodes each cache node gets on the hash ring
+	clusterVirtualNodes = 100
+	// Distinct keys tracked per node for hot-key detection
+	hotKeyTrackingLimit = 4096
+)
+
+type clusterRingNode struct {
+	hash uint64
+	node *Cache
+}
+
+// ClusterNodeStats is one node's share of the cluster, for spotting
+// imbalance
+type ClusterNodeStats struct {
+	ID        string
+	Healthy   bool
+	Capacity  int64
+	UsedBytes int64
+	Entries   int
+	HitRate   float64
+	Requests  int64
+	// KeyShare is the part of the hash ring the node owns as primary
+	KeyShare float64
+	HotKey   string
+	// HotKeyShare is the part of the node's requests that went to HotKey
+	HotKeyShare float64
+}
+
+// Cluster spreads keys over cache nodes with consistent hashing. Each key is
+// owned by the first node clockwise from its hash, and copied to the next
+// Replicas nodes so a node failure does not lose it.
+type Cluster struct {
+	ID              string
+	Type            string
+	Region          string
+	Routing         ClusterRouting
+	Replicas        int
+	NodeCapacity    int64
+	Policy          EvictionPolicy
+	WritePolicy     WritePolicy
+	TTL             time.Duration
+	ProxyLatency    time.Duration
+	TopologyRefresh time.Duration
+	Backend         engine.Component
+	healthy         bool
+	metrics         *engine.Metrics
+	metricsMutex    sync.RWMutex
+	nodes           []*Cache
+	nodeCounter     int
+	ring            []clusterRingNode // current topology
+	clientRing      []clusterRingNode // what smart clients last fetched
+	clientRefreshed time.Time
+	nodesMutex      sync.RWMutex
+	requests        map[string]int64
+	keyRequests     map[string]map[string]int64
+	misrouted       int64
+	loadMutex       sync.Mutex
+	costPerHour     float64
+}
+
+func NewCluster(id, cacheType, region string, nodes int, nodeCapacity int64, policy EvictionPolicy, ttl time.Duration) *Cluster {
+	c := &Cluster{
+		ID:              id,
+		Type:            cacheType,
+		Region:          region,
+		Routing:         RoutingClient,
+		NodeCapacity:    nodeCapacity,
+		Policy:          policy,
+		WritePolicy:     WriteInvalidate,
+		TTL:             ttl,
+		ProxyLatency:    500 * time.Microsecond,
+		TopologyRefresh: 2 * time.Second,
+		healthy:         true,
+		metrics:         &engine.Metrics{},
+		requests:        make(map[string]int64),
+		keyRequests:     make(map[string]map[string]int64),
+		costPerHour:     0.01,
+	}
+	for i := 0; i < nodes; i++ {
+		c.AddNode()
+	}
+	return c
+}
+
+func (c *Cluster) GetID() string {
+	return c.ID
+}
+
+func (c *Cluster) GetType() string {
+	return "cache-cluster"
+}
+
+func (c *Cluster) GetRegion() string {
+	return c.Region
+}
+
+func (c *Cluster) SetBackend(backend engine.Component) {
+	c.nodesMutex.Lock()
+	defer c.nodesMutex.Unlock()
+
+	c.Backend = backend
+	for _, node := range c.nodes {
+		node.SetBackend(backend)
+	}
+}
+
+func (c *Cluster) HasBackend() bool {
+	return c.Backend != nil
+}
+
+// AddNode joins a new, empty node. Keys whose ring position it takes over
+// miss until they are loaded again.
+func (c *Cluster) AddNode() *Cache {
+	c.nodesMutex.Lock()
+	defer c.nodesMutex.Unlock()
+
+	c.nodeCounter++
+	node := NewCache(fmt.Sprintf("%s-node-%d", c.ID, c.nodeCounter), c.Type, c.Region, c.NodeCapacity, c.Policy, c.TTL)
+	node.WritePolicy = c.WritePolicy
+	node.SetBackend(c.Backend)
+	c.nodes = append(c.nodes, node)
+	c.rebuildRingLocked()
+	return node
+}
+
+// RemoveNode takes a node out of the cluster along with its keys
+func (c *Cluster) RemoveNode(id string) error {
+	c.nodesMutex.Lock()
+	defer c.nodesMutex.Unlock()
+
+	for i, node := range c.nodes {
+		if node.GetID() == id {
+			// Clients with an old slot map may still send requests to it
+			node.SetHealthy(false)
+			c.nodes = append(c.nodes[:i], c.nodes[i+1:]...)
+			c.rebuildRingLocked()
+			return nil
+		}
+	}
+	return fmt.Errorf("node %s not found", id)
+}
+
+// SetNodeHealthy fails or recovers a node. A failed node loses everything it
+// held and recovers empty.
+func (c *Cluster) SetNodeHealthy(id string, healthy bool) error {
+	c.nodesMutex.Lock()
+	defer c.nodesMutex.Unlock()
+
+	for _, node := range c.nodes {
+		if node.GetID() == id {
+			node.SetHealthy(healthy)
+			c.rebuildRingLocked()
+			return nil
+		}
+	}
+	return fmt.Errorf("node %s not found", id)
+}
+
+func (c *Cluster) GetNodes() []*Cache {
+	c.nodesMutex.RLock()
+	defer c.nodesMutex.RUnlock()
+
+	nodes := make([]*Cache, len(c.nodes))
+	copy(nodes, c.nodes)
+	return nodes
+}
+
+// GetNodeCounts returns how many nodes are up, out of all nodes
+func (c *Cluster) GetNodeCounts() (int, int) {
+	c.nodesMutex.RLock()
+	defer c.nodesMutex.RUnlock()
+
+	healthy := 0
+	for _, node := range c.nodes {
+		if node.IsHealthy() {
+			healthy++
+		}
+	}
+	return healthy, len(c.nodes)
+}
+
+// ApplySettings pushes the cluster-wide cache settings to every node
+func (c *Cluster) ApplySettings() {
+	c.nodesMutex.Lock()
+	defer c.nodesMutex.Unlock()
+
+	for _, node := range c.nodes {
+		node.Type = c.Type
+		node.Region = c.Region
+		node.Capacity = c.NodeCapacity
+		node.Policy = c.Policy
+		node.WritePolicy = c.WritePolicy
+		node.TTL = c.TTL
+	}
+}
+
+// rebuildRingLocked places the healthy nodes on the ring. Smart clients keep
+// using their old copy until their next refresh.
+func (c *Cluster) rebuildRingLocked() {
+	ring := make([]clusterRingNode, 0)
+	for _, node := range c.nodes {
+		if !node.IsHealthy() {
+			continue
+		}
+		for v := 0; v < clusterVirtualNodes; v++ {
+			ring = append(ring, clusterRingNode{hash: ringHash(node.GetID() + "#" + strconv.Itoa(v)), node: node})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	c.ring = ring
+	if c.clientRing == nil {
+		c.clientRing = ring
+	}
+}
+
+func ringHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// Mix the bits so similar virtual node names spread around the ring
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// owners returns the nodes holding key: the primary, then its replicas
+func (c *Cluster) owners(ring []clusterRingNode, key string) []*Cache {
+	if len(ring) == 0 {
+		return nil
+	}
+
+	hash := ringHash(key)
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+
+	owners := make([]*Cache, 0, c.Replicas+1)
+	seen := make(map[*Cache]bool)
+	for i := 0; i < len(ring) && len(owners) <= c.Replicas; i++ {
+		node := ring[(start+i)%len(ring)].node
+		if !seen[node] {
+			seen[node] = true
+			owners = append(owners, node)
+		}
+	}
+	return owners
+}
+
+// route picks the ring requests are routed by. Proxies always know the
+// current topology; smart clients refresh theirs every TopologyRefresh.
+func (c *Cluster) route(key string) []*Cache {
+	c.nodesMutex.Lock()
+	defer c.nodesMutex.Unlock()
+
+	if c.Routing == RoutingProxy {
+		return c.owners(c.ring, key)
+	}
+	if time.Since(c.clientRefreshed) >= c.TopologyRefresh {
+		c.clientRing = c.ring
+		c.clientRefreshed = time.Now()
+	}
+	return c.owners(c.clientRing, key)
+}
+
+func (c *Cluster) Process(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+
+	c.metricsMutex.Lock()
+	c.metrics.RequestCount++
+	c.metricsMutex.Unlock()
+
+	if !c.healthy {
+		c.metricsMutex.Lock()
+		c.metrics.FailureCount++
+		c.metricsMutex.Unlock()
+
+		if c.Backend != nil {
+			return c.Backend.Process(req)
+		}
+		err := fmt.Errorf("cache cluster is unhealthy")
+		return &engine.Response{RequestID: req.ID, Success: false, Latency: time.Since(start), Error: err}, err
+	}
+
+	if c.Routing == RoutingProxy {
+		time.Sleep(c.ProxyLatency)
+	}
+
+	owners := c.route(req.Path)
+	if len(owners) == 0 {
+		// Every node is down; the cluster is bypassed
+		c.metricsMutex.Lock()
+		c.metrics.FailureCount++
+		c.metricsMutex.Unlock()
+
+		if c.Backend != nil {
+			return c.Backend.Process(req)
+		}
+		err := fmt.Errorf("no cache nodes available")
+		return &engine.Response{RequestID: req.ID, Success: false, Latency: time.Since(start), Error: err}, err
+	}
+
+	primary := owners[0]
+	c.recordLoad(primary, req.Path)
+	resp, err := primary.Process(req)
+
+	success := err == nil && resp != nil && resp.Success
+	if success && len(owners) > 1 && primary.IsHealthy() {
+		if req.Type == engine.RequestTypeWrite || (req.Type == engine.RequestTypeRead && !resp.CacheHit) {
+			c.replicate(req.Path, primary, owners[1:])
+		}
+	}
+
+	totalLatency := time.Since(start)
+
+	c.metricsMutex.Lock()
+	if success {
+		c.metrics.SuccessCount++
+	} else {
+		c.metrics.FailureCount++
+	}
+	c.metrics.TotalLatency += totalLatency
+	c.metrics.AverageLatency = time.Duration(int64(c.metrics.TotalLatency) / c.metrics.RequestCount)
+	c.metricsMutex.Unlock()
+
+	if resp != nil {
+		resp.Latency = totalLatency
+		if c.Routing == RoutingProxy {
+			resp.HopsTrace = append([]string{c.ID}, resp.HopsTrace...)
+		}
+	}
+	return resp, err
+}
+
+// recordLoad counts a request against a node and its key. A request sent to
+// a node that is no longer up was routed by an outdated slot map.
+func (c *Cluster) recordLoad(node *Cache, key string) {
+	c.loadMutex.Lock()
+	defer c.loadMutex.Unlock()
+
+	id := node.GetID()
+	c.requests[id]++
+	if !node.IsHealthy() {
+		c.misrouted++
+	}
+
+	keys, exists := c.keyRequests[id]
+	if !exists {
+		keys = make(map[string]int64)
+		c.keyRequests[id] = keys
+	}
+	if _, tracked := keys[key]; tracked || len(keys) < hotKeyTrackingLimit {
+		keys[key]++
+	}
+}
+
+// replicate copies the primary's entry for key to the replicas. Entries the
+// primary holds dirty, or not at all, are dropped from the replicas instead.
+func (c *Cluster) replicate(key string, primary *Cache, replicas []*Cache) {
+	primary.entriesMutex.RLock()
+	entry, exists := primary.entries[key]
+	var copied CacheEntry
+	if exists {
+		copied = *entry
+	}
+	primary.entriesMutex.RUnlock()
+
+	for _, replica := range replicas {
+		if !replica.IsHealthy() {
+			continue
+		}
+		if !exists || copied.Dirty {
+			replica.evict(key)
+			continue
+		}
+
+		replica.entriesMutex.Lock()
+		dirtyEvicted := replica.set(key, copied.Size, copied.Version, false)
+		if stored, admitted := replica.entries[key]; admitted {
+			stored.Expiry = copied.Expiry
+			stored.Delta = copied.Delta
+			stored.NotFound = copied.NotFound
+		}
+		replica.entriesMutex.Unlock()
+
+		if len(dirtyEvicted) > 0 {
+			go replica.writeBack(dirtyEvicted)
+		}
+	}
+}
+
+// Invalidate drops a key from every node that may hold a copy
+func (c *Cluster) Invalidate(key string) {
+	for _, node := range c.GetNodes() {
+		node.Invalidate(key)
+	}
+}
+
+// Tick lets every node flush its write-back data
+func (c *Cluster) Tick(now time.Time) {
+	for _, node := range c.GetNodes() {
+		node.Tick(now)
+	}
+}
+
+func (c *Cluster) GetNodeStats() []ClusterNodeStats {
+	c.nodesMutex.RLock()
+	nodes := make([]*Cache, len(c.nodes))
+	copy(nodes, c.nodes)
+	shares := ringShares(c.ring)
+	c.nodesMutex.RUnlock()
+
+	c.loadMutex.Lock()
+	defer c.loadMutex.Unlock()
+
+	stats := make([]ClusterNodeStats, 0, len(nodes))
+	for _, node := range nodes {
+		id := node.GetID()
+		cacheStats := node.GetStats()
+		nodeStats := ClusterNodeStats{
+			ID:        id,
+			Healthy:   node.IsHealthy(),
+			Capacity:  node.Capacity,
+			UsedBytes: cacheStats.UsedBytes,
+			Entries:   cacheStats.Entries,
+			HitRate:   cacheStats.HitRate(),
+			Requests:  c.requests[id],
+			KeyShare:  shares[node],
+		}
+		var hottest int64
+		for key, count := range c.keyRequests[id] {
+			if count > hottest {
+				nodeStats.HotKey, hottest = key, count
+			}
+		}
+		if nodeStats.Requests > 0 {
+			nodeStats.HotKeyShare = float64(hottest) / float64(nodeStats.Requests)
+		}
+		stats = append(stats, nodeStats)
+	}
+	return stats
+}
+
+// ringShares returns the part of the hash space each node owns as primary
+func ringShares(ring []clusterRingNode) map[*Cache]float64 {
+	shares := make(map[*Cache]float64)
+	for i, point := range ring {
+		previous := ring[(i+len(ring)-1)%len(ring)].hash
+		// The arc ending at this point; unsigned subtraction wraps past zero
+		shares[point.node] += float64(point.hash-previous) / float64(^uint64(0))
+	}
+	return shares
+}
+
+// GetStats sums the nodes' cache statistics
+func (c *Cluster) GetStats() CacheStats {
+	var total CacheStats
+	for _, node := range c.GetNodes() {
+		stats := node.GetStats()
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Evictions += stats.Evictions
+		total.Entries += stats.Entries
+		total.UsedBytes += stats.UsedBytes
+		total.StaleReads += stats.StaleReads
+		total.DirtyEntries += stats.DirtyEntries
+		total.Flushed += stats.Flushed
+		total.CoalescedWrites += stats.CoalescedWrites
+		total.LostWrites += stats.LostWrites
+		total.Stampede.BackendFetches += stats.Stampede.BackendFetches
+		total.Stampede.Coalesced += stats.Stampede.Coalesced
+		total.Stampede.EarlyRefreshes += stats.Stampede.EarlyRefreshes
+		total.Stampede.StaleServed += stats.Stampede.StaleServed
+		total.Stampede.NegativeHits += stats.Stampede.NegativeHits
+	}
+	return total
+}
+
+// GetMisrouted returns how many requests smart clients sent to nodes that
+// had already failed or left
+func (c *Cluster) GetMisrouted() int64 {
+	c.loadMutex.Lock()
+	defer c.loadMutex.Unlock()
+
+	return c.misrouted
+}
+
+func (c *Cluster) GetMetrics() *engine.Metrics {
+	c.metricsMutex.RLock()
+	defer c.metricsMutex.RUnlock()
+
+	metricsCopy := *c.metrics
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	stats := c.GetStats()
+	metricsCopy.CacheHitRate = stats.HitRate()
+	metricsCopy.StaleReads = stats.StaleReads
+	metricsCopy.CoalescedRequests = stats.Stampede.Coalesced
+	metricsCopy.BackendLoadSaved = stats.Stampede.LoadSaved()
+	return &metricsCopy
+}
+
+func (c *Cluster) GetCost() float64 {
+	cost := c.costPerHour
+	for _, node := range c.GetNodes() {
+		cost += node.GetCost()
+	}
+	return cost
+}
+
+func (c *Cluster) IsHealthy() bool {
+	return c.healthy
+}
+
+func (c *Cluster) SetHealthy(healthy bool) {
+	c.healthy = healthy
+}
@@ -0,0 +1,328 @@
+package cache
+
+import (
+	"container/list"
+	"math/rand"
+)
+
+// evictor decides which keys a cache keeps. Capacity is in bytes, so
+// segment sizes of the segmented policies are byte budgets too. Evictors are
+// not safe for concurrent use; the cache calls them under entriesMutex.
+type evictor interface {
+	// Record notes a lookup of key, whether it hit or missed
+	Record(key string)
+	Hit(key string)
+	// Insert adds key and returns the keys evicted to make room. The new key
+	// itself is returned when the policy refuses to admit it.
+	Insert(key string, size int64, capacity int64) []string
+	Remove(key string)
+}
+
+func newEvictor(policy EvictionPolicy) evictor {
+	switch policy {
+	case EvictionLFU:
+		return newLFU()
+	case EvictionFIFO:
+		return &lruEvictor{list: newKeyList(), fifo: true}
+	case EvictionRandom:
+		return newRandomEvictor()
+	case EvictionSLRU:
+		return newSLRU()
+	case EvictionTwoQ:
+		return newTwoQ()
+	case EvictionARC:
+		return newARC()
+	case EvictionTinyLFU:
+		return newTinyLFU()
+	default:
+		return &lruEvictor{list: newKeyList()}
+	}
+}
+
+type keyNode struct {
+	key  string
+	size int64
+}
+
+// keyList is a recency-ordered list of keys (most recent at the front)
+// with O(1) lookup, move and removal, tracking the bytes it holds
+type keyList struct {
+	order    *list.List
+	elements map[string]*list.Element
+	bytes    int64
+}
+
+func newKeyList() *keyList {
+	return &keyList{order: list.New(), elements: make(map[string]*list.Element)}
+}
+
+func (l *keyList) contains(key string) bool {
+	_, exists := l.elements[key]
+	return exists
+}
+
+func (l *keyList) pushFront(key string, size int64) {
+	l.elements[key] = l.order.PushFront(&keyNode{key: key, size: size})
+	l.bytes += size
+}
+
+func (l *keyList) moveToFront(key string) {
+	if element, exists := l.elements[key]; exists {
+		l.order.MoveToFront(element)
+	}
+}
+
+func (l *keyList) remove(key string) (int64, bool) {
+	element, exists := l.elements[key]
+	if !exists {
+		return 0, false
+	}
+	node := l.order.Remove(element).(*keyNode)
+	delete(l.elements, key)
+	l.bytes -= node.size
+	return node.size, true
+}
+
+// popBack removes and returns the least recent key
+func (l *keyList) popBack() (*keyNode, bool) {
+	element := l.order.Back()
+	if element == nil {
+		return nil, false
+	}
+	node := l.order.Remove(element).(*keyNode)
+	delete(l.elements, node.key)
+	l.bytes -= node.size
+	return node, true
+}
+
+func (l *keyList) back() (*keyNode, bool) {
+	element := l.order.Back()
+	if element == nil {
+		return nil, false
+	}
+	return element.Value.(*keyNode), true
+}
+
+func (l *keyList) len() int {
+	return l.order.Len()
+}
+
+// lruEvictor evicts the least recently used key. As FIFO it ignores hits and
+// evicts in insertion order.
+type lruEvictor struct {
+	list *keyList
+	fifo bool
+}
+
+func (e *lruEvictor) Record(key string) {}
+
+func (e *lruEvictor) Hit(key string) {
+	if !e.fifo {
+		e.list.moveToFront(key)
+	}
+}
+
+func (e *lruEvictor) Insert(key string, size int64, capacity int64) []string {
+	e.list.pushFront(key, size)
+
+	evicted := make([]string, 0)
+	for e.list.bytes > capacity {
+		node, _ := e.list.popBack()
+		evicted = append(evicted, node.key)
+	}
+	return evicted
+}
+
+func (e *lruEvictor) Remove(key string) {
+	e.list.remove(key)
+}
+
+type randomEvictor struct {
+	keys    []string
+	sizes   []int64
+	indexes map[string]int
+	bytes   int64
+}
+
+func newRandomEvictor() *randomEvictor {
+	return &randomEvictor{indexes: make(map[string]int)}
+}
+
+func (e *randomEvictor) Record(key string) {}
+
+func (e *randomEvictor) Hit(key string) {}
+
+func (e *randomEvictor) Insert(key string, size int64, capacity int64) []string {
+	e.indexes[key] = len(e.keys)
+	e.keys = append(e.keys, key)
+	e.sizes = append(e.sizes, size)
+	e.bytes += size
+
+	evicted := make([]string, 0)
+	for e.bytes > capacity {
+		victim := e.keys[rand.Intn(len(e.keys))]
+		e.Remove(victim)
+		evicted = append(evicted, victim)
+	}
+	return evicted
+}
+
+// Remove swaps the key with the last one so removal stays O(1)
+func (e *randomEvictor) Remove(key string) {
+	index, exists := e.indexes[key]
+	if !exists {
+		return
+	}
+
+	last := len(e.keys) - 1
+	e.bytes -= e.sizes[index]
+	e.keys[index], e.sizes[index] = e.keys[last], e.sizes[last]
+	e.indexes[e.keys[index]] = index
+	e.keys, e.sizes = e.keys[:last], e.sizes[:last]
+	delete(e.indexes, key)
+}
+
+// lfuEvictor keeps keys in buckets by access count, the buckets in a list
+// ordered by count, so hits and evictions are O(1). Ties within a bucket
+// are broken by recency.
+type lfuEvictor struct {
+	buckets *list.List
+	items   map[string]*lfuItem
+	bytes   int64
+}
+
+type lfuBucket struct {
+	count int64
+	keys  *keyList
+}
+
+type lfuItem struct {
+	bucket *list.Element
+	size   int64
+}
+
+func newLFU() *lfuEvictor {
+	return &lfuEvictor{buckets: list.New(), items: make(map[string]*lfuItem)}
+}
+
+func (e *lfuEvictor) Record(key string) {}
+
+func (e *lfuEvictor) Hit(key string) {
+	item, exists := e.items[key]
+	if !exists {
+		return
+	}
+
+	current := item.bucket.Value.(*lfuBucket)
+	next := item.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket).count != current.count+1 {
+		next = e.buckets.InsertAfter(&lfuBucket{count: current.count + 1, keys: newKeyList()}, item.bucket)
+	}
+
+	current.keys.remove(key)
+	next.Value.(*lfuBucket).keys.pushFront(key, item.size)
+	if current.keys.len() == 0 {
+		e.buckets.Remove(item.bucket)
+	}
+	item.bucket = next
+}
+
+func (e *lfuEvictor) Insert(key string, size int64, capacity int64) []string {
+	evicted := make([]string, 0)
+	for e.bytes+size > capacity && len(e.items) > 0 {
+		front := e.buckets.Front()
+		node, _ := front.Value.(*lfuBucket).keys.back()
+		e.Remove(node.key)
+		evicted = append(evicted, node.key)
+	}
+	if size > capacity {
+		return append(evicted, key)
+	}
+
+	first := e.buckets.Front()
+	if first == nil || first.Value.(*lfuBucket).count != 1 {
+		first = e.buckets.PushFront(&lfuBucket{count: 1, keys: newKeyList()})
+	}
+	first.Value.(*lfuBucket).keys.pushFront(key, size)
+	e.items[key] = &lfuItem{bucket: first, size: size}
+	e.bytes += size
+	return evicted
+}
+
+func (e *lfuEvictor) Remove(key string) {
+	item, exists := e.items[key]
+	if !exists {
+		return
+	}
+
+	bucket := item.bucket.Value.(*lfuBucket)
+	bucket.keys.remove(key)
+	if bucket.keys.len() == 0 {
+		e.buckets.Remove(item.bucket)
+	}
+	delete(e.items, key)
+	e.bytes -= item.size
+}
+
+// slruProtectedShare is the part of an SLRU's capacity reserved for keys
+// that were hit at least once after being inserted
+const slruProtectedShare = 0.8
+
+// slruEvictor inserts keys on probation and promotes them to the protected
+// segment on their second access, so one-off scans only churn probation
+type slruEvictor struct {
+	probation      *keyList
+	protected      *keyList
+	protectedLimit int64
+}
+
+func newSLRU() *slruEvictor {
+	return &slruEvictor{probation: newKeyList(), protected: newKeyList()}
+}
+
+func (e *slruEvictor) Record(key string) {}
+
+func (e *slruEvictor) Hit(key string) {
+	slruHit(e.probation, e.protected, key, e.protectedLimit)
+}
+
+func (e *slruEvictor) Insert(key string, size int64, capacity int64) []string {
+	e.protectedLimit = int64(float64(capacity) * slruProtectedShare)
+	e.probation.pushFront(key, size)
+
+	evicted := make([]string, 0)
+	for e.probation.bytes+e.protected.bytes > capacity {
+		segment := e.probation
+		if segment.len() == 0 {
+			segment = e.protected
+		}
+		node, _ := segment.popBack()
+		evicted = append(evicted, node.key)
+	}
+	return evicted
+}
+
+func (e *slruEvictor) Remove(key string) {
+	if _, removed := e.probation.remove(key); !removed {
+		e.protected.remove(key)
+	}
+}
+
+// slruHit promotes a probationary key, demoting the least recent protected
+// keys back to probation when the protected segment overflows
+func slruHit(probation, protected *keyList, key string, protectedLimit int64) {
+	if protected.contains(key) {
+		protected.moveToFront(key)
+		return
+	}
+
+	size, found := probation.remove(key)
+	if !found {
+		return
+	}
+	protected.pushFront(key, size)
+	for protected.bytes > protectedLimit && protected.len() > 1 {
+		node, _ := protected.popBack()
+		probation.pushFront(node.key, node.size)
+	}
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// replayer runs scripts of lookups against an evictor the way the cache
+// does: each lookup is recorded, then hits a resident key or inserts a
+// missing one. A step is "key" for 10 bytes or "key:size".
+type replayer struct {
+	t        *testing.T
+	evictor  evictor
+	capacity int64
+	resident map[string]int64
+}
+
+func newReplayer(t *testing.T, e evictor, capacity int64) *replayer {
+	return &replayer{t: t, evictor: e, capacity: capacity, resident: make(map[string]int64)}
+}
+
+// run returns the keys evicted, in order, and fails if the resident keys
+// ever exceed the capacity
+func (r *replayer) run(script string) []string {
+	r.t.Helper()
+	evicted := make([]string, 0)
+	for _, step := range strings.Fields(script) {
+		key, size := step, int64(10)
+		if name, bytes, sized := strings.Cut(step, ":"); sized {
+			key = name
+			size, _ = strconv.ParseInt(bytes, 10, 64)
+		}
+
+		r.evictor.Record(key)
+		if _, hit := r.resident[key]; hit {
+			r.evictor.Hit(key)
+			continue
+		}
+		r.resident[key] = size
+		for _, victim := range r.evictor.Insert(key, size, r.capacity) {
+			delete(r.resident, victim)
+			evicted = append(evicted, victim)
+		}
+
+		var bytes int64
+		for _, size := range r.resident {
+			bytes += size
+		}
+		if bytes > r.capacity {
+			r.t.Fatalf("after %s the cache holds %d bytes, over its %d", step, bytes, r.capacity)
+		}
+	}
+	return evicted
+}
+
+func TestEvictionOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  EvictionPolicy
+		script  string
+		evicted []string
+	}{
+		{"LRU evicts the least recently used", EvictionLRU, "a b c a d e", []string{"b", "c"}},
+		{"LFU evicts the least frequently used", EvictionLFU, "a b c a a b d e", []string{"c", "d"}},
+		{"LFU breaks ties by recency", EvictionLFU, "a b c d", []string{"a"}},
+		{"SLRU keeps hit keys through a scan", EvictionSLRU, "a b c a b d e", []string{"c", "d"}},
+		{"SLRU demotes when protected overflows", EvictionSLRU, "a b c a b c d", []string{"a"}},
+		{"2Q keeps a remembered key through a scan", EvictionTwoQ, "a b c d a e f g", []string{"a", "b", "c", "d", "e"}},
+		{"ARC adapts between recency and frequency", EvictionARC, "a b c a d b e a", []string{"b", "c", "a", "d"}},
+		{"W-TinyLFU refuses a key seen less than its victim", EvictionTinyLFU, "a b c a a d", []string{"d"}},
+		{"W-TinyLFU admits a key seen more than its victim", EvictionTinyLFU, "a b c a a d d", []string{"d", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evicted := newReplayer(t, newEvictor(tt.policy), 30).run(tt.script)
+			if !reflect.DeepEqual(evicted, tt.evicted) {
+				t.Errorf("evicted %v, want %v", evicted, tt.evicted)
+			}
+		})
+	}
+}
+
+// Every policy stays within its byte capacity whatever the mix of sizes,
+// including keys larger than the whole cache
+func TestEvictionStaysWithinCapacity(t *testing.T) {
+	policies := []EvictionPolicy{EvictionLRU, EvictionLFU, EvictionSLRU, EvictionTwoQ, EvictionARC, EvictionTinyLFU}
+
+	random := rand.New(rand.NewSource(1))
+	steps := make([]string, 0, 5000)
+	for i := 0; i < cap(steps); i++ {
+		key := random.Intn(200)
+		// A skewed workload: a few keys take most lookups
+		if random.Intn(2) == 0 {
+			key = random.Intn(10)
+		}
+		steps = append(steps, fmt.Sprintf("k%d:%d", key, 1+(key*37)%600))
+	}
+	script := strings.Join(steps, " ")
+
+	for _, policy := range policies {
+		t.Run(string(policy), func(t *testing.T) {
+			newReplayer(t, newEvictor(policy), 500).run(script)
+		})
+	}
+}
+
+// A hit on B1 grows ARC's target for T1 and a hit on B2 shrinks it
+func TestARCTargetAdapts(t *testing.T) {
+	e := newARC()
+	r := newReplayer(t, e, 30)
+	r.run("a b c a d")
+	if !e.b1.contains("b") || e.target != 0 {
+		t.Fatalf("b1 holds b: %v, target %d; want b remembered and target 0", e.b1.contains("b"), e.target)
+	}
+
+	r.run("b")
+	if !e.t2.contains("b") || e.target != 10 {
+		t.Errorf("after b returned from B1, T2 holds it: %v, target %d; want true and 10", e.t2.contains("b"), e.target)
+	}
+
+	r.run("e")
+	if !e.b2.contains("a") {
+		t.Fatal("a was not remembered in B2")
+	}
+	r.run("a")
+	if !e.t2.contains("a") || e.target != 0 {
+		t.Errorf("after a returned from B2, T2 holds it: %v, target %d; want true and 0", e.t2.contains("a"), e.target)
+	}
+}
+
+// ARC's ghost lists stay bounded: T1 and B1 within the capacity, and all
+// four lists within twice it
+func TestARCTrimsGhosts(t *testing.T) {
+	e := newARC()
+	r := newReplayer(t, e, 50)
+	for i := 0; i < 100; i++ {
+		// Hit every other key so both T2 and B2 fill
+		r.run(fmt.Sprintf("k%d k%d", i, i-i%2))
+
+		if e.t1.bytes+e.b1.bytes > 50 {
+			t.Fatalf("T1+B1 hold %d bytes, over the capacity of 50", e.t1.bytes+e.b1.bytes)
+		}
+		if total := e.t1.bytes + e.t2.bytes + e.b1.bytes + e.b2.bytes; total > 100 {
+			t.Fatalf("the lists hold %d bytes, over twice the capacity", total)
+		}
+	}
+	if e.b2.len() == 0 {
+		t.Error("B2 never remembered a key evicted from T2")
+	}
+}
+
+// 2Q promotes a key evicted from A1in to Am when it comes back while A1out
+// remembers it, and forgets it once A1out is trimmed
+func TestTwoQGhostPromotion(t *testing.T) {
+	e := newTwoQ()
+	r := newReplayer(t, e, 30)
+	r.run("a b c d")
+	if !e.ghost.contains("a") {
+		t.Fatal("a was not remembered after leaving A1in")
+	}
+	r.run("a")
+	if !e.main.contains("a") || e.ghost.contains("a") {
+		t.Errorf("a in Am: %v, in A1out: %v; want it moved to Am", e.main.contains("a"), e.ghost.contains("a"))
+	}
+
+	e = newTwoQ()
+	r = newReplayer(t, e, 30)
+	// A1out holds 15 bytes, so by the time e is evicted a is forgotten
+	r.run("a b c d e")
+	if e.ghost.contains("a") {
+		t.Fatal("A1out kept a past its budget")
+	}
+	r.run("a")
+	if e.main.contains("a") || !e.in.contains("a") {
+		t.Errorf("a in Am: %v, in A1in: %v; want it back in A1in", e.main.contains("a"), e.in.contains("a"))
+	}
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// StampedeProtection toggles the defences against a thundering herd: many
+// concurrent misses on a hot key that just expired all going to the backend
+type StampedeProtection struct {
+	// Coalesce makes concurrent misses for a key share one backend fetch
+	Coalesce bool
+	// EarlyExpiration refreshes entries probabilistically before they
+	// expire (XFetch). Beta above 1 favours earlier refreshes.
+	EarlyExpiration bool
+	Beta            float64
+	// StaleWhileRevalidate serves expired entries for up to StaleWindow
+	// while a single background fetch refreshes them
+	StaleWhileRevalidate bool
+	StaleWindow          time.Duration
+	// NegativeCaching caches not-found results for NegativeTTL
+	NegativeCaching bool
+	NegativeTTL     time.Duration
+}
+
+func DefaultStampedeProtection() StampedeProtection {
+	return StampedeProtection{
+		Beta:        1.0,
+		StaleWindow: 30 * time.Second,
+		NegativeTTL: 10 * time.Second,
+	}
+}
+
+// StampedeStats counts how misses reached the backend, and how many were
+// kept away from it
+type StampedeStats struct {
+	BackendFetches int64
+	Coalesced      int64 // misses that waited on another request's fetch
+	EarlyRefreshes int64
+	StaleServed    int64
+	NegativeHits   int64
+}
+
+// LoadSaved is the number of requests that would have gone to the backend
+// without the protections
+func (s StampedeStats) LoadSaved() int64 {
+	return s.Coalesced + s.StaleServed + s.NegativeHits
+}
+
+type Freshness int
+
+const (
+	Expired Freshness = iota
+	Fresh
+	// Stale entries are expired but may be served while they revalidate
+	Stale
+	// RefreshEarly entries are fresh, but XFetch picked this read to
+	// refresh them
+	RefreshEarly
+)
+
+// Freshness classifies an entry that expires at expiry and took delta to
+// fetch. XFetch refreshes when now - delta*beta*ln(rand) passes the expiry,
+// so refreshes spread out ahead of it and start earlier for slow fetches.
+func (p StampedeProtection) Freshness(expiry time.Time, delta time.Duration, now time.Time) Freshness {
+	if !now.Before(expiry) {
+		if p.StaleWhileRevalidate && now.Before(expiry.Add(p.StaleWindow)) {
+			return Stale
+		}
+		return Expired
+	}
+
+	if p.EarlyExpiration && delta > 0 {
+		beta := p.Beta
+		if beta <= 0 {
+			beta = 1.0
+		}
+		gap := time.Duration(-float64(delta) * beta * math.Log(1-rand.Float64()))
+		if !now.Add(gap).Before(expiry) {
+			return RefreshEarly
+		}
+	}
+	return Fresh
+}
+
+// TTLFor returns how long a backend response may be cached, and whether it
+// may be cached at all
+func (p StampedeProtection) TTLFor(resp *engine.Response, ttl time.Duration) (time.Duration, bool) {
+	if IsNotFound(resp) {
+		return p.NegativeTTL, p.NegativeCaching && p.NegativeTTL > 0
+	}
+	return ttl, true
+}
+
+// IsNotFound reports whether the backend answered that the key does not exist
+func IsNotFound(resp *engine.Response) bool {
+	if resp == nil || resp.Metadata == nil {
+		return false
+	}
+	notFound, _ := resp.Metadata["not_found"].(bool)
+	return notFound
+}
+
+// FlightGroup lets concurrent fetches of one key share a single call. The
+// zero value is ready to use.
+type FlightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	resp *engine.Response
+	err  error
+}
+
+// Do runs fetch unless a fetch for key is already running, in which case it
+// waits for that one. Waiters get their own copy of the response; shared
+// reports whether this call was one of them.
+func (g *FlightGroup) Do(key string, fetch func() (*engine.Response, error)) (*engine.Response, error, bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+	if call, running := g.calls[key]; running {
+		g.mu.Unlock()
+		<-call.done
+		return copyResponse(call.resp), call.err, true
+	}
+	call := &flight{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	resp, err := fetch()
+	// The caller is free to modify resp, so waiters copy a snapshot
+	call.resp = copyResponse(resp)
+	call.err = err
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+
+	return resp, err, false
+}
+
+// InFlight reports whether a fetch for key is running
+func (g *FlightGroup) InFlight(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	_, running := g.calls[key]
+	return running
+}
+
+func copyResponse(resp *engine.Response) *engine.Response {
+	if resp == nil {
+		return nil
+	}
+	copied := *resp
+	copied.HopsTrace = append([]string(nil), resp.HopsTrace...)
+	if resp.Metadata != nil {
+		copied.Metadata = make(map[string]interface{}, len(resp.Metadata))
+		for key, value := range resp.Metadata {
+			copied.Metadata[key] = value
+		}
+	}
+	return &copied
+}
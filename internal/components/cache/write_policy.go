@@ -0,0 +1,260 @@
+package cache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+type WritePolicy string
+
+const (
+	// Writes go to the backend and drop the cached copy; the next read
+	// misses and reloads it
+	WriteInvalidate WritePolicy = "cache-aside"
+	// Writes go to the backend, then update the cache before acknowledging
+	WriteThrough WritePolicy = "write-through"
+	// Writes only update the cache and are flushed to the backend later;
+	// acknowledged writes are lost if the cache dies first
+	WriteBack WritePolicy = "write-back"
+	// Writes go to the backend only; cached copies stay stale until they
+	// expire or are evicted
+	WriteAround WritePolicy = "write-around"
+)
+
+func GetWritePolicies() []WritePolicy {
+	return []WritePolicy{WriteInvalidate, WriteThrough, WriteBack, WriteAround}
+}
+
+// versionSource is a backend that can tell the latest version of a key
+type versionSource interface {
+	GetVersion(key string) int64
+}
+
+func responseVersion(resp *engine.Response) int64 {
+	if resp == nil || resp.Metadata == nil {
+		return 0
+	}
+	version, _ := resp.Metadata["version"].(int64)
+	return version
+}
+
+func (c *Cache) processWrite(req *engine.Request, start time.Time) (*engine.Response, error) {
+	if c.Backend == nil {
+		return c.fail(req, start, fmt.Errorf("cache has no backend to write to"))
+	}
+
+	var resp *engine.Response
+	var err error
+
+	switch c.WritePolicy {
+	case WriteBack:
+		time.Sleep(c.WriteLatency)
+		c.entriesMutex.Lock()
+		dirtyEvicted := c.setDirty(req.Path, req.DataSize)
+		c.entriesMutex.Unlock()
+		if len(dirtyEvicted) > 0 {
+			go c.writeBack(dirtyEvicted)
+		}
+		resp = &engine.Response{
+			RequestID: req.ID,
+			Success:   true,
+			HopsTrace: []string{c.ID},
+		}
+
+	case WriteThrough:
+		resp, err = c.Backend.Process(req)
+		if err == nil && resp != nil && resp.Success {
+			time.Sleep(c.WriteLatency)
+			c.entriesMutex.Lock()
+			dirtyEvicted := c.set(req.Path, req.DataSize, responseVersion(resp), false)
+			c.entriesMutex.Unlock()
+			if len(dirtyEvicted) > 0 {
+				go c.writeBack(dirtyEvicted)
+			}
+		} else {
+			c.evict(req.Path)
+		}
+
+	case WriteAround:
+		resp, err = c.Backend.Process(req)
+
+	default:
+		resp, err = c.Backend.Process(req)
+		c.evict(req.Path)
+	}
+
+	totalLatency := time.Since(start)
+
+	c.metricsMutex.Lock()
+	if err == nil && resp != nil && resp.Success {
+		c.metrics.SuccessCount++
+	} else {
+		c.metrics.FailureCount++
+	}
+	c.metrics.TotalLatency += totalLatency
+	c.metrics.AverageLatency = time.Duration(int64(c.metrics.TotalLatency) / c.metrics.RequestCount)
+	c.metricsMutex.Unlock()
+
+	if resp != nil {
+		resp.Latency = totalLatency
+		if c.WritePolicy != WriteBack {
+			resp.HopsTrace = append([]string{c.ID}, resp.HopsTrace...)
+		}
+	}
+	return resp, err
+}
+
+func (c *Cache) fail(req *engine.Request, start time.Time, err error) (*engine.Response, error) {
+	c.metricsMutex.Lock()
+	c.metrics.FailureCount++
+	c.metricsMutex.Unlock()
+
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   false,
+		Latency:   time.Since(start),
+		Error:     err,
+	}, err
+}
+
+// setDirty stores a write-back write. Writes to a key that is already dirty
+// are coalesced into a single flush.
+func (c *Cache) setDirty(key string, size int64) []*CacheEntry {
+	if entry, exists := c.entries[key]; exists && entry.Dirty {
+		c.UsedCapacity += size - entry.Size
+		entry.Size = size
+		entry.Data = make([]byte, size)
+		entry.AccessTime = time.Now()
+		entry.Expiry = time.Now().Add(c.TTL)
+		entry.writes++
+		c.stats.CoalescedWrites++
+		return nil
+	}
+
+	dirtyEvicted := c.set(key, size, 0, true)
+	if entry, exists := c.entries[key]; exists {
+		entry.writes = 1
+	} else {
+		// Not admitted; the write has to go straight to the backend
+		dirtyEvicted = append(dirtyEvicted, &CacheEntry{Key: key, Size: size, Dirty: true})
+	}
+	return dirtyEvicted
+}
+
+// isStale reports whether a cached copy is older than the backend's latest
+// write. Dirty entries are newer than the backend, never stale.
+func (c *Cache) isStale(entry *CacheEntry) bool {
+	if entry.Dirty {
+		return false
+	}
+	source, ok := c.Backend.(versionSource)
+	if !ok {
+		return false
+	}
+	return source.GetVersion(entry.Key) > entry.Version
+}
+
+func (c *Cache) recordStaleRead() {
+	c.entriesMutex.Lock()
+	c.stats.StaleReads++
+	c.entriesMutex.Unlock()
+
+	c.metricsMutex.Lock()
+	c.metrics.StaleReads++
+	c.metricsMutex.Unlock()
+}
+
+// Tick flushes dirty entries every FlushInterval. Entries can stay dirty
+// after switching away from write-back, so this runs for every policy.
+func (c *Cache) Tick(now time.Time) {
+	if !c.healthy {
+		return
+	}
+	if !c.lastFlush.IsZero() && now.Sub(c.lastFlush) < c.FlushInterval {
+		return
+	}
+	c.lastFlush = now
+
+	if atomic.CompareAndSwapInt32(&c.flushing, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&c.flushing, 0)
+			c.Flush()
+		}()
+	}
+}
+
+// Flush writes every dirty entry to the backend and returns how many were
+// written. Entries written to again during the flush stay dirty.
+func (c *Cache) Flush() int {
+	type pending struct {
+		key    string
+		size   int64
+		writes int64
+	}
+
+	c.entriesMutex.RLock()
+	batch := make([]pending, 0)
+	for key, entry := range c.entries {
+		if entry.Dirty {
+			batch = append(batch, pending{key: key, size: entry.Size, writes: entry.writes})
+		}
+	}
+	c.entriesMutex.RUnlock()
+
+	flushed := 0
+	for _, item := range batch {
+		resp, err := c.Backend.Process(c.flushRequest(item.key, item.size))
+		if err != nil || resp == nil || !resp.Success {
+			continue
+		}
+		flushed++
+
+		c.entriesMutex.Lock()
+		if entry, exists := c.entries[item.key]; exists && entry.Dirty && entry.writes == item.writes {
+			entry.Dirty = false
+			entry.Version = responseVersion(resp)
+		}
+		c.stats.Flushed++
+		c.entriesMutex.Unlock()
+	}
+	return flushed
+}
+
+// writeBack persists dirty entries that were evicted before being flushed
+func (c *Cache) writeBack(entries []*CacheEntry) {
+	for _, entry := range entries {
+		resp, err := c.Backend.Process(c.flushRequest(entry.Key, entry.Size))
+
+		c.entriesMutex.Lock()
+		if err != nil || resp == nil || !resp.Success {
+			c.stats.LostWrites++
+		} else {
+			c.stats.Flushed++
+		}
+		c.entriesMutex.Unlock()
+	}
+}
+
+func (c *Cache) flushRequest(key string, size int64) *engine.Request {
+	return &engine.Request{
+		ID:        fmt.Sprintf("%s-flush-%d", c.ID, atomic.AddUint64(&c.flushCounter, 1)),
+		Type:      engine.RequestTypeWrite,
+		Timestamp: time.Now(),
+		Path:      key,
+		DataSize:  size,
+		Source:    c.ID,
+	}
+}
+
+// Invalidate drops the cached copy of a key. Applications doing cache-aside
+// themselves call this after writing to the database.
+func (c *Cache) Invalidate(key string) {
+	c.evict(key)
+}
+
+func (c *Cache) HasBackend() bool {
+	return c.Backend != nil
+}
@@ -5,25 +5,44 @@ import (
 	"sync"
 	"time"
 
+	"github.com/javanhut/systemdesignsim/internal/components/cache"
 	"github.com/javanhut/systemdesignsim/internal/engine"
 )
 
 type EdgeLocation struct {
 	Region      string
-	Cache       map[string][]byte
+	Cache       map[string]*EdgeEntry
 	CacheMutex  sync.RWMutex
 	HitCount    int64
 	MissCount   int64
 }
 
+type EdgeEntry struct {
+	Size     int64
+	Expiry   time.Time
+	Delta    time.Duration // how long the origin took to produce it
+	NotFound bool
+}
+
+func NewEdgeLocation(region string) *EdgeLocation {
+	return &EdgeLocation{
+		Region: region,
+		Cache:  make(map[string]*EdgeEntry),
+	}
+}
+
 type CDN struct {
 	ID            string
 	EdgeLocations map[string]*EdgeLocation
 	Origin        engine.Component
 	TTL           time.Duration
+	Protection    cache.StampedeProtection
 	healthy       bool
 	metrics       *engine.Metrics
 	metricsMutex  sync.RWMutex
+	flights       cache.FlightGroup
+	stampede      cache.StampedeStats
+	stampedeMutex sync.Mutex
 	costPerHour   float64
 }
 
@@ -32,16 +51,14 @@ func NewCDN(id string, regions []string) *CDN {
 		ID:            id,
 		EdgeLocations: make(map[string]*EdgeLocation),
 		TTL:           time.Hour,
+		Protection:    cache.DefaultStampedeProtection(),
 		healthy:       true,
 		metrics:       &engine.Metrics{},
 		costPerHour:   0.08,
 	}
 	
 	for _, region := range regions {
-		cdn.EdgeLocations[region] = &EdgeLocation{
-			Region: region,
-			Cache:  make(map[string][]byte),
-		}
+		cdn.EdgeLocations[region] = NewEdgeLocation(region)
 	}
 	
 	return cdn
@@ -92,11 +109,12 @@ func (cdn *CDN) Process(req *engine.Request) (*engine.Response, error) {
 	}
 
 	if edge != nil && req.Type == engine.RequestTypeRead {
-		edge.CacheMutex.RLock()
-		data, cached := edge.Cache[req.Path]
-		edge.CacheMutex.RUnlock()
+		entry, freshness := cdn.lookup(edge, req.Path)
 		
-		if cached {
+		if entry != nil {
+			if freshness == cache.Stale {
+				cdn.revalidate(edge, req)
+			}
 			edge.HitCount++
 			
 			time.Sleep(2 * time.Millisecond)
@@ -109,26 +127,30 @@ func (cdn *CDN) Process(req *engine.Request) (*engine.Response, error) {
 			cdn.metrics.AverageLatency = time.Duration(int64(cdn.metrics.TotalLatency) / cdn.metrics.RequestCount)
 			cdn.metricsMutex.Unlock()
 			
-			return &engine.Response{
+			resp := &engine.Response{
 				RequestID: req.ID,
 				Success:   true,
 				Latency:   totalLatency,
-				DataSize:  int64(len(data)),
+				DataSize:  entry.Size,
 				CacheHit:  true,
 				HopsTrace: []string{fmt.Sprintf("%s-edge-%s", cdn.ID, edge.Region)},
-			}, nil
+			}
+			if entry.NotFound {
+				resp.Metadata = map[string]interface{}{"not_found": true}
+			}
+			return resp, nil
 		}
 		
 		edge.MissCount++
 	}
 
 	if cdn.Origin != nil {
-		resp, err := cdn.Origin.Process(req)
-		
-		if err == nil && resp.Success && req.Type == engine.RequestTypeRead && edge != nil {
-			edge.CacheMutex.Lock()
-			edge.Cache[req.Path] = make([]byte, resp.DataSize)
-			edge.CacheMutex.Unlock()
+		var resp *engine.Response
+		var err error
+		if req.Type == engine.RequestTypeRead && edge != nil {
+			resp, err = cdn.fetch(edge, req)
+		} else {
+			resp, err = cdn.Origin.Process(req)
 		}
 		
 		if resp != nil {
@@ -151,6 +173,104 @@ func (cdn *CDN) Process(req *engine.Request) (*engine.Response, error) {
 	}, fmt.Errorf("CDN cache miss and no origin")
 }
 
+// lookup returns an edge's copy of a path while it is Fresh or Stale
+func (cdn *CDN) lookup(edge *EdgeLocation, path string) (*EdgeEntry, cache.Freshness) {
+	edge.CacheMutex.Lock()
+	entry, cached := edge.Cache[path]
+	freshness := cache.Expired
+	if cached {
+		freshness = cdn.Protection.Freshness(entry.Expiry, entry.Delta, time.Now())
+		if freshness == cache.Expired {
+			delete(edge.Cache, path)
+		}
+	}
+	edge.CacheMutex.Unlock()
+	
+	cdn.stampedeMutex.Lock()
+	defer cdn.stampedeMutex.Unlock()
+	
+	switch freshness {
+	case cache.Expired:
+		return nil, freshness
+	case cache.RefreshEarly:
+		cdn.stampede.EarlyRefreshes++
+		return nil, freshness
+	case cache.Stale:
+		cdn.stampede.StaleServed++
+	}
+	if entry.NotFound {
+		cdn.stampede.NegativeHits++
+	}
+	copied := *entry
+	return &copied, freshness
+}
+
+// fetch loads a path into an edge from the origin. Each edge fetches on its
+// own, so coalescing is per edge and path.
+func (cdn *CDN) fetch(edge *EdgeLocation, req *engine.Request) (*engine.Response, error) {
+	if !cdn.Protection.Coalesce {
+		return cdn.load(edge, req)
+	}
+	
+	resp, err, shared := cdn.flights.Do(edge.Region+"|"+req.Path, func() (*engine.Response, error) {
+		return cdn.load(edge, req)
+	})
+	if shared {
+		cdn.stampedeMutex.Lock()
+		cdn.stampede.Coalesced++
+		cdn.stampedeMutex.Unlock()
+		if resp != nil {
+			resp.RequestID = req.ID
+		}
+	}
+	return resp, err
+}
+
+func (cdn *CDN) load(edge *EdgeLocation, req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+	resp, err := cdn.Origin.Process(req)
+	delta := time.Since(start)
+	
+	cdn.stampedeMutex.Lock()
+	cdn.stampede.BackendFetches++
+	cdn.stampedeMutex.Unlock()
+	
+	if err == nil && resp != nil && resp.Success {
+		if ttl, cacheable := cdn.Protection.TTLFor(resp, cdn.TTL); cacheable {
+			edge.CacheMutex.Lock()
+			edge.Cache[req.Path] = &EdgeEntry{
+				Size:     resp.DataSize,
+				Expiry:   time.Now().Add(ttl),
+				Delta:    delta,
+				NotFound: cache.IsNotFound(resp),
+			}
+			edge.CacheMutex.Unlock()
+		}
+	}
+	return resp, err
+}
+
+// revalidate refreshes a stale edge copy in the background
+func (cdn *CDN) revalidate(edge *EdgeLocation, req *engine.Request) {
+	key := edge.Region + "|" + req.Path
+	if cdn.flights.InFlight(key) {
+		return
+	}
+	
+	refresh := *req
+	refresh.ID = req.ID + "-revalidate"
+	go cdn.flights.Do(key, func() (*engine.Response, error) {
+		return cdn.load(edge, &refresh)
+	})
+}
+
+func (cdn *CDN) GetStampedeStats() cache.StampedeStats {
+	cdn.stampedeMutex.Lock()
+	defer cdn.stampedeMutex.Unlock()
+	
+	return cdn.stampede
+}
+
 func (cdn *CDN) GetMetrics() *engine.Metrics {
 	cdn.metricsMutex.RLock()
 	defer cdn.metricsMutex.RUnlock()
@@ -169,6 +289,9 @@ func (cdn *CDN) GetMetrics() *engine.Metrics {
 			metricsCopy.CacheHitRate = float64(totalHits) / float64(totalRequests)
 		}
 	}
+	stampede := cdn.GetStampedeStats()
+	metricsCopy.CoalescedRequests = stampede.Coalesced
+	metricsCopy.BackendLoadSaved = stampede.LoadSaved()
 	return &metricsCopy
 }
 
@@ -385,6 +385,10 @@ func GetDatabaseInstanceType(name string) *DatabaseInstanceType {
 	return DatabaseInstanceTypes["db.t2.micro"]
 }
 
+func (it *DatabaseInstanceType) GetVCPU() int {
+	return it.vCPU
+}
+
 func GetDatabaseInstanceTypeNames() []string {
 	names := []string{
 		"db.t2.micro", "db.t2.small",
@@ -107,6 +107,15 @@ func GetRegionIDs() []string {
 	return ids
 }
 
+// GetRegionName maps a region ID (us-east-1) to its short name (us-east).
+// Short names are passed through unchanged.
+func GetRegionName(region string) string {
+	if r, exists := Regions[region]; exists {
+		return r.Name
+	}
+	return region
+}
+
 type NetworkLatency struct {
 	FromRegion string
 	ToRegion   string
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"time"
+)
+
+// ChangeEvent is one committed write, as change data capture streams it
+type ChangeEvent struct {
+	Database  string
+	Key       string
+	Size      int64
+	Version   int64
+	Committed time.Time
+}
+
+// ChangeConsumer takes the writes a database streams to it, such as a
+// search index kept in sync with the database
+type ChangeConsumer interface {
+	ApplyChange(event ChangeEvent)
+}
+
+// AddChangeFeed streams every write this database commits to consumer,
+// CDCLag after the commit, the time it takes to tail the log
+func (db *Database) AddChangeFeed(consumer ChangeConsumer) {
+	db.roleMutex.Lock()
+	defer db.roleMutex.Unlock()
+
+	for _, existing := range db.changeFeeds {
+		if existing == consumer {
+			return
+		}
+	}
+	db.changeFeeds = append(db.changeFeeds, consumer)
+}
+
+// GetChangeFeeds returns the consumers this database streams writes to
+func (db *Database) GetChangeFeeds() []ChangeConsumer {
+	db.roleMutex.RLock()
+	defer db.roleMutex.RUnlock()
+
+	return append([]ChangeConsumer(nil), db.changeFeeds...)
+}
+
+// SetCDCLag changes how long change feeds take to see a write
+func (db *Database) SetCDCLag(lag time.Duration) {
+	db.roleMutex.Lock()
+	db.CDCLag = lag
+	db.roleMutex.Unlock()
+}
+
+// publishChange sends a committed write to every change feed
+func (db *Database) publishChange(entry logEntry) {
+	db.roleMutex.RLock()
+	feeds := db.changeFeeds
+	lag := db.CDCLag
+	db.roleMutex.RUnlock()
+	if len(feeds) == 0 {
+		return
+	}
+	event := ChangeEvent{
+		Database:  db.ID,
+		Key:       entry.key,
+		Size:      entry.size,
+		Version:   entry.version,
+		Committed: entry.committed,
+	}
+	go func() {
+		time.Sleep(lag)
+		for _, consumer := range feeds {
+			consumer.ApplyChange(event)
+		}
+	}()
+}
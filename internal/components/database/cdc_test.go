@@ -0,0 +1,80 @@
+package database
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// changeLog keeps every event a database streams to it
+type changeLog struct {
+	mu     sync.Mutex
+	events []ChangeEvent
+}
+
+func (c *changeLog) ApplyChange(event ChangeEvent) {
+	c.mu.Lock()
+	c.events = append(c.events, event)
+	c.mu.Unlock()
+}
+
+// wait returns the events once n have arrived
+func (c *changeLog) wait(t *testing.T, n int) []ChangeEvent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		events := append([]ChangeEvent(nil), c.events...)
+		c.mu.Unlock()
+		if len(events) >= n {
+			return events
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d change events, want %d", len(events), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// A sharded database streams each write with the version its shard committed
+func TestShardedWritesCarryVersions(t *testing.T) {
+	db := NewDatabase("db", DatabaseTypeSQL, "us-east-1", config.GetDatabaseInstanceType("db.m5.large"))
+	if err := db.EnableSharding(ShardingHash, 2); err != nil {
+		t.Fatal(err)
+	}
+	feed := &changeLog{}
+	db.AddChangeFeed(feed)
+
+	for i := 0; i < 3; i++ {
+		if _, err := db.Process(&engine.Request{ID: "w", Type: engine.RequestTypeWrite, Path: "/api/items/1", DataSize: 64}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, event := range feed.wait(t, 3) {
+		if event.Key != "/api/items/1" || event.Version != int64(i+1) {
+			t.Errorf("event %d is %s at version %d, want /api/items/1 at version %d", i, event.Key, event.Version, i+1)
+		}
+	}
+}
+
+// A write replicated from another leader reaches this leader's change feeds
+func TestLeaderWritesReachChangeFeeds(t *testing.T) {
+	instance := config.GetDatabaseInstanceType("db.m5.large")
+	local := NewDatabase("local", DatabaseTypeSQL, "us-east-1", instance)
+	peer := NewDatabase("peer", DatabaseTypeSQL, "us-east-1", instance)
+	local.AddLeader(peer)
+	defer local.Stop()
+	feed := &changeLog{}
+	peer.AddChangeFeed(feed)
+
+	if _, err := local.Process(&engine.Request{ID: "w", Type: engine.RequestTypeWrite, Path: "/api/items/1", DataSize: 64}); err != nil {
+		t.Fatal(err)
+	}
+	event := feed.wait(t, 1)[0]
+	if event.Database != "peer" || event.Key != "/api/items/1" || event.Version != 1 {
+		t.Errorf("got %+v, want version 1 of /api/items/1 from peer", event)
+	}
+}
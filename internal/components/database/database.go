@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/javanhut/systemdesignsim/internal/components/config"
 	"github.com/javanhut/systemdesignsim/internal/engine"
 )
 
@@ -22,44 +23,121 @@ type Database struct {
 	ID               string
 	Type             DatabaseType
 	Region           string
+	InstanceType     *config.DatabaseInstanceType
 	Capacity         int64
 	UsedCapacity     int64
-	ReadLatency      time.Duration
-	WriteLatency     time.Duration
+	ReadLatency      time.Duration // query time of a read served from the buffer pool
+	WriteLatency     time.Duration // query time of a write, before its log IO
+	IOLatency        time.Duration // one disk IO on an idle disk
+	MaxConnections   int
+	ConnectionTimeout time.Duration // how long a query waits for a free connection before it is rejected
+	IOPS             int
+	MemoryGB         float64
+	WorkingSetGB     float64 // hot part of the preloaded dataset that reads keep touching
 	ReplicationLag   time.Duration
-	Shards           []*Shard
+	Consistency      ConsistencyMode
+	ReplicaRouting   ReplicaRouting
+	MaxStaleness     time.Duration
+	NotFoundRate     float64 // share of keys reads find missing until they are written
+	Isolation        IsolationLevel
+	LockTimeout      time.Duration // how long a statement waits for a row lock before it aborts
+	CounterShards    int           // rows are split into this many sub-rows that writes spread over
+	Sharding         *ShardManager // nil until the database is sharded
 	Replicas         []*Database
 	IsPrimary        bool
+	MultiLeader      bool // linking another primary makes it a leader alongside this one
+	ConflictResolution ConflictResolution
+	MergeFunc        func(key string, local, remote []byte) []byte // combines concurrent writes under custom merge
+	Failover         FailoverPolicy
+	OnFailover       func(event FailoverEvent)
+	CDCLag           time.Duration // from commit until change feeds see the write
 	healthy          bool
 	metrics          *engine.Metrics
 	metricsMutex     sync.RWMutex
-	costPerHour      float64
+	vCPU             int
 	data             map[string][]byte
+	versions         map[string]int64 // bumped on every write, so caches can tell stale copies
+	shardKeys        map[string]string // the key each row was sharded by, where it differs from its path
+	lsn              int64            // log position of the latest committed write
+	term             int64            // election term, bumped by every promotion
 	dataMutex        sync.RWMutex
-}
+	locks            *lockManager
+
+	// Multi-leader state, guarded by dataMutex apart from leaders, which
+	// roleMutex guards
+	leaders          *leaderGroup
+	leaderValues     map[string]*leaderValue
+	conflicts        ConflictStats
+	shippers         map[*Database]*leaderShipper // guarded by shipMutex
+	shipMutex        sync.Mutex
+	unshipped        int64 // writes dropped with a peer's outbound queue full
+
+	// Replication state of a replica
+	pending          []logEntry // shipped but not yet applied, in log order
+	appliedLSN       int64
+	replMutex        sync.Mutex
+	replicaCounter   uint64
+	replicaReads     int64
+	replicaStale     int64
 
-type Shard struct {
-	ID        string
-	Database  *Database
-	HashRange [2]uint32
+	// Failover state. roleMutex guards IsPrimary, Replicas and healthy as well.
+	roleMutex        sync.RWMutex
+	promotedTo       *Database // the replica that took over when this primary failed
+	reconnectAt      time.Time // when clients have reconnected to promotedTo
+	rejoined         bool      // back as a replica of the new primary
+	downSince        time.Time
+	failovers        *failoverLog
+	changeFeeds      []ChangeConsumer
+
+	// Instance load
+	conns            chan struct{} // one slot per open connection
+	connMutex        sync.RWMutex
+	connWaiting      int64
+	connRejected     int64
+	nextIO           time.Time // when the disk is free for the next IO
+	ioWindowStart    time.Time
+	ioCount          int64
+	ioUtilization    float64
+	ioMutex          sync.Mutex
+	bufferHits       int64
+	bufferMisses     int64
 }
 
-func NewDatabase(id string, dbType DatabaseType, region string, capacity int64) *Database {
-	return &Database{
+func NewDatabase(id string, dbType DatabaseType, region string, instance *config.DatabaseInstanceType) *Database {
+	db := &Database{
 		ID:           id,
 		Type:         dbType,
 		Region:       region,
-		Capacity:     capacity,
-		ReadLatency:  10 * time.Millisecond,
-		WriteLatency: 15 * time.Millisecond,
+		Capacity:     int64(instance.StorageGB) * 1024 * 1024 * 1024,
+		ReadLatency:  2 * time.Millisecond,
+		WriteLatency: 5 * time.Millisecond,
+		IOLatency:    8 * time.Millisecond,
+		ConnectionTimeout: 50 * time.Millisecond,
+		WorkingSetGB: 2.0,
+		ReplicationLag: 50 * time.Millisecond,
+		Consistency:    ConsistencyEventual,
+		ReplicaRouting: ReplicaRoundRobin,
+		MaxStaleness:   100 * time.Millisecond,
+		NotFoundRate: 0.05,
+		Isolation:    IsolationReadCommitted,
+		LockTimeout:  time.Second,
+		CounterShards: 1,
+		locks:        newLockManager(),
 		IsPrimary:    true,
+		ConflictResolution: ConflictLastWriterWins,
+		leaderValues: make(map[string]*leaderValue),
+		Failover:     DefaultFailoverPolicy(),
+		failovers:    &failoverLog{},
+		CDCLag:       200 * time.Millisecond,
 		healthy:      true,
 		metrics:      &engine.Metrics{},
-		costPerHour:  0.05,
 		data:         make(map[string][]byte),
-		Shards:       make([]*Shard, 0),
+		versions:     make(map[string]int64),
+		shardKeys:    make(map[string]string),
 		Replicas:     make([]*Database, 0),
 	}
+	db.SetInstanceType(instance)
+	return db
 }
 
 func (db *Database) GetID() string {
@@ -70,14 +148,54 @@ func (db *Database) GetType() string {
 	return fmt.Sprintf("database-%s", db.Type)
 }
 
+func (db *Database) GetRegion() string {
+	return db.Region
+}
+
 func (db *Database) Process(req *engine.Request) (*engine.Response, error) {
 	start := time.Now()
 	
+	// A primary that failed over hands its clients to the replica that took
+	// over, once they have reconnected
+	if leader, reconnectAt := db.failedOverTo(); leader != nil {
+		if start.Before(reconnectAt) {
+			db.metricsMutex.Lock()
+			db.metrics.RequestCount++
+			db.metrics.FailureCount++
+			db.metricsMutex.Unlock()
+			err := fmt.Errorf("failover in progress, reconnecting to %s", leader.ID)
+			return &engine.Response{
+				RequestID: req.ID,
+				Success:   false,
+				Latency:   time.Since(start),
+				Error:     err,
+			}, err
+		}
+		resp, err := leader.Process(req)
+		if resp != nil {
+			resp.HopsTrace = append([]string{db.ID}, resp.HopsTrace...)
+		}
+		return resp, err
+	}
+	
+	// Reads are spread over the replicas, which keep serving them while the
+	// primary is down
+	if req.Type == engine.RequestTypeRead && db.Sharding == nil {
+		if replica := db.pickReplica(req); replica != nil {
+			return db.readFromReplica(replica, req)
+		}
+	}
+	
+	return db.serve(req, start)
+}
+
+// serve runs a request on this database itself
+func (db *Database) serve(req *engine.Request, start time.Time) (*engine.Response, error) {
 	db.metricsMutex.Lock()
 	db.metrics.RequestCount++
 	db.metricsMutex.Unlock()
 
-	if !db.healthy {
+	if !db.IsHealthy() {
 		db.metricsMutex.Lock()
 		db.metrics.FailureCount++
 		db.metricsMutex.Unlock()
@@ -89,19 +207,50 @@ func (db *Database) Process(req *engine.Request) (*engine.Response, error) {
 		}, fmt.Errorf("database is unhealthy")
 	}
 
-	if len(db.Shards) > 0 {
-		return db.processSharded(req)
+	if db.Sharding != nil {
+		return db.processSharded(req, start)
 	}
 
+	conns, err := db.acquireConn()
+	if err != nil {
+		db.metricsMutex.Lock()
+		db.metrics.FailureCount++
+		db.metricsMutex.Unlock()
+		return &engine.Response{
+			RequestID: req.ID,
+			Success:   false,
+			Latency:   time.Since(start),
+			Error:     err,
+		}, err
+	}
+	defer releaseConn(conns)
+
+	// Row locks are taken with the connection held, so statements queueing
+	// on a hot row also tie up the pool
+	unlock, err := db.lockRows(req)
+	if err != nil {
+		db.metricsMutex.Lock()
+		db.metrics.FailureCount++
+		db.metricsMutex.Unlock()
+		return &engine.Response{
+			RequestID: req.ID,
+			Success:   false,
+			Latency:   time.Since(start),
+			Error:     err,
+		}, err
+	}
+	defer unlock()
+
 	var latency time.Duration
-	var err error
+	notFound := false
+	var committed logEntry
 
 	switch req.Type {
 	case engine.RequestTypeRead:
-		latency = db.ReadLatency
-		err = db.read(req)
+		latency = db.readLatency() + db.counterReadCost(req)
+		notFound, err = db.read(req)
 	case engine.RequestTypeWrite:
-		if !db.IsPrimary {
+		if !db.isPrimary() {
 			return &engine.Response{
 				RequestID: req.ID,
 				Success:   false,
@@ -109,12 +258,16 @@ func (db *Database) Process(req *engine.Request) (*engine.Response, error) {
 				Error:     fmt.Errorf("cannot write to replica"),
 			}, fmt.Errorf("cannot write to replica")
 		}
-		latency = db.WriteLatency
-		err = db.write(req)
-		db.replicateToReplicas(req)
+		latency = db.writeLatency()
+		committed, err = db.write(req)
+		if err == nil {
+			db.replicateToReplicas(committed)
+			db.recordLeaderWrite(req)
+			db.publishChange(committed)
+		}
 	default:
-		latency = db.ReadLatency
-		err = db.read(req)
+		latency = db.readLatency()
+		notFound, err = db.read(req)
 	}
 
 	time.Sleep(latency)
@@ -131,80 +284,192 @@ func (db *Database) Process(req *engine.Request) (*engine.Response, error) {
 	db.metrics.AverageLatency = time.Duration(int64(db.metrics.TotalLatency) / db.metrics.RequestCount)
 	db.metricsMutex.Unlock()
 
-	return &engine.Response{
+	resp := &engine.Response{
 		RequestID: req.ID,
 		Success:   err == nil,
 		Latency:   totalLatency,
 		DataSize:  req.DataSize,
 		Error:     err,
 		HopsTrace: []string{db.ID},
-	}, err
+		Metadata:  map[string]interface{}{"version": db.GetVersion(req.Path)},
+	}
+	if notFound {
+		resp.DataSize = 0
+		resp.Metadata["not_found"] = true
+	}
+	if committed.lsn > 0 {
+		// The version this write committed, not one a later write bumped it to
+		resp.Metadata["version"] = committed.version
+		resp.Metadata["session_token"] = committed.lsn
+	}
+	return resp, err
+}
+
+// GetVersion returns how many writes the key has seen
+func (db *Database) GetVersion(key string) int64 {
+	if db.Sharding != nil {
+		// Paths that name no row route by user, so several shards can hold
+		// the key
+		latest := int64(0)
+		for _, shard := range db.Sharding.GetShards() {
+			if version := shard.Database.GetVersion(key); version > latest {
+				latest = version
+			}
+		}
+		return latest
+	}
+
+	db.dataMutex.RLock()
+	defer db.dataMutex.RUnlock()
+
+	return db.versions[key]
 }
 
-func (db *Database) read(req *engine.Request) error {
+// read reports whether the key is missing. The dataset is treated as loaded
+// before the simulation started, except for a NotFoundRate share of keys
+// that only exist once written.
+func (db *Database) read(req *engine.Request) (bool, error) {
 	db.dataMutex.RLock()
 	defer db.dataMutex.RUnlock()
 	
-	return nil
+	if _, written := db.data[req.Path]; written {
+		return false, nil
+	}
+	
+	h := fnv.New32a()
+	h.Write([]byte(req.Path))
+	return float64(h.Sum32()%1000) < db.NotFoundRate*1000, nil
 }
 
-func (db *Database) write(req *engine.Request) error {
+func (db *Database) write(req *engine.Request) (logEntry, error) {
 	db.dataMutex.Lock()
 	defer db.dataMutex.Unlock()
 	
 	if db.UsedCapacity+req.DataSize > db.Capacity {
-		return fmt.Errorf("database capacity exceeded")
+		return logEntry{}, fmt.Errorf("database capacity exceeded")
 	}
 	
 	db.data[req.Path] = make([]byte, req.DataSize)
+	db.versions[req.Path]++
 	db.UsedCapacity += req.DataSize
+	db.lsn++
+	sharded := shardKey(req)
+	db.setShardKey(req.Path, sharded)
 	
-	return nil
-}
-
-func (db *Database) replicateToReplicas(req *engine.Request) {
-	for _, replica := range db.Replicas {
-		go func(r *Database) {
-			time.Sleep(r.ReplicationLag)
-			r.write(req)
-		}(replica)
-	}
+	return logEntry{
+		term:      db.term,
+		lsn:       db.lsn,
+		key:       req.Path,
+		shardKey:  sharded,
+		size:      req.DataSize,
+		version:   db.versions[req.Path],
+		committed: time.Now(),
+	}, nil
 }
 
-func (db *Database) processSharded(req *engine.Request) (*engine.Response, error) {
-	shard := db.selectShard(req)
+func (db *Database) processSharded(req *engine.Request, start time.Time) (*engine.Response, error) {
+	key := shardKey(req)
+	shard := db.Sharding.route(key)
 	if shard == nil {
+		db.metricsMutex.Lock()
+		db.metrics.FailureCount++
+		db.metricsMutex.Unlock()
 		return &engine.Response{
 			RequestID: req.ID,
 			Success:   false,
 			Error:     fmt.Errorf("no shard found for request"),
 		}, fmt.Errorf("no shard found for request")
 	}
+	shard.record(key)
 	
-	return shard.Database.Process(req)
-}
-
-func (db *Database) selectShard(req *engine.Request) *Shard {
-	h := fnv.New32a()
-	h.Write([]byte(req.UserID))
-	hash := h.Sum32()
+	resp, err := shard.Database.Process(req)
+	if err == nil && req.Type == engine.RequestTypeWrite {
+		db.publishChange(logEntry{key: req.Path, size: req.DataSize, version: responseVersion(resp), committed: time.Now()})
+	}
 	
-	for _, shard := range db.Shards {
-		if hash >= shard.HashRange[0] && hash <= shard.HashRange[1] {
-			return shard
-		}
+	totalLatency := time.Since(start)
+	db.metricsMutex.Lock()
+	if err == nil {
+		db.metrics.SuccessCount++
+	} else {
+		db.metrics.FailureCount++
 	}
+	db.metrics.TotalLatency += totalLatency
+	db.metrics.AverageLatency = time.Duration(int64(db.metrics.TotalLatency) / db.metrics.RequestCount)
+	db.metricsMutex.Unlock()
 	
-	return nil
+	if resp != nil {
+		resp.HopsTrace = append([]string{db.ID}, resp.HopsTrace...)
+	}
+	return resp, err
+}
+
+// shardKey is the key requests are sharded by: the row the path names, so
+// every write to a row lands on the shard that holds its lock, otherwise the
+// user, or the path for requests without one
+func shardKey(req *engine.Request) string {
+	if row, ok := rowKey(req.Path); ok {
+		return row
+	}
+	if req.UserID != "" {
+		return req.UserID
+	}
+	return req.Path
+}
+
+// setShardKey remembers the key a row was sharded by. The caller holds
+// db.dataMutex.
+func (db *Database) setShardKey(key, sharded string) {
+	if sharded == "" || sharded == key {
+		delete(db.shardKeys, key)
+		return
+	}
+	db.shardKeys[key] = sharded
+}
+
+// rowShardKey is the key a stored row was sharded by. The caller holds
+// db.dataMutex.
+func (db *Database) rowShardKey(key string) string {
+	if sharded, exists := db.shardKeys[key]; exists {
+		return sharded
+	}
+	return key
 }
 
+// AddShard adds a shard with a fixed hash range, sharding the database by
+// hash if it is not sharded yet
 func (db *Database) AddShard(shard *Shard) {
-	db.Shards = append(db.Shards, shard)
+	if db.Sharding == nil {
+		db.Sharding = newShardManager(ShardingHash, db.ID, func(id string) *Database {
+			return NewDatabase(id, db.Type, db.Region, db.InstanceType)
+		})
+	}
+	db.Sharding.add(shard)
 }
 
 func (db *Database) AddReplica(replica *Database) {
+	replica.roleMutex.Lock()
 	replica.IsPrimary = false
+	replica.failovers = db.failovers
+	replica.roleMutex.Unlock()
+
+	db.roleMutex.Lock()
 	db.Replicas = append(db.Replicas, replica)
+	db.roleMutex.Unlock()
+}
+
+func (db *Database) GetReplicas() []*Database {
+	db.roleMutex.RLock()
+	defer db.roleMutex.RUnlock()
+
+	return append([]*Database(nil), db.Replicas...)
+}
+
+func (db *Database) isPrimary() bool {
+	db.roleMutex.RLock()
+	defer db.roleMutex.RUnlock()
+
+	return db.IsPrimary
 }
 
 func (db *Database) GetMetrics() *engine.Metrics {
@@ -212,23 +477,39 @@ func (db *Database) GetMetrics() *engine.Metrics {
 	defer db.metricsMutex.RUnlock()
 	
 	metricsCopy := *db.metrics
+	metricsCopy.WriteConflicts = db.conflicts.Conflicts
+	metricsCopy.LostUpdates = db.conflicts.LostUpdates
+	if db.Sharding != nil {
+		metricsCopy.ShardSplits, _ = db.Sharding.GetSplits()
+		metricsCopy.HotShards = int64(db.Sharding.HotShards())
+	}
 	if metricsCopy.RequestCount > 0 {
 		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
 	}
 	return &metricsCopy
 }
 
+// GetCost is the instance's hourly price plus its storage, which is billed
+// per GB-month. A sharded database costs what its shards do.
 func (db *Database) GetCost() float64 {
-	baseCost := db.costPerHour
-	capacityCost := float64(db.Capacity) / (1024 * 1024 * 1024) * 0.01
+	if db.Sharding != nil {
+		return db.Sharding.GetCost()
+	}
+	baseCost := db.InstanceType.CostPerHour
+	capacityCost := float64(db.Capacity) / (1024 * 1024 * 1024) * db.InstanceType.CostPerGBStorage / 730
 	
 	return baseCost + capacityCost
 }
 
 func (db *Database) IsHealthy() bool {
+	db.roleMutex.RLock()
+	defer db.roleMutex.RUnlock()
+
 	return db.healthy
 }
 
 func (db *Database) SetHealthy(healthy bool) {
+	db.roleMutex.Lock()
 	db.healthy = healthy
+	db.roleMutex.Unlock()
 }
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+// FailoverPolicy configures promoting a replica when the primary fails
+type FailoverPolicy struct {
+	Enabled bool
+	// DetectionDelay is how long the primary has to be down before the
+	// replicas elect a new one
+	DetectionDelay time.Duration
+	// ReconnectTime is how long clients take to reach the new primary after
+	// it is promoted
+	ReconnectTime time.Duration
+}
+
+func DefaultFailoverPolicy() FailoverPolicy {
+	return FailoverPolicy{
+		DetectionDelay: 3 * time.Second,
+		ReconnectTime:  2 * time.Second,
+	}
+}
+
+// FailoverEvent records one promotion. Duration runs from the primary
+// failing to clients reaching the new primary; LostWrites were committed on
+// the old primary but never reached the promoted replica.
+type FailoverEvent struct {
+	Time       time.Time
+	OldPrimary string
+	NewPrimary string
+	Duration   time.Duration
+	LostWrites int64
+}
+
+// failoverLog is shared by a primary and its replicas, so the history
+// survives the roles changing hands
+type failoverLog struct {
+	mu     sync.Mutex
+	events []FailoverEvent
+}
+
+func (l *failoverLog) record(event FailoverEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, event)
+}
+
+func (db *Database) GetFailovers() []FailoverEvent {
+	db.roleMutex.RLock()
+	failovers := db.failovers
+	db.roleMutex.RUnlock()
+
+	failovers.mu.Lock()
+	defer failovers.mu.Unlock()
+
+	return append([]FailoverEvent(nil), failovers.events...)
+}
+
+// failedOverTo returns the database now acting as primary in place of this
+// one, and when its clients finish reconnecting there, or nil if this
+// database never failed over
+func (db *Database) failedOverTo() (*Database, time.Time) {
+	db.roleMutex.RLock()
+	defer db.roleMutex.RUnlock()
+
+	return db.promotedTo, db.reconnectAt
+}
+
+// currentPrimary follows promotions from this database to the one that
+// took the writes last
+func (db *Database) currentPrimary() *Database {
+	current := db
+	for {
+		next, _ := current.failedOverTo()
+		if next == nil {
+			return current
+		}
+		current = next
+	}
+}
+
+// Tick drives resharding, catches replicas up on writes held up while their
+// primary was down, and watches a primary with replicas to promote one of
+// them once the primary has been down for the detection delay. A failed
+// primary that is back rejoins as a replica of whoever holds the writes now.
+func (db *Database) Tick(now time.Time) {
+	if db.Sharding != nil {
+		db.Sharding.Tick(now)
+	}
+
+	if leader, _ := db.failedOverTo(); leader != nil {
+		db.roleMutex.RLock()
+		rejoined := db.rejoined
+		db.roleMutex.RUnlock()
+
+		if !rejoined && db.IsHealthy() {
+			db.rejoin(db.currentPrimary())
+		}
+		return
+	}
+
+	if db.IsHealthy() && db.isPrimary() {
+		db.catchUpReplicas()
+	}
+	if db.IsHealthy() || !db.isPrimary() || !db.Failover.Enabled || len(db.GetReplicas()) == 0 {
+		db.downSince = time.Time{}
+		return
+	}
+	if db.downSince.IsZero() {
+		db.downSince = now
+	}
+	if now.Sub(db.downSince) >= db.Failover.DetectionDelay {
+		db.failOver(now)
+	}
+}
+
+// failOver elects the healthy replica that has applied the most of the log,
+// which loses the fewest writes, and promotes it
+func (db *Database) failOver(now time.Time) {
+	var elected *Database
+	others := make([]*Database, 0)
+	for _, replica := range db.GetReplicas() {
+		if !replica.IsHealthy() {
+			others = append(others, replica)
+			continue
+		}
+		if elected == nil || replica.GetAppliedLSN() > elected.GetAppliedLSN() {
+			if elected != nil {
+				others = append(others, elected)
+			}
+			elected = replica
+		} else {
+			others = append(others, replica)
+		}
+	}
+	if elected == nil {
+		// Nothing to promote; try again on the next tick
+		return
+	}
+
+	event := FailoverEvent{
+		Time:       now,
+		OldPrimary: db.ID,
+		NewPrimary: elected.ID,
+		Duration:   now.Sub(db.downSince) + db.Failover.ReconnectTime,
+		LostWrites: db.GetLSN() - elected.GetAppliedLSN(),
+	}
+
+	elected.promote(db, others)
+
+	db.roleMutex.Lock()
+	db.IsPrimary = false
+	db.Replicas = nil
+	db.promotedTo = elected
+	db.reconnectAt = time.Now().Add(db.Failover.ReconnectTime)
+	failovers := db.failovers
+	db.roleMutex.Unlock()
+	db.downSince = time.Time{}
+
+	failovers.record(event)
+	if db.OnFailover != nil {
+		db.OnFailover(event)
+	}
+}
+
+// promote makes a replica the primary in a new term. It keeps the writes it
+// had applied; the rest of the old primary's log is dropped wherever it
+// arrives, and the other replicas resync from it.
+func (db *Database) promote(old *Database, replicas []*Database) {
+	oldTerm := old.currentTerm()
+
+	db.replMutex.Lock()
+	applied := db.appliedLSN
+	db.pending = nil
+	db.replMutex.Unlock()
+
+	db.dataMutex.Lock()
+	db.term = oldTerm + 1
+	db.lsn = applied
+	db.dataMutex.Unlock()
+
+	feeds := old.GetChangeFeeds()
+	db.roleMutex.Lock()
+	db.IsPrimary = true
+	db.Replicas = replicas
+	db.promotedTo = nil
+	db.rejoined = false
+	db.Consistency = old.Consistency
+	db.ReplicaRouting = old.ReplicaRouting
+	db.MaxStaleness = old.MaxStaleness
+	db.Failover = old.Failover
+	db.OnFailover = old.OnFailover
+	db.CDCLag = old.CDCLag
+	db.changeFeeds = feeds
+	db.roleMutex.Unlock()
+
+	for _, replica := range replicas {
+		replica.resyncFrom(db)
+	}
+	db.replaceLeader(old)
+}
+
+// rejoin brings a failed primary back as a replica. Its writes that never
+// reached the new primary are discarded.
+func (db *Database) rejoin(leader *Database) {
+	db.resyncFrom(leader)
+
+	db.roleMutex.Lock()
+	db.rejoined = true
+	db.roleMutex.Unlock()
+
+	leader.AddReplica(db)
+}
+
+// resyncFrom replaces a replica's data with a copy of the primary's, as
+// after a rewind or a fresh base backup
+func (db *Database) resyncFrom(leader *Database) {
+	leader.dataMutex.RLock()
+	data := make(map[string][]byte, len(leader.data))
+	for key, value := range leader.data {
+		data[key] = value
+	}
+	versions := make(map[string]int64, len(leader.versions))
+	for key, version := range leader.versions {
+		versions[key] = version
+	}
+	shardKeys := make(map[string]string, len(leader.shardKeys))
+	for key, sharded := range leader.shardKeys {
+		shardKeys[key] = sharded
+	}
+	used := leader.UsedCapacity
+	lsn := leader.lsn
+	term := leader.term
+	leader.dataMutex.RUnlock()
+
+	db.dataMutex.Lock()
+	db.data = data
+	db.versions = versions
+	db.shardKeys = shardKeys
+	db.UsedCapacity = used
+	db.term = term
+	db.dataMutex.Unlock()
+
+	db.replMutex.Lock()
+	db.pending = nil
+	db.appliedLSN = lsn
+	db.replMutex.Unlock()
+}
+
+func (db *Database) currentTerm() int64 {
+	db.dataMutex.RLock()
+	defer db.dataMutex.RUnlock()
+
+	return db.term
+}
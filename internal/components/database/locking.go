@@ -0,0 +1,380 @@
+package database
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// IsolationLevel decides which statements of a SQL database take row locks
+// and what happens to a write that had to wait for another one. The
+// semantics follow PostgreSQL.
+type IsolationLevel string
+
+const (
+	// Writes lock their row; a write that waited goes ahead afterwards
+	IsolationReadCommitted IsolationLevel = "read-committed"
+	// As read committed, but a write that waited for another write to the
+	// same row aborts with a serialization failure
+	IsolationRepeatableRead IsolationLevel = "repeatable-read"
+	// As repeatable read, and reads take shared locks that block writers
+	IsolationSerializable IsolationLevel = "serializable"
+)
+
+func GetIsolationLevels() []IsolationLevel {
+	return []IsolationLevel{IsolationReadCommitted, IsolationRepeatableRead, IsolationSerializable}
+}
+
+// RowsMetadata names extra rows a write locks, in the order it locks them,
+// as a []string in Request.Metadata. Transactions locking rows in different
+// orders can deadlock.
+const RowsMetadata = "rows"
+
+type lockMode int
+
+const (
+	lockShared lockMode = iota
+	lockExclusive
+)
+
+type lockRequest struct {
+	tx      uint64
+	mode    lockMode
+	granted chan struct{}
+}
+
+type rowLock struct {
+	holders map[uint64]lockMode
+	queue   []*lockRequest
+}
+
+// LockStats counts how writes contended for rows
+type LockStats struct {
+	Waits                 int64
+	Timeouts              int64
+	Deadlocks             int64
+	SerializationFailures int64
+	AverageWait           time.Duration
+	HottestRow            string // the row most lock waits were for
+	HottestRowWaits       int64
+}
+
+// lockManager hands out row locks in arrival order, and refuses a wait that
+// would close a cycle of transactions waiting on each other
+type lockManager struct {
+	rows       map[string]*rowLock
+	waitingFor map[uint64]string
+	rowWaits   map[string]int64
+	nextTx     uint64
+	stats      LockStats
+	totalWait  time.Duration
+	mu         sync.Mutex
+}
+
+func newLockManager() *lockManager {
+	return &lockManager{
+		rows:       make(map[string]*rowLock),
+		waitingFor: make(map[uint64]string),
+		rowWaits:   make(map[string]int64),
+	}
+}
+
+func (lm *lockManager) begin() uint64 {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.nextTx++
+	return lm.nextTx
+}
+
+func (row *rowLock) compatible(mode lockMode) bool {
+	if len(row.holders) == 0 {
+		return true
+	}
+	if mode == lockExclusive {
+		return false
+	}
+	for _, held := range row.holders {
+		if held == lockExclusive {
+			return false
+		}
+	}
+	return true
+}
+
+// acquire locks a row for tx, waiting behind earlier requests for up to
+// timeout. It reports whether it had to wait for a writer.
+func (lm *lockManager) acquire(tx uint64, key string, mode lockMode, timeout time.Duration) (bool, error) {
+	lm.mu.Lock()
+	row, exists := lm.rows[key]
+	if !exists {
+		row = &rowLock{holders: make(map[uint64]lockMode)}
+		lm.rows[key] = row
+	}
+	if _, held := row.holders[tx]; held {
+		lm.mu.Unlock()
+		return false, nil
+	}
+	if len(row.queue) == 0 && row.compatible(mode) {
+		row.holders[tx] = mode
+		lm.mu.Unlock()
+		return false, nil
+	}
+
+	blockedByWriter := false
+	for _, held := range row.holders {
+		if held == lockExclusive {
+			blockedByWriter = true
+		}
+	}
+	if lm.waitsOn(row, tx, make(map[uint64]bool)) {
+		lm.stats.Deadlocks++
+		lm.mu.Unlock()
+		return false, fmt.Errorf("deadlock detected on %s", key)
+	}
+
+	request := &lockRequest{tx: tx, mode: mode, granted: make(chan struct{})}
+	row.queue = append(row.queue, request)
+	lm.waitingFor[tx] = key
+	lm.stats.Waits++
+	lm.rowWaits[key]++
+	lm.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-request.granted:
+		lm.recordWait(time.Since(start))
+		return blockedByWriter, nil
+	case <-timer.C:
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	select {
+	case <-request.granted:
+		// Granted while the timer fired
+		lm.totalWait += time.Since(start)
+		return blockedByWriter, nil
+	default:
+	}
+	for i, queued := range row.queue {
+		if queued == request {
+			row.queue = append(row.queue[:i], row.queue[i+1:]...)
+			break
+		}
+	}
+	delete(lm.waitingFor, tx)
+	lm.grant(key, row)
+	lm.stats.Timeouts++
+	lm.totalWait += time.Since(start)
+	return false, fmt.Errorf("lock wait timeout on %s", key)
+}
+
+func (lm *lockManager) recordWait(wait time.Duration) {
+	lm.mu.Lock()
+	lm.totalWait += wait
+	lm.mu.Unlock()
+}
+
+// waitsOn reports whether a holder of row is, directly or through other
+// waiting transactions, waiting for tx. The caller holds lm.mu.
+func (lm *lockManager) waitsOn(row *rowLock, tx uint64, visited map[uint64]bool) bool {
+	for holder := range row.holders {
+		if holder == tx {
+			return true
+		}
+		if visited[holder] {
+			continue
+		}
+		visited[holder] = true
+		if key, waiting := lm.waitingFor[holder]; waiting && lm.waitsOn(lm.rows[key], tx, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+func (lm *lockManager) release(tx uint64, key string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	row, exists := lm.rows[key]
+	if !exists {
+		return
+	}
+	delete(row.holders, tx)
+	lm.grant(key, row)
+}
+
+// grant hands the row to the requests at the front of its queue that can
+// hold it together. The caller holds lm.mu.
+func (lm *lockManager) grant(key string, row *rowLock) {
+	for len(row.queue) > 0 && row.compatible(row.queue[0].mode) {
+		request := row.queue[0]
+		row.queue = row.queue[1:]
+		row.holders[request.tx] = request.mode
+		delete(lm.waitingFor, request.tx)
+		close(request.granted)
+	}
+	if len(row.holders) == 0 && len(row.queue) == 0 {
+		delete(lm.rows, key)
+	}
+}
+
+func (lm *lockManager) recordSerializationFailure() {
+	lm.mu.Lock()
+	lm.stats.SerializationFailures++
+	lm.mu.Unlock()
+}
+
+func (lm *lockManager) getStats() LockStats {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	stats := lm.stats
+	if stats.Waits > 0 {
+		stats.AverageWait = lm.totalWait / time.Duration(stats.Waits)
+	}
+	for key, waits := range lm.rowWaits {
+		if waits > stats.HottestRowWaits {
+			stats.HottestRow = key
+			stats.HottestRowWaits = waits
+		}
+	}
+	return stats
+}
+
+// rowKey names the row a path updates. Paths without an id segment, like
+// "/api/orders", insert a new row and contend with nothing.
+func rowKey(path string) (string, bool) {
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" && strings.IndexFunc(segment, unicode.IsDigit) >= 0 {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// lockRows takes the row locks a request needs under the isolation level,
+// and returns the function that releases them when the statement is done
+func (db *Database) lockRows(req *engine.Request) (func(), error) {
+	if db.Type != DatabaseTypeSQL {
+		return func() {}, nil
+	}
+
+	mode := lockExclusive
+	keys := make([]string, 0, 1)
+	switch {
+	case req.Type == engine.RequestTypeWrite:
+		if key, ok := rowKey(req.Path); ok {
+			// A write to a sharded counter updates one of its sub-rows
+			if db.CounterShards > 1 {
+				key = fmt.Sprintf("%s#%d", key, rand.Intn(db.CounterShards))
+			}
+			keys = append(keys, key)
+		}
+		if rows, ok := req.Metadata[RowsMetadata].([]string); ok {
+			keys = append(keys, rows...)
+		}
+	case db.Isolation == IsolationSerializable:
+		mode = lockShared
+		if key, ok := rowKey(req.Path); ok {
+			if db.CounterShards > 1 {
+				// Reading a sharded counter sums all of its sub-rows
+				for i := 0; i < db.CounterShards; i++ {
+					keys = append(keys, fmt.Sprintf("%s#%d", key, i))
+				}
+			} else {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return func() {}, nil
+	}
+
+	tx := db.locks.begin()
+	held := make([]string, 0, len(keys))
+	release := func() {
+		for _, key := range held {
+			db.locks.release(tx, key)
+		}
+	}
+
+	for _, key := range keys {
+		waitedForWriter, err := db.locks.acquire(tx, key, mode, db.LockTimeout)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		held = append(held, key)
+
+		if waitedForWriter && mode == lockExclusive && db.Isolation != IsolationReadCommitted {
+			db.locks.recordSerializationFailure()
+			release()
+			return nil, fmt.Errorf("could not serialize access to %s due to concurrent update", key)
+		}
+	}
+	return release, nil
+}
+
+// counterReadCost is the extra query time of reading a row that is split
+// into sharded counters, which sums every sub-row
+func (db *Database) counterReadCost(req *engine.Request) time.Duration {
+	if db.Type != DatabaseTypeSQL || db.CounterShards <= 1 {
+		return 0
+	}
+	if _, ok := rowKey(req.Path); !ok {
+		return 0
+	}
+	return time.Duration(db.CounterShards-1) * db.ReadLatency
+}
+
+// SetLockSettings changes the isolation level, lock timeout and counter
+// shards, on every shard too
+func (db *Database) SetLockSettings(isolation IsolationLevel, lockTimeout time.Duration, counterShards int) {
+	db.Isolation = isolation
+	db.LockTimeout = lockTimeout
+	db.CounterShards = counterShards
+	if db.Sharding != nil {
+		for _, shard := range db.Sharding.GetShards() {
+			shard.Database.SetLockSettings(isolation, lockTimeout, counterShards)
+		}
+	}
+}
+
+// GetLockStats reports lock contention, summed over the shards of a sharded
+// database
+func (db *Database) GetLockStats() LockStats {
+	if db.Sharding == nil {
+		return db.locks.getStats()
+	}
+
+	total := LockStats{}
+	var wait time.Duration
+	for _, shard := range db.Sharding.GetShards() {
+		stats := shard.Database.GetLockStats()
+		total.Waits += stats.Waits
+		total.Timeouts += stats.Timeouts
+		total.Deadlocks += stats.Deadlocks
+		total.SerializationFailures += stats.SerializationFailures
+		wait += stats.AverageWait * time.Duration(stats.Waits)
+		if stats.HottestRowWaits > total.HottestRowWaits {
+			total.HottestRow = stats.HottestRow
+			total.HottestRowWaits = stats.HottestRowWaits
+		}
+	}
+	if total.Waits > 0 {
+		total.AverageWait = wait / time.Duration(total.Waits)
+	}
+	return total
+}
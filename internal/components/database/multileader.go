@@ -0,0 +1,491 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// ConflictResolution decides what a leader keeps when another leader's
+// write to a key is concurrent with its own
+type ConflictResolution string
+
+const (
+	// The write with the later timestamp wins and the other one is lost
+	ConflictLastWriterWins ConflictResolution = "last-writer-wins"
+	// MergeFunc combines both values
+	ConflictCustomMerge ConflictResolution = "custom-merge"
+	// Values are counters or sets that merge without losing updates
+	ConflictCRDT ConflictResolution = "crdt"
+)
+
+func GetConflictResolutions() []ConflictResolution {
+	return []ConflictResolution{ConflictLastWriterWins, ConflictCustomMerge, ConflictCRDT}
+}
+
+// CRDTElementMetadata names the element a write adds to a set, in
+// Request.Metadata. Under CRDT resolution writes without it increment a
+// counter.
+const CRDTElementMetadata = "crdt_element"
+
+// leaderQueueLimit is how many writes wait to ship to one peer before
+// further writes to it are dropped
+const leaderQueueLimit = 1024
+
+// writeCounter numbers writes across every leader, so a conflict between
+// two of them is counted once however many leaders see it
+var writeCounter int64
+
+// leaderValue is a leader's state of one key
+type leaderValue struct {
+	clock     VectorClock // writes from each leader the value reflects
+	timestamp int64
+	writeID   int64 // the latest write the value came from
+	size      int64
+	counter   map[string]int64 // increments made on each leader
+	set       map[string]bool
+}
+
+func (v *leaderValue) copy() *leaderValue {
+	c := &leaderValue{
+		clock:     v.clock.merge(nil),
+		timestamp: v.timestamp,
+		writeID:   v.writeID,
+		size:      v.size,
+		counter:   make(map[string]int64, len(v.counter)),
+		set:       make(map[string]bool, len(v.set)),
+	}
+	for leader, count := range v.counter {
+		c.counter[leader] = count
+	}
+	for element := range v.set {
+		c.set[element] = true
+	}
+	return c
+}
+
+// leaderGroup is the primaries that all take writes and replicate them to
+// each other
+type leaderGroup struct {
+	mu      sync.Mutex
+	members []*Database
+	counted map[string]bool // conflicts already counted, by the writes involved
+}
+
+// ConflictStats counts the conflicts one leader resolved
+type ConflictStats struct {
+	Conflicts   int64
+	LostUpdates int64 // writes discarded by last-writer-wins
+	Merged      int64 // conflicts resolved by merging both writes
+}
+
+// AddLeader makes peer another leader alongside this database. Both take
+// writes and replicate them to each other asynchronously.
+func (db *Database) AddLeader(peer *Database) {
+	db.roleMutex.Lock()
+	if db.leaders == nil {
+		db.leaders = &leaderGroup{members: []*Database{db}, counted: make(map[string]bool)}
+	}
+	group := db.leaders
+	resolution := db.ConflictResolution
+	db.MultiLeader = true
+	db.roleMutex.Unlock()
+
+	peer.roleMutex.Lock()
+	previous := peer.leaders
+	peer.roleMutex.Unlock()
+
+	joining := []*Database{peer}
+	if previous != nil && previous != group {
+		previous.mu.Lock()
+		joining = previous.members
+		previous.mu.Unlock()
+	}
+
+	group.mu.Lock()
+	for _, member := range joining {
+		if !containsDatabase(group.members, member) {
+			group.members = append(group.members, member)
+		}
+	}
+	group.mu.Unlock()
+
+	for _, member := range joining {
+		member.roleMutex.Lock()
+		member.leaders = group
+		member.MultiLeader = true
+		member.ConflictResolution = resolution
+		member.roleMutex.Unlock()
+	}
+}
+
+func containsDatabase(dbs []*Database, db *Database) bool {
+	for _, member := range dbs {
+		if member == db {
+			return true
+		}
+	}
+	return false
+}
+
+// GetLeaders returns the other leaders this database replicates writes to
+func (db *Database) GetLeaders() []*Database {
+	db.roleMutex.RLock()
+	group := db.leaders
+	db.roleMutex.RUnlock()
+	if group == nil {
+		return nil
+	}
+
+	group.mu.Lock()
+	defer group.mu.Unlock()
+
+	peers := make([]*Database, 0, len(group.members))
+	for _, member := range group.members {
+		if member != db {
+			peers = append(peers, member)
+		}
+	}
+	return peers
+}
+
+// SetConflictResolution changes how every leader of the group resolves
+// conflicts
+func (db *Database) SetConflictResolution(resolution ConflictResolution) {
+	for _, member := range append(db.GetLeaders(), db) {
+		member.roleMutex.Lock()
+		member.ConflictResolution = resolution
+		member.roleMutex.Unlock()
+	}
+}
+
+func (db *Database) conflictResolution() ConflictResolution {
+	db.roleMutex.RLock()
+	defer db.roleMutex.RUnlock()
+
+	return db.ConflictResolution
+}
+
+// replaceLeader hands a failed leader's place in its group to the replica
+// promoted in its stead
+func (db *Database) replaceLeader(old *Database) {
+	old.roleMutex.RLock()
+	group := old.leaders
+	resolution := old.ConflictResolution
+	old.roleMutex.RUnlock()
+	if group == nil {
+		return
+	}
+
+	group.mu.Lock()
+	for i, member := range group.members {
+		if member == old {
+			group.members[i] = db
+		}
+	}
+	group.mu.Unlock()
+
+	db.roleMutex.Lock()
+	db.leaders = group
+	db.MultiLeader = true
+	db.ConflictResolution = resolution
+	db.roleMutex.Unlock()
+}
+
+// recordLeaderWrite updates the key's leader state for a write taken here
+// and ships it to the other leaders
+func (db *Database) recordLeaderWrite(req *engine.Request) {
+	peers := db.GetLeaders()
+	if len(peers) == 0 {
+		return
+	}
+
+	db.dataMutex.Lock()
+	value, exists := db.leaderValues[req.Path]
+	if !exists {
+		value = &leaderValue{clock: VectorClock{}, counter: make(map[string]int64), set: make(map[string]bool)}
+		db.leaderValues[req.Path] = value
+	}
+	value.clock[db.ID]++
+	value.timestamp = time.Now().UnixNano()
+	value.writeID = atomic.AddInt64(&writeCounter, 1)
+	value.size = req.DataSize
+	if element, ok := req.Metadata[CRDTElementMetadata].(string); ok {
+		value.set[element] = true
+	} else {
+		value.counter[db.ID]++
+	}
+	shipped := shippedWrite{key: req.Path, value: value.copy(), sent: time.Now()}
+	db.dataMutex.Unlock()
+
+	for _, peer := range peers {
+		db.ship(peer, shipped)
+	}
+}
+
+// shippedWrite is a leader's state of a key on its way to a peer
+type shippedWrite struct {
+	key   string
+	value *leaderValue
+	sent  time.Time
+}
+
+// leaderShipper ships one leader's writes to one peer in the order they
+// were taken, holding them while the peer is down
+type leaderShipper struct {
+	queue chan shippedWrite
+	stop  chan struct{}
+}
+
+// ship queues a write for a peer, starting its shipper if it has none. A
+// write that finds the queue full is dropped and counted.
+func (db *Database) ship(peer *Database, write shippedWrite) {
+	db.shipMutex.Lock()
+	defer db.shipMutex.Unlock()
+
+	shipper, exists := db.shippers[peer]
+	if !exists {
+		if db.shippers == nil {
+			db.shippers = make(map[*Database]*leaderShipper)
+		}
+		shipper = &leaderShipper{queue: make(chan shippedWrite, leaderQueueLimit), stop: make(chan struct{})}
+		db.shippers[peer] = shipper
+		go db.runShipper(peer, shipper)
+	}
+
+	select {
+	case shipper.queue <- write:
+	default:
+		atomic.AddInt64(&db.unshipped, 1)
+	}
+}
+
+// runShipper delivers a peer's queued writes after the network latency to
+// it. A leader that is down gets them once it is back, or once one of its
+// replicas has been promoted in its place. The shipper exits once its queue
+// is empty or the simulation stops.
+func (db *Database) runShipper(peer *Database, shipper *leaderShipper) {
+	latency := config.GetNetworkLatency(regionID(db.Region), regionID(peer.Region))
+	for {
+		db.shipMutex.Lock()
+		if len(shipper.queue) == 0 {
+			if db.shippers[peer] == shipper {
+				delete(db.shippers, peer)
+			}
+			db.shipMutex.Unlock()
+			return
+		}
+		db.shipMutex.Unlock()
+
+		write := <-shipper.queue
+		if !waitOrStop(time.Until(write.sent.Add(latency)), shipper.stop) {
+			return
+		}
+		for {
+			target := peer.currentPrimary()
+			if target.IsHealthy() {
+				target.applyLeaderWrite(db, write.key, write.value)
+				break
+			}
+			if !waitOrStop(replicationRetry, shipper.stop) {
+				return
+			}
+		}
+	}
+}
+
+// waitOrStop waits for d, and reports false if stop closes first
+func waitOrStop(d time.Duration, stop <-chan struct{}) bool {
+	if d <= 0 {
+		select {
+		case <-stop:
+			return false
+		default:
+			return true
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Stop ends the shippers with the writes they still hold, which are lost
+// like any write a leader never got to replicate
+func (db *Database) Stop() {
+	db.shipMutex.Lock()
+	defer db.shipMutex.Unlock()
+
+	for _, shipper := range db.shippers {
+		close(shipper.stop)
+	}
+	db.shippers = nil
+}
+
+// GetUnshippedWrites returns how many writes were dropped because a peer's
+// outbound queue was full
+func (db *Database) GetUnshippedWrites() int64 {
+	return atomic.LoadInt64(&db.unshipped)
+}
+
+// applyLeaderWrite takes in another leader's state of a key. State that
+// descends from the local one replaces it, older state is dropped, and
+// concurrent state is a conflict for the resolution to settle.
+func (db *Database) applyLeaderWrite(from *Database, key string, incoming *leaderValue) {
+	resolution := db.conflictResolution()
+
+	db.dataMutex.Lock()
+	local, exists := db.leaderValues[key]
+	var result *leaderValue
+	conflict := false
+	lost := false
+	switch {
+	case !exists || incoming.clock.descends(local.clock):
+		result = incoming.copy()
+	case local.clock.descends(incoming.clock):
+		db.dataMutex.Unlock()
+		return
+	default:
+		conflict = true
+		result, lost = resolveConflict(resolution, db.MergeFunc, key, local, incoming)
+	}
+	db.leaderValues[key] = result
+
+	db.UsedCapacity += result.size - int64(len(db.data[key]))
+	db.data[key] = make([]byte, result.size)
+	db.versions[key]++
+	db.lsn++
+	entry := logEntry{
+		term:      db.term,
+		lsn:       db.lsn,
+		key:       key,
+		size:      result.size,
+		version:   db.versions[key],
+		committed: time.Now(),
+	}
+	db.dataMutex.Unlock()
+
+	if conflict {
+		db.recordConflict(local, incoming, lost, resolution)
+	}
+	db.replicateToReplicas(entry)
+	db.publishChange(entry)
+}
+
+// resolveConflict settles two concurrent states of a key. It reports
+// whether a write was lost doing so.
+func resolveConflict(resolution ConflictResolution, merge func(key string, local, remote []byte) []byte, key string, local, incoming *leaderValue) (*leaderValue, bool) {
+	result := local.copy()
+	result.clock = local.clock.merge(incoming.clock)
+
+	switch resolution {
+	case ConflictCRDT:
+		for leader, count := range incoming.counter {
+			if count > result.counter[leader] {
+				result.counter[leader] = count
+			}
+		}
+		for element := range incoming.set {
+			result.set[element] = true
+		}
+		if incoming.writeID > result.writeID {
+			result.writeID, result.timestamp, result.size = incoming.writeID, incoming.timestamp, incoming.size
+		}
+		return result, false
+	case ConflictCustomMerge:
+		if merge != nil {
+			result.size = int64(len(merge(key, make([]byte, local.size), make([]byte, incoming.size))))
+		} else if incoming.size > result.size {
+			result.size = incoming.size
+		}
+		if incoming.writeID > result.writeID {
+			result.writeID, result.timestamp = incoming.writeID, incoming.timestamp
+		}
+		return result, false
+	default:
+		if incoming.timestamp > local.timestamp || (incoming.timestamp == local.timestamp && incoming.writeID > local.writeID) {
+			result.writeID, result.timestamp, result.size = incoming.writeID, incoming.timestamp, incoming.size
+		}
+		return result, true
+	}
+}
+
+// recordConflict counts a conflict on the first leader to see it
+func (db *Database) recordConflict(local, incoming *leaderValue, lost bool, resolution ConflictResolution) {
+	db.roleMutex.RLock()
+	group := db.leaders
+	db.roleMutex.RUnlock()
+	if group == nil {
+		return
+	}
+
+	first, second := local.writeID, incoming.writeID
+	if first > second {
+		first, second = second, first
+	}
+	pair := fmt.Sprintf("%d-%d", first, second)
+
+	group.mu.Lock()
+	counted := group.counted[pair]
+	group.counted[pair] = true
+	group.mu.Unlock()
+	if counted {
+		return
+	}
+
+	db.metricsMutex.Lock()
+	defer db.metricsMutex.Unlock()
+
+	db.conflicts.Conflicts++
+	switch {
+	case lost:
+		db.conflicts.LostUpdates++
+	case resolution != ConflictLastWriterWins:
+		db.conflicts.Merged++
+	}
+}
+
+// GetConflictStats returns the conflicts this leader resolved
+func (db *Database) GetConflictStats() ConflictStats {
+	db.metricsMutex.RLock()
+	defer db.metricsMutex.RUnlock()
+
+	return db.conflicts
+}
+
+// GetCRDTValue returns a key's counter, summed over the leaders, and the
+// elements of its set
+func (db *Database) GetCRDTValue(key string) (int64, []string) {
+	db.dataMutex.RLock()
+	defer db.dataMutex.RUnlock()
+
+	value, exists := db.leaderValues[key]
+	if !exists {
+		return 0, nil
+	}
+	total := int64(0)
+	for _, count := range value.counter {
+		total += count
+	}
+	elements := make([]string, 0, len(value.set))
+	for element := range value.set {
+		elements = append(elements, element)
+	}
+	sort.Strings(elements)
+	return total, elements
+}
+
+// regionID maps a region's short name or ID to its ID
+func regionID(region string) string {
+	return config.GetRegionByName(config.GetRegionName(region)).ID
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// Writes for a leader that is down wait in one queue for it, and reach it
+// once it is back
+func TestShippingToDownLeader(t *testing.T) {
+	instance := config.GetDatabaseInstanceType("db.m5.large")
+	local := NewDatabase("local", DatabaseTypeSQL, "us-east-1", instance)
+	peer := NewDatabase("peer", DatabaseTypeSQL, "us-east-1", instance)
+	local.AddLeader(peer)
+	peer.SetHealthy(false)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		local.Process(&engine.Request{ID: fmt.Sprintf("w-%d", i), Type: engine.RequestTypeWrite, Path: "/api/items/1", DataSize: 64})
+	}
+	if grown := runtime.NumGoroutine() - before; grown > 1 {
+		t.Errorf("%d goroutines waiting on the peer, want at most 1", grown)
+	}
+
+	peer.SetHealthy(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for peer.GetVersion("/api/items/1") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("peer never got the writes after recovering")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Stopping a leader ends the shipper still waiting on a peer that is down
+func TestStopEndsShipping(t *testing.T) {
+	instance := config.GetDatabaseInstanceType("db.m5.large")
+	local := NewDatabase("local", DatabaseTypeSQL, "us-east-1", instance)
+	peer := NewDatabase("peer", DatabaseTypeSQL, "us-east-1", instance)
+	local.AddLeader(peer)
+	peer.SetHealthy(false)
+
+	before := runtime.NumGoroutine()
+	local.Process(&engine.Request{ID: "w", Type: engine.RequestTypeWrite, Path: "/api/items/1", DataSize: 64})
+	local.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left after stopping", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
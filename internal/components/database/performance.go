@@ -0,0 +1,243 @@
+package database
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+)
+
+const (
+	gib = 1024 * 1024 * 1024
+	// Share of memory the engine gives its buffer pool, as with InnoDB's
+	// usual innodb_buffer_pool_size
+	bufferPoolShare = 0.75
+	// Queries one vCPU runs side by side before they slow each other down
+	queriesPerVCPU = 4
+)
+
+// PerformanceStats is the load on the instance behind a database
+type PerformanceStats struct {
+	ActiveConnections   int
+	MaxConnections      int
+	WaitingConnections  int64
+	RejectedConnections int64
+	IOPSUtilization     float64 // IOs issued over the last second against the IOPS limit
+	BufferPoolHitRatio  float64 // expected from working set versus memory
+	BufferPoolHits      int64
+	BufferPoolMisses    int64
+}
+
+// SetInstanceType sizes the database from an instance type: its connection
+// limit, IOPS, memory and price
+func (db *Database) SetInstanceType(instance *config.DatabaseInstanceType) {
+	db.connMutex.Lock()
+	db.InstanceType = instance
+	db.MaxConnections = instance.MaxConnections
+	db.MemoryGB = instance.MemoryGB
+	db.vCPU = instance.GetVCPU()
+	// Queries holding a connection of the old pool give it back there
+	db.conns = make(chan struct{}, instance.MaxConnections)
+	db.connMutex.Unlock()
+
+	db.ioMutex.Lock()
+	db.IOPS = instance.IOPS
+	db.ioMutex.Unlock()
+}
+
+// SetConnectionTimeout changes how long queries wait for a connection, on
+// every shard too
+func (db *Database) SetConnectionTimeout(timeout time.Duration) {
+	db.connMutex.Lock()
+	db.ConnectionTimeout = timeout
+	db.connMutex.Unlock()
+
+	if db.Sharding != nil {
+		for _, shard := range db.Sharding.GetShards() {
+			shard.Database.SetConnectionTimeout(timeout)
+		}
+	}
+}
+
+func (db *Database) connectionTimeout() time.Duration {
+	db.connMutex.RLock()
+	defer db.connMutex.RUnlock()
+
+	return db.ConnectionTimeout
+}
+
+// acquireConn takes a connection, waiting up to ConnectionTimeout for one to
+// be released. The returned pool is where the connection goes back.
+func (db *Database) acquireConn() (chan struct{}, error) {
+	db.connMutex.RLock()
+	conns := db.conns
+	timeout := db.ConnectionTimeout
+	db.connMutex.RUnlock()
+
+	select {
+	case conns <- struct{}{}:
+		return conns, nil
+	default:
+	}
+
+	if timeout > 0 {
+		atomic.AddInt64(&db.connWaiting, 1)
+		timer := time.NewTimer(timeout)
+		select {
+		case conns <- struct{}{}:
+			timer.Stop()
+			atomic.AddInt64(&db.connWaiting, -1)
+			return conns, nil
+		case <-timer.C:
+			atomic.AddInt64(&db.connWaiting, -1)
+		}
+	}
+
+	atomic.AddInt64(&db.connRejected, 1)
+	return nil, fmt.Errorf("too many connections (max %d)", cap(conns))
+}
+
+func releaseConn(conns chan struct{}) {
+	<-conns
+}
+
+// queryTime is the CPU time of a query, stretched once the running queries
+// outnumber what the vCPUs run side by side
+func (db *Database) queryTime(base time.Duration) time.Duration {
+	db.connMutex.RLock()
+	active := len(db.conns)
+	slots := db.vCPU * queriesPerVCPU
+	db.connMutex.RUnlock()
+
+	if slots <= 0 || active <= slots {
+		return base
+	}
+	return time.Duration(float64(base) * float64(active) / float64(slots))
+}
+
+// diskIO issues one IO and returns how long it takes. The disk serves IOPS
+// a second, so once IOs arrive faster than that they queue behind each
+// other and the wait grows for as long as the overload lasts.
+func (db *Database) diskIO() time.Duration {
+	db.ioMutex.Lock()
+	defer db.ioMutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(db.ioWindowStart) >= time.Second {
+		if !db.ioWindowStart.IsZero() && db.IOPS > 0 {
+			db.ioUtilization = float64(db.ioCount) / now.Sub(db.ioWindowStart).Seconds() / float64(db.IOPS)
+		}
+		db.ioWindowStart = now
+		db.ioCount = 0
+	}
+	db.ioCount++
+
+	if db.IOPS <= 0 {
+		return db.IOLatency
+	}
+	if db.nextIO.Before(now) {
+		db.nextIO = now
+	}
+	queued := db.nextIO.Sub(now)
+	db.nextIO = db.nextIO.Add(time.Second / time.Duration(db.IOPS))
+
+	return queued + db.IOLatency
+}
+
+// BufferPoolHitRatio is the share of reads served from memory: all of them
+// while the working set fits in the buffer pool, and the part that fits
+// after that
+func (db *Database) BufferPoolHitRatio() float64 {
+	workingSet := float64(db.storedBytes())
+
+	db.connMutex.RLock()
+	pool := db.MemoryGB * bufferPoolShare * gib
+	db.connMutex.RUnlock()
+	if workingSet <= pool {
+		return 1.0
+	}
+	return pool / workingSet
+}
+
+// storedBytes is the data the database holds: its working set plus what was
+// written during the simulation
+func (db *Database) storedBytes() int64 {
+	db.dataMutex.RLock()
+	defer db.dataMutex.RUnlock()
+
+	return int64(db.WorkingSetGB*gib) + db.UsedCapacity
+}
+
+// backgroundIO queues IOs for work outside queries, such as resharding, so
+// queries wait behind them
+func (db *Database) backgroundIO(ios int) {
+	if ios <= 0 {
+		return
+	}
+
+	db.ioMutex.Lock()
+	defer db.ioMutex.Unlock()
+
+	now := time.Now()
+	db.ioCount += int64(ios)
+	if db.IOPS <= 0 {
+		return
+	}
+	if db.nextIO.Before(now) {
+		db.nextIO = now
+	}
+	db.nextIO = db.nextIO.Add(time.Duration(ios) * time.Second / time.Duration(db.IOPS))
+}
+
+// readLatency is a read's query time plus, on a buffer pool miss, a disk IO
+func (db *Database) readLatency() time.Duration {
+	latency := db.queryTime(db.ReadLatency)
+	if rand.Float64() < db.BufferPoolHitRatio() {
+		atomic.AddInt64(&db.bufferHits, 1)
+		return latency
+	}
+	atomic.AddInt64(&db.bufferMisses, 1)
+	return latency + db.diskIO()
+}
+
+// writeLatency is a write's query time plus the IO that makes its log
+// record durable
+func (db *Database) writeLatency() time.Duration {
+	return db.queryTime(db.WriteLatency) + db.diskIO()
+}
+
+func (db *Database) GetIOPSUtilization() float64 {
+	db.ioMutex.Lock()
+	defer db.ioMutex.Unlock()
+
+	if db.IOPS <= 0 || db.ioWindowStart.IsZero() {
+		return 0
+	}
+	// The last full window, unless the current one has outlived it with no
+	// IO closing it, or none has completed yet
+	elapsed := time.Since(db.ioWindowStart).Seconds()
+	if elapsed >= 1 || db.ioUtilization == 0 {
+		return float64(db.ioCount) / elapsed / float64(db.IOPS)
+	}
+	return db.ioUtilization
+}
+
+func (db *Database) GetPerformanceStats() PerformanceStats {
+	db.connMutex.RLock()
+	active := len(db.conns)
+	maxConns := cap(db.conns)
+	db.connMutex.RUnlock()
+
+	return PerformanceStats{
+		ActiveConnections:   active,
+		MaxConnections:      maxConns,
+		WaitingConnections:  atomic.LoadInt64(&db.connWaiting),
+		RejectedConnections: atomic.LoadInt64(&db.connRejected),
+		IOPSUtilization:     db.GetIOPSUtilization(),
+		BufferPoolHitRatio:  db.BufferPoolHitRatio(),
+		BufferPoolHits:      atomic.LoadInt64(&db.bufferHits),
+		BufferPoolMisses:    atomic.LoadInt64(&db.bufferMisses),
+	}
+}
@@ -0,0 +1,822 @@
+package database
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// Placement decides where a quorum store puts its nodes
+type Placement string
+
+const (
+	// Nodes are spread over the availability zones of the store's region
+	PlacementZones Placement = "zones"
+	// Nodes are spread over regions, starting with the store's own
+	PlacementRegions Placement = "regions"
+)
+
+func GetPlacements() []Placement {
+	return []Placement{PlacementZones, PlacementRegions}
+}
+
+const (
+	// Virtual nodes each quorum store node gets on the hash ring
+	quorumVirtualNodes = 64
+	// Round trips between nodes in the same zone, and in different zones of
+	// the same region
+	sameZoneLatency  = 200 * time.Microsecond
+	crossZoneLatency = time.Millisecond
+)
+
+// VectorClock counts the writes each coordinating node made to a value
+type VectorClock map[string]int64
+
+// descends reports whether vc has seen every write other has
+func (vc VectorClock) descends(other VectorClock) bool {
+	for node, count := range other {
+		if vc[node] < count {
+			return false
+		}
+	}
+	return true
+}
+
+func (vc VectorClock) merge(other VectorClock) VectorClock {
+	merged := make(VectorClock, len(vc)+len(other))
+	for node, count := range vc {
+		merged[node] = count
+	}
+	for node, count := range other {
+		if count > merged[node] {
+			merged[node] = count
+		}
+	}
+	return merged
+}
+
+// storedVersion is one replica's copy of a value. Key-value stores version
+// it with a vector clock, wide-column stores with a write timestamp.
+type storedVersion struct {
+	clock     VectorClock
+	timestamp int64
+	seq       int64 // writes the store had accepted for the key, which also identifies the write
+}
+
+type quorumHint struct {
+	target  *quorumNode
+	key     string
+	version storedVersion
+}
+
+type quorumNode struct {
+	ID        string
+	Zone      string
+	Region    string
+	healthy   bool
+	downSince time.Time
+	data      map[string][]storedVersion // siblings the node could not order
+	hints     []quorumHint               // writes it holds for nodes that were down
+	mu        sync.Mutex
+}
+
+func (n *quorumNode) isHealthy() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.healthy
+}
+
+func (n *quorumNode) get(key string) []storedVersion {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]storedVersion(nil), n.data[key]...)
+}
+
+// put stores a version, keeping whatever it does not supersede, and
+// reports whether the node's copy changed
+func (n *quorumNode) put(key string, version storedVersion, vectorClocks bool) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	current := n.data[key]
+	merged := reconcile(append(append([]storedVersion(nil), current...), version), vectorClocks)
+	if sameWrites(current, merged) {
+		return false
+	}
+	n.data[key] = merged
+	return true
+}
+
+// reconcile keeps the versions no other version supersedes: the latest
+// timestamp, or every vector clock no other one descends from
+func reconcile(versions []storedVersion, vectorClocks bool) []storedVersion {
+	if len(versions) == 0 {
+		return nil
+	}
+
+	if !vectorClocks {
+		latest := versions[0]
+		for _, version := range versions[1:] {
+			if version.timestamp > latest.timestamp || (version.timestamp == latest.timestamp && version.seq > latest.seq) {
+				latest = version
+			}
+		}
+		return []storedVersion{latest}
+	}
+
+	kept := make([]storedVersion, 0, len(versions))
+	seen := make(map[int64]bool)
+	for _, version := range versions {
+		if seen[version.seq] {
+			continue
+		}
+		superseded := false
+		for _, other := range versions {
+			if other.seq == version.seq || !other.clock.descends(version.clock) {
+				continue
+			}
+			// Equal clocks come from writes racing through one coordinator;
+			// the later write wins
+			if !version.clock.descends(other.clock) || other.seq > version.seq {
+				superseded = true
+				break
+			}
+		}
+		if !superseded {
+			seen[version.seq] = true
+			kept = append(kept, version)
+		}
+	}
+	return kept
+}
+
+// sameWrites reports whether two sets of versions hold the same writes
+func sameWrites(a, b []storedVersion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	writes := make(map[int64]bool, len(a))
+	for _, version := range a {
+		writes[version.seq] = true
+	}
+	for _, version := range b {
+		if !writes[version.seq] {
+			return false
+		}
+	}
+	return true
+}
+
+type quorumRingPoint struct {
+	hash uint32
+	node *quorumNode
+}
+
+// quorumTarget is a replica a request goes to: a node of the key's
+// preference list, or in a sloppy quorum a stand-in holding a hint for one
+type quorumTarget struct {
+	node    *quorumNode
+	hintFor *quorumNode
+}
+
+// QuorumStats counts how the store's quorums went
+type QuorumStats struct {
+	Reads          int64
+	Writes         int64
+	FailedQuorums  int64 // requests that reached fewer replicas than R or W
+	StaleReads     int64 // reads whose R replies all missed the latest write
+	Conflicts      int64 // reads that returned siblings for the client to merge
+	ReadRepairs    int64 // replicas brought up to date by reads
+	HintsStored    int64
+	HintsDelivered int64
+	HintsSkipped   int64 // writes no hint was kept for, the node being down past the hint window
+}
+
+// QuorumNodeStats is one node of a quorum store
+type QuorumNodeStats struct {
+	ID       string
+	Zone     string
+	Healthy  bool
+	Keys     int
+	Hints    int
+	KeyShare float64 // part of the ring the node owns as first replica
+}
+
+// QuorumStore is a leaderless replicated store in the style of Dynamo and
+// Cassandra. Every key lives on N nodes picked clockwise from its hash on a
+// ring, spread over zones or regions. A write succeeds once W replicas have
+// taken it and a read once R have answered, so a request takes as long as
+// the W-th or R-th fastest replica and fails once fewer are reachable.
+//
+// Key-value stores version values with vector clocks and hand concurrent
+// writes back as siblings; NoSQL (wide-column) stores keep the write with
+// the latest timestamp.
+type QuorumStore struct {
+	ID           string
+	Type         DatabaseType
+	Region       string
+	Placement    Placement
+	N            int
+	R            int
+	W            int
+	SloppyQuorum bool          // stand-ins take writes for down replicas and hand them off later
+	ReadRepair   bool          // reads update the replicas that answered with old versions
+	HintWindow   time.Duration // how long a node may be down before hints for it stop being kept
+	NodeInstance *config.DatabaseInstanceType
+	ReadLatency  time.Duration // one replica serving a read
+	WriteLatency time.Duration // one replica appending a write to its commit log
+	healthy      bool
+	metrics      *engine.Metrics
+	metricsMutex sync.RWMutex
+	nodes        []*quorumNode
+	nodeCounter  int
+	ring         []quorumRingPoint
+	nodesMutex   sync.RWMutex
+	seqs         map[string]int64
+	stats        QuorumStats
+	statsMutex   sync.Mutex
+}
+
+func NewQuorumStore(id string, dbType DatabaseType, region string, nodes int) *QuorumStore {
+	qs := &QuorumStore{
+		ID:           id,
+		Type:         dbType,
+		Region:       region,
+		Placement:    PlacementZones,
+		N:            3,
+		R:            2,
+		W:            2,
+		SloppyQuorum: true,
+		ReadRepair:   true,
+		// Cassandra keeps hints for three hours; simulations run for minutes
+		HintWindow:   30 * time.Second,
+		NodeInstance: config.GetDatabaseInstanceType("db.m5.large"),
+		ReadLatency:  time.Millisecond,
+		WriteLatency: 2 * time.Millisecond,
+		healthy:      true,
+		metrics:      &engine.Metrics{},
+		seqs:         make(map[string]int64),
+	}
+	for i := 0; i < nodes; i++ {
+		qs.AddNode()
+	}
+	return qs
+}
+
+func (qs *QuorumStore) GetID() string {
+	return qs.ID
+}
+
+func (qs *QuorumStore) GetType() string {
+	return fmt.Sprintf("database-%s", qs.Type)
+}
+
+func (qs *QuorumStore) GetRegion() string {
+	return qs.Region
+}
+
+// vectorClocks reports whether values are versioned with vector clocks
+// rather than timestamps
+func (qs *QuorumStore) vectorClocks() bool {
+	return qs.Type == DatabaseTypeKeyValue
+}
+
+// AddNode joins a node in the next zone or region of the placement. It
+// starts empty; read repair and later writes fill it in.
+func (qs *QuorumStore) AddNode() {
+	qs.nodesMutex.Lock()
+	defer qs.nodesMutex.Unlock()
+
+	qs.nodeCounter++
+	node := &quorumNode{
+		ID:      fmt.Sprintf("%s-node-%d", qs.ID, qs.nodeCounter),
+		healthy: true,
+		data:    make(map[string][]storedVersion),
+	}
+	qs.nodes = append(qs.nodes, node)
+	qs.placeNodesLocked()
+	qs.rebuildRingLocked()
+}
+
+// RemoveNode decommissions the newest node along with its data
+func (qs *QuorumStore) RemoveNode() {
+	qs.nodesMutex.Lock()
+	defer qs.nodesMutex.Unlock()
+
+	if len(qs.nodes) <= 1 {
+		return
+	}
+	qs.nodes = qs.nodes[:len(qs.nodes)-1]
+	qs.rebuildRingLocked()
+}
+
+// SetNodeHealthy takes a node down or brings it back. A node keeps its data
+// while down and misses the writes made meanwhile.
+func (qs *QuorumStore) SetNodeHealthy(id string, healthy bool) error {
+	for _, node := range qs.getNodes() {
+		if node.ID != id {
+			continue
+		}
+		node.mu.Lock()
+		if node.healthy && !healthy {
+			node.downSince = time.Now()
+		}
+		node.healthy = healthy
+		node.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("node %s not found", id)
+}
+
+// ApplyPlacement moves the nodes to the zones or regions of the current
+// placement
+func (qs *QuorumStore) ApplyPlacement() {
+	qs.nodesMutex.Lock()
+	defer qs.nodesMutex.Unlock()
+
+	qs.placeNodesLocked()
+}
+
+// homeRegion is the region the store's coordinators run in, whether Region
+// holds its ID or its short name
+func (qs *QuorumStore) homeRegion() *config.Region {
+	return config.GetRegionByName(config.GetRegionName(qs.Region))
+}
+
+func (qs *QuorumStore) placeNodesLocked() {
+	home := qs.homeRegion()
+
+	regions := []string{home.ID}
+	for _, id := range config.GetRegionIDs() {
+		if id != home.ID {
+			regions = append(regions, id)
+		}
+	}
+
+	for i, node := range qs.nodes {
+		node.mu.Lock()
+		if qs.Placement == PlacementRegions {
+			node.Region = regions[i%len(regions)]
+			zones := config.GetAvailabilityZones(node.Region)
+			node.Zone = zones[(i/len(regions))%len(zones)]
+		} else {
+			node.Region = home.ID
+			node.Zone = home.AvailabilityZones[i%len(home.AvailabilityZones)]
+		}
+		node.mu.Unlock()
+	}
+}
+
+func (qs *QuorumStore) rebuildRingLocked() {
+	ring := make([]quorumRingPoint, 0, len(qs.nodes)*quorumVirtualNodes)
+	for _, node := range qs.nodes {
+		for v := 0; v < quorumVirtualNodes; v++ {
+			ring = append(ring, quorumRingPoint{hash: hashKey(node.ID + "#" + strconv.Itoa(v)), node: node})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	qs.ring = ring
+}
+
+func (qs *QuorumStore) getNodes() []*quorumNode {
+	qs.nodesMutex.RLock()
+	defer qs.nodesMutex.RUnlock()
+
+	return append([]*quorumNode(nil), qs.nodes...)
+}
+
+// preferenceList walks the ring clockwise from the key. The first N nodes,
+// taking one per zone while unused zones remain, are the key's replicas.
+// In a sloppy quorum each replica that is down is stood in for by the next
+// healthy node after them.
+func (qs *QuorumStore) preferenceList(key string) []quorumTarget {
+	qs.nodesMutex.RLock()
+	defer qs.nodesMutex.RUnlock()
+
+	if len(qs.ring) == 0 {
+		return nil
+	}
+	zones := make(map[string]bool)
+	for _, node := range qs.nodes {
+		zones[node.Zone] = true
+	}
+
+	hash := hashKey(key)
+	start := sort.Search(len(qs.ring), func(i int) bool { return qs.ring[i].hash >= hash })
+	walk := make([]*quorumNode, 0, len(qs.nodes))
+	seen := make(map[*quorumNode]bool)
+	for i := 0; i < len(qs.ring) && len(walk) < len(qs.nodes); i++ {
+		node := qs.ring[(start+i)%len(qs.ring)].node
+		if !seen[node] {
+			seen[node] = true
+			walk = append(walk, node)
+		}
+	}
+
+	replicas := make([]*quorumNode, 0, qs.N)
+	chosen := make(map[*quorumNode]bool)
+	usedZones := make(map[string]bool)
+	for len(replicas) < qs.N && len(replicas) < len(walk) {
+		for _, node := range walk {
+			if len(replicas) == qs.N {
+				break
+			}
+			if chosen[node] || (usedZones[node.Zone] && len(usedZones) < len(zones)) {
+				continue
+			}
+			chosen[node] = true
+			usedZones[node.Zone] = true
+			replicas = append(replicas, node)
+		}
+	}
+
+	targets := make([]quorumTarget, 0, len(replicas))
+	for _, replica := range replicas {
+		if replica.isHealthy() || !qs.SloppyQuorum {
+			targets = append(targets, quorumTarget{node: replica})
+			continue
+		}
+		for _, node := range walk {
+			if !chosen[node] && node.isHealthy() {
+				chosen[node] = true
+				targets = append(targets, quorumTarget{node: node, hintFor: replica})
+				break
+			}
+		}
+	}
+	return targets
+}
+
+// replicaLatency is a round trip from the coordinator to a node plus the
+// node's service time, with a tail for the occasional slow replica
+func (qs *QuorumStore) replicaLatency(node *quorumNode, service time.Duration) time.Duration {
+	home := qs.homeRegion()
+
+	node.mu.Lock()
+	region, zone := node.Region, node.Zone
+	node.mu.Unlock()
+
+	network := sameZoneLatency
+	switch {
+	case region != home.ID:
+		network = config.GetNetworkLatency(home.ID, region)
+	case zone != home.AvailabilityZones[0]:
+		network = crossZoneLatency
+	}
+	return network + service + time.Duration(rand.ExpFloat64()*float64(service)/2)
+}
+
+// quorumWait is when the k-th fastest of the replies arrives
+func quorumWait(latencies []time.Duration, k int) time.Duration {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[k-1]
+}
+
+func (qs *QuorumStore) Process(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+
+	qs.metricsMutex.Lock()
+	qs.metrics.RequestCount++
+	qs.metricsMutex.Unlock()
+
+	if !qs.IsHealthy() {
+		return qs.fail(req, start, fmt.Errorf("database is unhealthy"))
+	}
+
+	targets := qs.preferenceList(req.Path)
+	reachable := make([]quorumTarget, 0, len(targets))
+	for _, target := range targets {
+		if target.node.isHealthy() {
+			reachable = append(reachable, target)
+		}
+	}
+
+	needed := qs.R
+	if req.Type == engine.RequestTypeWrite {
+		needed = qs.W
+	}
+	if len(reachable) < needed || needed < 1 {
+		qs.statsMutex.Lock()
+		qs.stats.FailedQuorums++
+		qs.statsMutex.Unlock()
+		return qs.fail(req, start, fmt.Errorf("quorum not reached: %d of %d replicas reachable, %d needed", len(reachable), qs.N, needed))
+	}
+
+	var latency time.Duration
+	var version storedVersion
+	if req.Type == engine.RequestTypeWrite {
+		latency, version = qs.write(req, reachable)
+	} else {
+		latency, version = qs.read(req, reachable)
+	}
+	time.Sleep(latency)
+
+	totalLatency := time.Since(start)
+	qs.metricsMutex.Lock()
+	qs.metrics.SuccessCount++
+	qs.metrics.TotalLatency += totalLatency
+	qs.metrics.AverageLatency = time.Duration(int64(qs.metrics.TotalLatency) / qs.metrics.RequestCount)
+	qs.metricsMutex.Unlock()
+
+	hops := []string{qs.ID}
+	for _, target := range reachable[:needed] {
+		hops = append(hops, target.node.ID)
+	}
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   true,
+		Latency:   totalLatency,
+		DataSize:  req.DataSize,
+		HopsTrace: hops,
+		Metadata:  map[string]interface{}{"version": version.seq},
+	}, nil
+}
+
+func (qs *QuorumStore) fail(req *engine.Request, start time.Time, err error) (*engine.Response, error) {
+	qs.metricsMutex.Lock()
+	qs.metrics.FailureCount++
+	qs.metricsMutex.Unlock()
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   false,
+		Latency:   time.Since(start),
+		Error:     err,
+	}, err
+}
+
+// write has the first reachable replica coordinate: it versions the value
+// after what it holds itself and sends it to every reachable replica.
+// Stand-ins keep a hint to hand the write to the replica they cover for.
+func (qs *QuorumStore) write(req *engine.Request, targets []quorumTarget) (time.Duration, storedVersion) {
+	coordinator := targets[0].node
+
+	qs.statsMutex.Lock()
+	qs.seqs[req.Path]++
+	seq := qs.seqs[req.Path]
+	qs.stats.Writes++
+	qs.statsMutex.Unlock()
+
+	version := storedVersion{timestamp: time.Now().UnixNano(), seq: seq}
+	if qs.vectorClocks() {
+		clock := VectorClock{}
+		for _, sibling := range coordinator.get(req.Path) {
+			clock = clock.merge(sibling.clock)
+		}
+		clock[coordinator.ID]++
+		version.clock = clock
+	}
+
+	latencies := make([]time.Duration, 0, len(targets))
+	for _, target := range targets {
+		target.node.put(req.Path, version, qs.vectorClocks())
+		if target.hintFor != nil {
+			qs.storeHint(target, req.Path, version)
+		}
+		latencies = append(latencies, qs.replicaLatency(target.node, qs.WriteLatency))
+	}
+	return quorumWait(latencies, qs.W), version
+}
+
+func (qs *QuorumStore) storeHint(target quorumTarget, key string, version storedVersion) {
+	target.hintFor.mu.Lock()
+	downFor := time.Since(target.hintFor.downSince)
+	target.hintFor.mu.Unlock()
+
+	qs.statsMutex.Lock()
+	defer qs.statsMutex.Unlock()
+
+	if downFor > qs.HintWindow {
+		qs.stats.HintsSkipped++
+		return
+	}
+	target.node.mu.Lock()
+	target.node.hints = append(target.node.hints, quorumHint{target: target.hintFor, key: key, version: version})
+	target.node.mu.Unlock()
+	qs.stats.HintsStored++
+}
+
+// read asks every reachable replica and answers once R have replied, with
+// what those R hold. The slower replies still arrive, and read repair sends
+// every replica that is behind the newest version any of them had.
+func (qs *QuorumStore) read(req *engine.Request, targets []quorumTarget) (time.Duration, storedVersion) {
+	type reply struct {
+		target   quorumTarget
+		latency  time.Duration
+		versions []storedVersion
+	}
+	replies := make([]reply, 0, len(targets))
+	for _, target := range targets {
+		replies = append(replies, reply{
+			target:   target,
+			latency:  qs.replicaLatency(target.node, qs.ReadLatency),
+			versions: target.node.get(req.Path),
+		})
+	}
+	sort.Slice(replies, func(i, j int) bool { return replies[i].latency < replies[j].latency })
+
+	answered := make([]storedVersion, 0)
+	all := make([]storedVersion, 0)
+	for i, r := range replies {
+		if i < qs.R {
+			answered = append(answered, r.versions...)
+		}
+		all = append(all, r.versions...)
+	}
+	result := reconcile(answered, qs.vectorClocks())
+	newest := reconcile(all, qs.vectorClocks())
+
+	qs.statsMutex.Lock()
+	qs.stats.Reads++
+	if len(result) > 1 {
+		qs.stats.Conflicts++
+	}
+	stale := qs.seqs[req.Path] > latestSeq(result)
+	if stale {
+		qs.stats.StaleReads++
+	}
+	qs.statsMutex.Unlock()
+
+	if stale {
+		qs.metricsMutex.Lock()
+		qs.metrics.StaleReads++
+		qs.metricsMutex.Unlock()
+	}
+
+	if qs.ReadRepair {
+		repaired := int64(0)
+		for _, r := range replies {
+			updated := false
+			for _, version := range newest {
+				if r.target.node.put(req.Path, version, qs.vectorClocks()) {
+					updated = true
+				}
+			}
+			if updated {
+				repaired++
+			}
+		}
+		qs.statsMutex.Lock()
+		qs.stats.ReadRepairs += repaired
+		qs.statsMutex.Unlock()
+	}
+
+	latest := storedVersion{}
+	for _, version := range result {
+		if version.seq > latest.seq {
+			latest = version
+		}
+	}
+	return replies[qs.R-1].latency, latest
+}
+
+func latestSeq(versions []storedVersion) int64 {
+	latest := int64(0)
+	for _, version := range versions {
+		if version.seq > latest {
+			latest = version.seq
+		}
+	}
+	return latest
+}
+
+// Tick hands hinted writes to the nodes they were meant for once those are
+// back
+func (qs *QuorumStore) Tick(now time.Time) {
+	for _, node := range qs.getNodes() {
+		if !node.isHealthy() {
+			continue
+		}
+
+		node.mu.Lock()
+		hints := node.hints
+		node.hints = nil
+		node.mu.Unlock()
+
+		kept := make([]quorumHint, 0)
+		delivered := int64(0)
+		for _, hint := range hints {
+			if !hint.target.isHealthy() {
+				kept = append(kept, hint)
+				continue
+			}
+			hint.target.put(hint.key, hint.version, qs.vectorClocks())
+			delivered++
+		}
+
+		node.mu.Lock()
+		node.hints = append(kept, node.hints...)
+		// A stand-in drops its copy once every write it held for the key
+		// has been handed off
+		for _, hint := range hints {
+			if !hintsFor(node.hints, hint.key) {
+				delete(node.data, hint.key)
+			}
+		}
+		node.mu.Unlock()
+
+		qs.statsMutex.Lock()
+		qs.stats.HintsDelivered += delivered
+		qs.statsMutex.Unlock()
+	}
+}
+
+func hintsFor(hints []quorumHint, key string) bool {
+	for _, hint := range hints {
+		if hint.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// GetVersion returns how many writes the store has accepted for the key
+func (qs *QuorumStore) GetVersion(key string) int64 {
+	qs.statsMutex.Lock()
+	defer qs.statsMutex.Unlock()
+
+	return qs.seqs[key]
+}
+
+func (qs *QuorumStore) GetStats() QuorumStats {
+	qs.statsMutex.Lock()
+	defer qs.statsMutex.Unlock()
+
+	return qs.stats
+}
+
+func (qs *QuorumStore) GetNodeStats() []QuorumNodeStats {
+	qs.nodesMutex.RLock()
+	nodes := append([]*quorumNode(nil), qs.nodes...)
+	shares := make(map[*quorumNode]float64)
+	for i, point := range qs.ring {
+		previous := qs.ring[(i+len(qs.ring)-1)%len(qs.ring)].hash
+		// The arc ending at this point; unsigned subtraction wraps past zero
+		shares[point.node] += float64(point.hash-previous) / float64(^uint32(0))
+	}
+	qs.nodesMutex.RUnlock()
+
+	stats := make([]QuorumNodeStats, 0, len(nodes))
+	for _, node := range nodes {
+		node.mu.Lock()
+		stats = append(stats, QuorumNodeStats{
+			ID:       node.ID,
+			Zone:     node.Zone,
+			Healthy:  node.healthy,
+			Keys:     len(node.data),
+			Hints:    len(node.hints),
+			KeyShare: shares[node],
+		})
+		node.mu.Unlock()
+	}
+	return stats
+}
+
+// GetNodeCounts returns how many nodes are up, out of all nodes
+func (qs *QuorumStore) GetNodeCounts() (int, int) {
+	nodes := qs.getNodes()
+	healthy := 0
+	for _, node := range nodes {
+		if node.isHealthy() {
+			healthy++
+		}
+	}
+	return healthy, len(nodes)
+}
+
+func (qs *QuorumStore) GetMetrics() *engine.Metrics {
+	qs.metricsMutex.RLock()
+	defer qs.metricsMutex.RUnlock()
+
+	metricsCopy := *qs.metrics
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	return &metricsCopy
+}
+
+// GetCost is one instance and its storage per node
+func (qs *QuorumStore) GetCost() float64 {
+	perNode := qs.NodeInstance.CostPerHour + float64(qs.NodeInstance.StorageGB)*qs.NodeInstance.CostPerGBStorage/730
+	return perNode * float64(len(qs.getNodes()))
+}
+
+func (qs *QuorumStore) IsHealthy() bool {
+	qs.nodesMutex.RLock()
+	defer qs.nodesMutex.RUnlock()
+
+	return qs.healthy
+}
+
+func (qs *QuorumStore) SetHealthy(healthy bool) {
+	qs.nodesMutex.Lock()
+	qs.healthy = healthy
+	qs.nodesMutex.Unlock()
+}
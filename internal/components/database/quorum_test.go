@@ -0,0 +1,193 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+func quorumWrite(t *testing.T, qs *QuorumStore, key string) {
+	t.Helper()
+	if _, err := qs.Process(&engine.Request{ID: "w", Type: engine.RequestTypeWrite, Path: key, DataSize: 64}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// replicasOf returns the nodes a key lives on while every node is up
+func replicasOf(t *testing.T, qs *QuorumStore, key string) []*quorumNode {
+	t.Helper()
+	replicas := make([]*quorumNode, 0, qs.N)
+	for _, target := range qs.preferenceList(key) {
+		if target.hintFor != nil {
+			t.Fatal("a stand-in was chosen with every node up")
+		}
+		replicas = append(replicas, target.node)
+	}
+	return replicas
+}
+
+// Writes coordinated by two nodes that cannot see each other's write come
+// back from a read as siblings. Read repair spreads both, and the next
+// write, whose clock descends from both, settles them.
+func TestConcurrentWritesBecomeSiblings(t *testing.T) {
+	qs := NewQuorumStore("kv", DatabaseTypeKeyValue, "us-east-1", 3)
+	qs.SloppyQuorum = false
+	qs.W = 1
+	qs.R = 3
+	key := "/api/carts/1"
+	replicas := replicasOf(t, qs, key)
+	a, b, c := replicas[0], replicas[1], replicas[2]
+
+	// a alone takes the first write, then b the second without it
+	qs.SetNodeHealthy(b.ID, false)
+	qs.SetNodeHealthy(c.ID, false)
+	quorumWrite(t, qs, key)
+	qs.SetNodeHealthy(a.ID, false)
+	qs.SetNodeHealthy(b.ID, true)
+	quorumWrite(t, qs, key)
+	qs.SetNodeHealthy(a.ID, true)
+	qs.SetNodeHealthy(c.ID, true)
+
+	if _, err := qs.Process(&engine.Request{ID: "r", Type: engine.RequestTypeRead, Path: key}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := qs.GetStats(); stats.Conflicts != 1 {
+		t.Fatalf("%d reads returned siblings, want 1", stats.Conflicts)
+	}
+	for _, node := range replicas {
+		if siblings := node.get(key); len(siblings) != 2 {
+			t.Errorf("%s holds %d versions after read repair, want both siblings", node.ID, len(siblings))
+		}
+	}
+
+	quorumWrite(t, qs, key)
+	if _, err := qs.Process(&engine.Request{ID: "r", Type: engine.RequestTypeRead, Path: key}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := qs.GetStats(); stats.Conflicts != 1 {
+		t.Errorf("the read after a merging write still returned siblings")
+	}
+	for _, node := range replicas {
+		if versions := node.get(key); len(versions) != 1 || versions[0].seq != 3 {
+			t.Errorf("%s holds %v, want only the third write", node.ID, versions)
+		}
+	}
+}
+
+// Wide-column stores keep the write with the latest timestamp instead of
+// siblings
+func TestReconcileByTimestamp(t *testing.T) {
+	versions := []storedVersion{
+		{timestamp: 200, seq: 1},
+		{timestamp: 300, seq: 2},
+		{timestamp: 300, seq: 3},
+		{timestamp: 100, seq: 4},
+	}
+	kept := reconcile(versions, false)
+	if len(kept) != 1 || kept[0].seq != 3 {
+		t.Errorf("kept %v, want the later of the two latest writes", kept)
+	}
+}
+
+// A sloppy quorum walks past a replica that is down to the next healthy
+// node, which stands in for it; a strict one fails the request instead
+func TestPreferenceListSkipsFailedNodes(t *testing.T) {
+	qs := NewQuorumStore("kv", DatabaseTypeKeyValue, "us-east-1", 5)
+	key := "/api/carts/1"
+	replicas := replicasOf(t, qs, key)
+	down := replicas[1]
+	qs.SetNodeHealthy(down.ID, false)
+
+	targets := qs.preferenceList(key)
+	if len(targets) != qs.N {
+		t.Fatalf("%d targets, want %d", len(targets), qs.N)
+	}
+	standIns := 0
+	for _, target := range targets {
+		if target.node == down {
+			t.Errorf("the down node %s is still a target", down.ID)
+		}
+		if !target.node.isHealthy() {
+			t.Errorf("target %s is down", target.node.ID)
+		}
+		if target.hintFor == nil {
+			continue
+		}
+		standIns++
+		if target.hintFor != down {
+			t.Errorf("%s stands in for %s, want %s", target.node.ID, target.hintFor.ID, down.ID)
+		}
+		for _, replica := range replicas {
+			if target.node == replica {
+				t.Errorf("stand-in %s is already one of the key's replicas", replica.ID)
+			}
+		}
+	}
+	if standIns != 1 {
+		t.Errorf("%d stand-ins, want 1", standIns)
+	}
+
+	qs.SloppyQuorum = false
+	qs.SetNodeHealthy(replicas[2].ID, false)
+	if _, err := qs.Process(&engine.Request{ID: "w", Type: engine.RequestTypeWrite, Path: key, DataSize: 64}); err == nil {
+		t.Error("a strict write succeeded with two of three replicas down")
+	}
+	if stats := qs.GetStats(); stats.FailedQuorums != 1 {
+		t.Errorf("%d failed quorums, want 1", stats.FailedQuorums)
+	}
+}
+
+// A stand-in holds a hint for the replica it covers and hands the write over
+// once that replica is back, then drops its own copy
+func TestHintsDeliveredOnRecovery(t *testing.T) {
+	qs := NewQuorumStore("kv", DatabaseTypeKeyValue, "us-east-1", 5)
+	key := "/api/carts/1"
+	down := replicasOf(t, qs, key)[0]
+	qs.SetNodeHealthy(down.ID, false)
+
+	quorumWrite(t, qs, key)
+	var standIn *quorumNode
+	for _, target := range qs.preferenceList(key) {
+		if target.hintFor == down {
+			standIn = target.node
+		}
+	}
+	if standIn == nil {
+		t.Fatal("no stand-in for the down replica")
+	}
+	if stats := qs.GetStats(); stats.HintsStored != 1 {
+		t.Fatalf("%d hints stored, want 1", stats.HintsStored)
+	}
+
+	// Nothing is handed off while the replica is still down
+	qs.Tick(time.Now())
+	if len(down.get(key)) != 0 || qs.GetStats().HintsDelivered != 0 {
+		t.Fatal("a hint was delivered to a node that is down")
+	}
+
+	qs.SetNodeHealthy(down.ID, true)
+	qs.Tick(time.Now())
+	if versions := down.get(key); len(versions) != 1 || versions[0].seq != 1 {
+		t.Errorf("the recovered replica holds %v, want the hinted write", versions)
+	}
+	if stats := qs.GetStats(); stats.HintsDelivered != 1 {
+		t.Errorf("%d hints delivered, want 1", stats.HintsDelivered)
+	}
+	if len(standIn.get(key)) != 0 {
+		t.Errorf("stand-in %s kept its copy after handing it off", standIn.ID)
+	}
+}
+
+// No hint is kept for a node down longer than the hint window
+func TestHintsSkippedPastWindow(t *testing.T) {
+	qs := NewQuorumStore("kv", DatabaseTypeKeyValue, "us-east-1", 5)
+	qs.HintWindow = 0
+	key := "/api/carts/1"
+	qs.SetNodeHealthy(replicasOf(t, qs, key)[0].ID, false)
+
+	quorumWrite(t, qs, key)
+	if stats := qs.GetStats(); stats.HintsStored != 0 || stats.HintsSkipped != 1 {
+		t.Errorf("%d hints stored and %d skipped, want 0 and 1", stats.HintsStored, stats.HintsSkipped)
+	}
+}
@@ -0,0 +1,257 @@
+package database
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+type ConsistencyMode string
+
+const (
+	// Reads go to any replica, however far behind it is
+	ConsistencyEventual ConsistencyMode = "eventual"
+	// Reads go to replicas that have applied the caller's own writes, as
+	// named by the session token returned with each write
+	ConsistencyReadYourWrites ConsistencyMode = "read-your-writes"
+	// Reads go to replicas lagging at most MaxStaleness
+	ConsistencyBoundedStaleness ConsistencyMode = "bounded-staleness"
+	// Reads go to the primary only
+	ConsistencyStrong ConsistencyMode = "strong"
+)
+
+func GetConsistencyModes() []ConsistencyMode {
+	return []ConsistencyMode{ConsistencyEventual, ConsistencyReadYourWrites, ConsistencyBoundedStaleness, ConsistencyStrong}
+}
+
+type ReplicaRouting string
+
+const (
+	ReplicaRoundRobin  ReplicaRouting = "round-robin"
+	ReplicaLeastLagged ReplicaRouting = "least-lagged"
+)
+
+func GetReplicaRoutings() []ReplicaRouting {
+	return []ReplicaRouting{ReplicaRoundRobin, ReplicaLeastLagged}
+}
+
+// SessionTokenHeader carries the log position of the client's latest write.
+// Writes return it as the "session_token" response metadata.
+const SessionTokenHeader = "X-Session-Token"
+
+// replicationRetry is how often a write waiting on a leader that is down
+// checks whether it is back
+const replicationRetry = 10 * time.Millisecond
+
+// logEntry is a committed write as shipped to the replicas
+type logEntry struct {
+	term      int64
+	lsn       int64
+	key       string
+	shardKey  string
+	size      int64
+	version   int64
+	committed time.Time
+}
+
+// ReplicaStats is the primary's view of one replica
+type ReplicaStats struct {
+	ID         string
+	Healthy    bool
+	Lag        time.Duration
+	AppliedLSN int64
+	Reads      int64
+	StaleReads int64
+}
+
+// replicateToReplicas ships a committed write to every replica, which
+// applies it after its ReplicationLag. Writes a failed primary had not
+// shipped yet stay on the replica's pending log for catchUpReplicas, and are
+// lost if a replica is promoted in the meantime.
+func (db *Database) replicateToReplicas(entry logEntry) {
+	for _, replica := range db.GetReplicas() {
+		replica.replMutex.Lock()
+		replica.pending = append(replica.pending, entry)
+		replica.replMutex.Unlock()
+
+		go func(r *Database) {
+			time.Sleep(r.ReplicationLag)
+			if db.IsHealthy() {
+				r.apply(entry)
+			}
+		}(replica)
+	}
+}
+
+// catchUpReplicas applies the writes replicas are still waiting on once
+// their replication lag has passed, as for writes held up while this
+// primary was down
+func (db *Database) catchUpReplicas() {
+	for _, replica := range db.GetReplicas() {
+		replica.replMutex.Lock()
+		due := make([]logEntry, 0)
+		for _, entry := range replica.pending {
+			if time.Since(entry.committed) >= replica.ReplicationLag {
+				due = append(due, entry)
+			}
+		}
+		replica.replMutex.Unlock()
+
+		for _, entry := range due {
+			replica.apply(entry)
+		}
+	}
+}
+
+// apply stores a replicated write. Writes can land out of order, so a key
+// only moves forward, and the applied position only advances past writes
+// that have all landed. Writes from a primary that has since been replaced
+// are dropped.
+func (db *Database) apply(entry logEntry) {
+	db.dataMutex.Lock()
+	if entry.term < db.term {
+		db.dataMutex.Unlock()
+		return
+	}
+	if entry.version > db.versions[entry.key] {
+		db.UsedCapacity += entry.size - int64(len(db.data[entry.key]))
+		db.data[entry.key] = make([]byte, entry.size)
+		db.versions[entry.key] = entry.version
+		db.setShardKey(entry.key, entry.shardKey)
+	}
+	db.dataMutex.Unlock()
+
+	db.replMutex.Lock()
+	defer db.replMutex.Unlock()
+
+	for i, pending := range db.pending {
+		if pending.lsn == entry.lsn {
+			db.pending = append(db.pending[:i], db.pending[i+1:]...)
+			break
+		}
+	}
+	if len(db.pending) > 0 {
+		db.appliedLSN = db.pending[0].lsn - 1
+	} else if entry.lsn > db.appliedLSN {
+		db.appliedLSN = entry.lsn
+	}
+}
+
+// GetLag returns how long the oldest write the replica has not applied yet
+// has been waiting
+func (db *Database) GetLag() time.Duration {
+	db.replMutex.Lock()
+	defer db.replMutex.Unlock()
+
+	if len(db.pending) == 0 {
+		return 0
+	}
+	return time.Since(db.pending[0].committed)
+}
+
+func (db *Database) GetAppliedLSN() int64 {
+	db.replMutex.Lock()
+	defer db.replMutex.Unlock()
+
+	return db.appliedLSN
+}
+
+// pickReplica chooses the replica to serve a read under the consistency
+// mode, or nil when the read has to go to the primary
+func (db *Database) pickReplica(req *engine.Request) *Database {
+	if db.Consistency == ConsistencyStrong {
+		return nil
+	}
+
+	var token int64
+	if req.Headers != nil {
+		token, _ = strconv.ParseInt(req.Headers[SessionTokenHeader], 10, 64)
+	}
+
+	replicas := db.GetReplicas()
+	candidates := make([]*Database, 0, len(replicas))
+	for _, replica := range replicas {
+		if !replica.IsHealthy() {
+			continue
+		}
+		switch db.Consistency {
+		case ConsistencyReadYourWrites:
+			if replica.GetAppliedLSN() < token {
+				continue
+			}
+		case ConsistencyBoundedStaleness:
+			if replica.GetLag() > db.MaxStaleness {
+				continue
+			}
+		}
+		candidates = append(candidates, replica)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if db.ReplicaRouting == ReplicaLeastLagged {
+		best := candidates[0]
+		for _, replica := range candidates[1:] {
+			if replica.GetLag() < best.GetLag() {
+				best = replica
+			}
+		}
+		return best
+	}
+	next := atomic.AddUint64(&db.replicaCounter, 1)
+	return candidates[next%uint64(len(candidates))]
+}
+
+// readFromReplica serves a read from a replica and counts it as stale if the
+// replica's copy of the key is behind the primary's
+func (db *Database) readFromReplica(replica *Database, req *engine.Request) (*engine.Response, error) {
+	resp, err := replica.serve(req, time.Now())
+
+	atomic.AddInt64(&replica.replicaReads, 1)
+	if err == nil && resp != nil && resp.Success && responseVersion(resp) < db.GetVersion(req.Path) {
+		atomic.AddInt64(&replica.replicaStale, 1)
+		replica.metricsMutex.Lock()
+		replica.metrics.StaleReads++
+		replica.metricsMutex.Unlock()
+	}
+
+	if resp != nil {
+		resp.HopsTrace = append([]string{db.ID}, resp.HopsTrace...)
+	}
+	return resp, err
+}
+
+func responseVersion(resp *engine.Response) int64 {
+	if resp.Metadata == nil {
+		return 0
+	}
+	version, _ := resp.Metadata["version"].(int64)
+	return version
+}
+
+func (db *Database) GetReplicaStats() []ReplicaStats {
+	replicas := db.GetReplicas()
+	stats := make([]ReplicaStats, 0, len(replicas))
+	for _, replica := range replicas {
+		stats = append(stats, ReplicaStats{
+			ID:         replica.ID,
+			Healthy:    replica.IsHealthy(),
+			Lag:        replica.GetLag(),
+			AppliedLSN: replica.GetAppliedLSN(),
+			Reads:      atomic.LoadInt64(&replica.replicaReads),
+			StaleReads: atomic.LoadInt64(&replica.replicaStale),
+		})
+	}
+	return stats
+}
+
+// GetLSN returns the log position of the latest committed write
+func (db *Database) GetLSN() int64 {
+	db.dataMutex.RLock()
+	defer db.dataMutex.RUnlock()
+
+	return db.lsn
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// A write the primary had not shipped when it went down waits on the
+// replica's pending log, without a goroutine, until the primary is back
+func TestReplicationWaitsForPrimary(t *testing.T) {
+	instance := config.GetDatabaseInstanceType("db.m5.large")
+	primary := NewDatabase("primary", DatabaseTypeSQL, "us-east-1", instance)
+	replica := NewDatabase("replica", DatabaseTypeSQL, "us-east-1", instance)
+	replica.ReplicationLag = 100 * time.Millisecond
+	primary.AddReplica(replica)
+
+	before := runtime.NumGoroutine()
+	resp, err := primary.Process(&engine.Request{ID: "w", Type: engine.RequestTypeWrite, Path: "/api/items/1", DataSize: 64})
+	if err != nil || !resp.Success {
+		t.Fatalf("write failed: %v", err)
+	}
+	primary.SetHealthy(false)
+
+	time.Sleep(2 * replica.ReplicationLag)
+	if leaked := runtime.NumGoroutine() - before; leaked > 0 {
+		t.Errorf("%d goroutines still waiting on the primary", leaked)
+	}
+	if replica.GetAppliedLSN() != 0 || replica.GetLag() == 0 {
+		t.Fatalf("replica applied a write its primary never shipped")
+	}
+
+	primary.Tick(time.Now())
+	if replica.GetAppliedLSN() != 0 {
+		t.Fatalf("replica caught up while its primary was down")
+	}
+
+	primary.SetHealthy(true)
+	primary.Tick(time.Now())
+	if replica.GetAppliedLSN() != primary.GetLSN() {
+		t.Errorf("replica at LSN %d after the primary came back, want %d", replica.GetAppliedLSN(), primary.GetLSN())
+	}
+	if replica.GetLag() != 0 {
+		t.Errorf("replica still lagging %v", replica.GetLag())
+	}
+}
@@ -0,0 +1,661 @@
+package database
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ShardingScheme string
+
+const (
+	// Contiguous ranges of the shard key in key order. Neighbouring keys
+	// share a shard, so sequential keys pile onto one of them.
+	ShardingRange ShardingScheme = "range"
+	// Contiguous ranges of the shard key's hash
+	ShardingHash ShardingScheme = "hash"
+	// Points on a hash ring, many per shard. A new shard takes a little of
+	// every other shard's keys.
+	ShardingConsistentHash ShardingScheme = "consistent-hash"
+)
+
+func GetShardingSchemes() []ShardingScheme {
+	return []ShardingScheme{ShardingRange, ShardingHash, ShardingConsistentHash}
+}
+
+const (
+	shardRingPoints = 64
+	// Keys kept per shard to find the middle of its key range
+	shardKeySample = 256
+	// Resharding copies data in large sequential chunks
+	migrationIOSize = 256 * 1024
+)
+
+type Shard struct {
+	ID        string
+	Database  *Database
+	HashRange [2]uint32 // hash scheme, inclusive
+	KeyRange  [2]string // range scheme, from inclusive to exclusive; an empty end is unbounded
+
+	requests     int64
+	lastRequests int64
+	rate         float64
+	sample       []string
+	sampleMutex  sync.Mutex
+}
+
+// record counts a request and keeps a uniform sample of the keys it hit
+func (s *Shard) record(key string) {
+	n := atomic.AddInt64(&s.requests, 1)
+
+	s.sampleMutex.Lock()
+	defer s.sampleMutex.Unlock()
+
+	if len(s.sample) < shardKeySample {
+		s.sample = append(s.sample, key)
+	} else if i := rand.Int63n(n); i < shardKeySample {
+		s.sample[i] = key
+	}
+}
+
+type ShardStats struct {
+	ID          string
+	Healthy     bool
+	KeyShare    float64 // share of the hash space it owns; 0 under range sharding
+	RequestRate float64 // requests a second over the last window
+	SizeBytes   int64
+	Hot         bool
+}
+
+// ShardMigration is resharding in progress: Target is taking over part of
+// the Sources' keys, which move across at the manager's MigrationRate
+type ShardMigration struct {
+	Target     string
+	Sources    []string
+	TotalBytes int64
+	MovedBytes int64
+	Started    time.Time
+
+	target   *Shard
+	sources  map[*Shard]float64 // share of each source's data that moves
+	previous func(key string) *Shard
+}
+
+func (m ShardMigration) Progress() float64 {
+	if m.TotalBytes == 0 {
+		return 1
+	}
+	return float64(m.MovedBytes) / float64(m.TotalBytes)
+}
+
+// migrated reports whether a moving key has been copied to the target yet.
+// Keys move in the order of an independent hash, so progress is spread over
+// the whole moving range.
+func (m *ShardMigration) migrated(key string, progress float64) bool {
+	return float64(keyPosition(key)%10000) < progress*10000
+}
+
+type shardPoint struct {
+	hash  uint32
+	shard *Shard
+}
+
+// ShardManager places keys on shards and reshards them online. A split or a
+// new shard starts a migration: the new layout applies at once, but keys
+// that have not been copied yet are still served by their previous shard.
+type ShardManager struct {
+	Scheme ShardingScheme
+	// MigrationRate is how many bytes a second resharding copies
+	MigrationRate int64
+	// HotShardFactor marks shards whose request rate or size is this many
+	// times the average
+	HotShardFactor float64
+
+	prefix    string
+	newShard  func(id string) *Database
+	shards    []*Shard
+	ring      []shardPoint
+	migration *ShardMigration
+	nextID    int
+	splits    int64
+	moved     int64
+	lastTick  time.Time
+	lastRates time.Time
+	mu        sync.RWMutex
+}
+
+func newShardManager(scheme ShardingScheme, prefix string, newShard func(id string) *Database) *ShardManager {
+	return &ShardManager{
+		Scheme:         scheme,
+		MigrationRate:  50 * 1024 * 1024,
+		HotShardFactor: 1.5,
+		prefix:         prefix,
+		newShard:       newShard,
+	}
+}
+
+// EnableSharding spreads the database over count new shards of its own
+// instance type, each holding an equal part of the dataset
+func (db *Database) EnableSharding(scheme ShardingScheme, count int) error {
+	if db.Sharding != nil {
+		return fmt.Errorf("database is already sharded")
+	}
+	if count < 1 {
+		return fmt.Errorf("need at least one shard")
+	}
+
+	manager := newShardManager(scheme, db.ID, func(id string) *Database {
+		shard := NewDatabase(id, db.Type, db.Region, db.InstanceType)
+		shard.NotFoundRate = db.NotFoundRate
+		shard.WorkingSetGB = 0
+		shard.Isolation = db.Isolation
+		shard.LockTimeout = db.LockTimeout
+		shard.CounterShards = db.CounterShards
+		shard.ConnectionTimeout = db.connectionTimeout()
+		return shard
+	})
+	for i := 0; i < count; i++ {
+		shard := &Shard{Database: manager.createShard()}
+		shard.ID = shard.Database.ID
+		shard.Database.WorkingSetGB = db.WorkingSetGB / float64(count)
+
+		switch scheme {
+		case ShardingRange:
+			// Even split of the first byte; real keys rarely spread that way
+			if i > 0 {
+				shard.KeyRange[0] = string([]byte{byte(256 * i / count)})
+			}
+			if i < count-1 {
+				shard.KeyRange[1] = string([]byte{byte(256 * (i + 1) / count)})
+			}
+		case ShardingHash:
+			width := uint64(math.MaxUint32+1) / uint64(count)
+			shard.HashRange[0] = uint32(uint64(i) * width)
+			shard.HashRange[1] = uint32(uint64(i+1)*width - 1)
+			if i == count-1 {
+				shard.HashRange[1] = math.MaxUint32
+			}
+		case ShardingConsistentHash:
+			manager.ring = append(manager.ring, ringPoints(shard)...)
+		}
+		manager.shards = append(manager.shards, shard)
+	}
+	sortRing(manager.ring)
+
+	db.Sharding = manager
+	return nil
+}
+
+func (m *ShardManager) createShard() *Database {
+	m.nextID++
+	return m.newShard(fmt.Sprintf("%s-shard-%d", m.prefix, m.nextID))
+}
+
+func (m *ShardManager) add(shard *Shard) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.shards = append(m.shards, shard)
+	if m.Scheme == ShardingConsistentHash {
+		m.ring = append(m.ring, ringPoints(shard)...)
+		sortRing(m.ring)
+	}
+}
+
+func ringPoints(shard *Shard) []shardPoint {
+	points := make([]shardPoint, 0, shardRingPoints)
+	for v := 0; v < shardRingPoints; v++ {
+		points = append(points, shardPoint{hash: hashKey(fmt.Sprintf("%s#%d", shard.ID, v)), shard: shard})
+	}
+	return points
+}
+
+func sortRing(ring []shardPoint) {
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// Mix the bits so similar keys and point names spread over the hash space
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return uint32(x >> 32)
+}
+
+func keyPosition(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// owner returns the shard a key belongs to in the current layout. The caller
+// holds m.mu.
+func (m *ShardManager) owner(key string) *Shard {
+	switch m.Scheme {
+	case ShardingRange:
+		for _, shard := range m.shards {
+			if key >= shard.KeyRange[0] && (shard.KeyRange[1] == "" || key < shard.KeyRange[1]) {
+				return shard
+			}
+		}
+	case ShardingConsistentHash:
+		return ringOwner(m.ring, hashKey(key))
+	default:
+		hash := hashKey(key)
+		for _, shard := range m.shards {
+			if hash >= shard.HashRange[0] && hash <= shard.HashRange[1] {
+				return shard
+			}
+		}
+	}
+	return nil
+}
+
+func ringOwner(ring []shardPoint, hash uint32) *Shard {
+	if len(ring) == 0 {
+		return nil
+	}
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+	if i == len(ring) {
+		i = 0
+	}
+	return ring[i].shard
+}
+
+// route picks the shard that serves a key, which is its previous shard while
+// a migration has not copied it yet
+func (m *ShardManager) route(key string) *Shard {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	shard := m.owner(key)
+	if mg := m.migration; mg != nil && shard == mg.target && !mg.migrated(key, mg.Progress()) {
+		shard = mg.previous(key)
+	}
+	return shard
+}
+
+func (m *ShardManager) GetShards() []*Shard {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]*Shard(nil), m.shards...)
+}
+
+func (m *ShardManager) find(id string) *Shard {
+	for _, shard := range m.shards {
+		if shard.ID == id {
+			return shard
+		}
+	}
+	return nil
+}
+
+// SplitShard moves half of a shard's keys to a new shard
+func (m *ShardManager) SplitShard(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.migration != nil {
+		return fmt.Errorf("resharding to %s is still in progress", m.migration.Target)
+	}
+	source := m.find(id)
+	if source == nil {
+		return fmt.Errorf("no shard %s", id)
+	}
+
+	target := &Shard{}
+	share := 0.5
+	switch m.Scheme {
+	case ShardingRange:
+		split, below, err := source.splitKey()
+		if err != nil {
+			return err
+		}
+		target.KeyRange = [2]string{split, source.KeyRange[1]}
+		source.KeyRange[1] = split
+		source.keepSample(func(key string) bool { return key < split })
+		share = 1 - below
+	case ShardingConsistentHash:
+		// The new shard takes the second half of each of the source's arcs
+		var points []shardPoint
+		for i, point := range m.ring {
+			if point.shard != source {
+				continue
+			}
+			prev := m.ring[(i+len(m.ring)-1)%len(m.ring)].hash
+			points = append(points, shardPoint{hash: prev + (point.hash-prev)/2, shard: target})
+		}
+		m.ring = append(m.ring, points...)
+		sortRing(m.ring)
+	default:
+		if source.HashRange[0] == source.HashRange[1] {
+			return fmt.Errorf("shard %s covers a single hash", id)
+		}
+		mid := source.HashRange[0] + (source.HashRange[1]-source.HashRange[0])/2
+		target.HashRange = [2]uint32{mid + 1, source.HashRange[1]}
+		source.HashRange[1] = mid
+	}
+
+	target.Database = m.createShard()
+	target.ID = target.Database.ID
+	m.shards = append(m.shards, target)
+	m.splits++
+
+	m.startMigration(target, map[*Shard]float64{source: share}, func(string) *Shard { return source })
+	return nil
+}
+
+// Rebalance adds a shard. Under consistent hashing it takes a share of every
+// shard; otherwise it splits the largest shard.
+func (m *ShardManager) Rebalance() error {
+	if m.Scheme != ShardingConsistentHash {
+		var largest *Shard
+		for _, shard := range m.GetShards() {
+			if largest == nil || shard.Database.storedBytes() > largest.Database.storedBytes() {
+				largest = shard
+			}
+		}
+		if largest == nil {
+			return fmt.Errorf("no shards")
+		}
+		return m.SplitShard(largest.ID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.migration != nil {
+		return fmt.Errorf("resharding to %s is still in progress", m.migration.Target)
+	}
+	if len(m.shards) == 0 {
+		return fmt.Errorf("no shards")
+	}
+
+	before := append([]shardPoint(nil), m.ring...)
+	owned := ringShares(before)
+
+	target := &Shard{Database: m.createShard()}
+	target.ID = target.Database.ID
+	m.shards = append(m.shards, target)
+	m.ring = append(m.ring, ringPoints(target)...)
+	sortRing(m.ring)
+
+	// Each source gives up the arcs in front of the new points
+	taken := make(map[*Shard]float64)
+	for i, point := range m.ring {
+		if point.shard != target {
+			continue
+		}
+		prev := m.ring[(i+len(m.ring)-1)%len(m.ring)].hash
+		taken[ringOwner(before, point.hash)] += float64(point.hash-prev) / (math.MaxUint32 + 1)
+	}
+	sources := make(map[*Shard]float64, len(taken))
+	for source, share := range taken {
+		if owned[source] > 0 {
+			sources[source] = share / owned[source]
+		}
+	}
+
+	m.startMigration(target, sources, func(key string) *Shard { return ringOwner(before, hashKey(key)) })
+	return nil
+}
+
+// ringShares returns the share of the hash space each shard owns
+func ringShares(ring []shardPoint) map[*Shard]float64 {
+	shares := make(map[*Shard]float64)
+	for i, point := range ring {
+		prev := ring[(i+len(ring)-1)%len(ring)].hash
+		shares[point.shard] += float64(point.hash-prev) / (math.MaxUint32 + 1)
+	}
+	return shares
+}
+
+// splitKey returns the median of the keys seen, and the share of them below it
+func (s *Shard) splitKey() (string, float64, error) {
+	s.sampleMutex.Lock()
+	keys := append([]string(nil), s.sample...)
+	s.sampleMutex.Unlock()
+
+	sort.Strings(keys)
+	for i := len(keys) / 2; i < len(keys); i++ {
+		if keys[i] > s.KeyRange[0] {
+			return keys[i], float64(i) / float64(len(keys)), nil
+		}
+	}
+	return "", 0, fmt.Errorf("shard %s has no traffic to split on", s.ID)
+}
+
+func (s *Shard) keepSample(keep func(key string) bool) {
+	s.sampleMutex.Lock()
+	defer s.sampleMutex.Unlock()
+
+	kept := s.sample[:0]
+	for _, key := range s.sample {
+		if keep(key) {
+			kept = append(kept, key)
+		}
+	}
+	s.sample = kept
+}
+
+// startMigration begins copying the moving keys to target. The caller holds
+// m.mu.
+func (m *ShardManager) startMigration(target *Shard, sources map[*Shard]float64, previous func(key string) *Shard) {
+	mg := &ShardMigration{
+		Target:   target.ID,
+		Started:  time.Now(),
+		target:   target,
+		sources:  sources,
+		previous: previous,
+	}
+	for source, share := range sources {
+		mg.Sources = append(mg.Sources, source.ID)
+		mg.TotalBytes += int64(float64(source.Database.storedBytes()) * share)
+	}
+	sort.Strings(mg.Sources)
+	m.migration = mg
+}
+
+// Tick copies the next chunk of a running migration and refreshes the
+// request rates hot shards are picked by
+func (m *ShardManager) Tick(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lastRates.IsZero() {
+		m.lastRates = now
+	} else if elapsed := now.Sub(m.lastRates); elapsed >= time.Second {
+		for _, shard := range m.shards {
+			requests := atomic.LoadInt64(&shard.requests)
+			shard.rate = float64(requests-shard.lastRequests) / elapsed.Seconds()
+			shard.lastRequests = requests
+		}
+		m.lastRates = now
+	}
+
+	last := m.lastTick
+	m.lastTick = now
+	mg := m.migration
+	if mg == nil || last.IsZero() {
+		return
+	}
+
+	before := mg.Progress()
+	chunk := int64(float64(m.MigrationRate) * now.Sub(last).Seconds())
+	mg.MovedBytes += chunk
+	if mg.MovedBytes > mg.TotalBytes {
+		mg.MovedBytes = mg.TotalBytes
+	}
+	after := mg.Progress()
+
+	// Reading from the sources and writing to the target costs IOs that
+	// queries then wait behind
+	ios := int(chunk / migrationIOSize)
+	mg.target.Database.backgroundIO(ios)
+	for source := range mg.sources {
+		source.Database.backgroundIO(ios / len(mg.sources))
+	}
+
+	for source := range mg.sources {
+		m.copyKeys(source, mg, before, after)
+	}
+
+	if after >= 1 {
+		for source, share := range mg.sources {
+			source.Database.dataMutex.Lock()
+			moved := source.Database.WorkingSetGB * share
+			source.Database.WorkingSetGB -= moved
+			source.Database.dataMutex.Unlock()
+
+			mg.target.Database.dataMutex.Lock()
+			mg.target.Database.WorkingSetGB += moved
+			mg.target.Database.dataMutex.Unlock()
+
+			m.dropMoved(source, mg.target)
+		}
+		m.moved += mg.TotalBytes
+		m.migration = nil
+	}
+}
+
+// copyKeys copies the written keys whose turn to move came between two
+// progress points. Writes to a key after its turn already go to the target.
+func (m *ShardManager) copyKeys(source *Shard, mg *ShardMigration, before, after float64) {
+	from := source.Database
+	to := mg.target.Database
+
+	from.dataMutex.RLock()
+	type written struct {
+		key      string
+		shardKey string
+		value    []byte
+		version  int64
+	}
+	var batch []written
+	for key, value := range from.data {
+		// Rows move with the key they are routed by, not their path
+		sharded := from.rowShardKey(key)
+		if m.owner(sharded) != mg.target || mg.migrated(sharded, before) || !mg.migrated(sharded, after) {
+			continue
+		}
+		batch = append(batch, written{key: key, shardKey: sharded, value: value, version: from.versions[key]})
+	}
+	from.dataMutex.RUnlock()
+
+	to.dataMutex.Lock()
+	for _, w := range batch {
+		to.UsedCapacity += int64(len(w.value)) - int64(len(to.data[w.key]))
+		to.data[w.key] = w.value
+		to.versions[w.key] = w.version
+		to.setShardKey(w.key, w.shardKey)
+	}
+	to.dataMutex.Unlock()
+}
+
+// dropMoved deletes the keys a finished migration moved off a source
+func (m *ShardManager) dropMoved(source, target *Shard) {
+	db := source.Database
+	db.dataMutex.Lock()
+	defer db.dataMutex.Unlock()
+
+	for key, value := range db.data {
+		if m.owner(db.rowShardKey(key)) == target {
+			db.UsedCapacity -= int64(len(value))
+			delete(db.data, key)
+			delete(db.versions, key)
+			delete(db.shardKeys, key)
+		}
+	}
+}
+
+func (m *ShardManager) GetMigration() *ShardMigration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.migration == nil {
+		return nil
+	}
+	copied := *m.migration
+	return &copied
+}
+
+// GetStats reports each shard's load. A shard is hot when its request rate
+// or size is HotShardFactor times the average.
+func (m *ShardManager) GetStats() []ShardStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var shares map[*Shard]float64
+	if m.Scheme == ShardingConsistentHash {
+		shares = ringShares(m.ring)
+	}
+
+	stats := make([]ShardStats, 0, len(m.shards))
+	var totalRate float64
+	var totalSize int64
+	for _, shard := range m.shards {
+		stat := ShardStats{
+			ID:          shard.ID,
+			Healthy:     shard.Database.IsHealthy(),
+			RequestRate: shard.rate,
+			SizeBytes:   shard.Database.storedBytes(),
+		}
+		switch m.Scheme {
+		case ShardingHash:
+			stat.KeyShare = (float64(shard.HashRange[1]-shard.HashRange[0]) + 1) / (math.MaxUint32 + 1)
+		case ShardingConsistentHash:
+			stat.KeyShare = shares[shard]
+		}
+		totalRate += stat.RequestRate
+		totalSize += stat.SizeBytes
+		stats = append(stats, stat)
+	}
+
+	if len(stats) > 1 {
+		meanRate := totalRate / float64(len(stats))
+		meanSize := float64(totalSize) / float64(len(stats))
+		for i := range stats {
+			stats[i].Hot = (meanRate >= 1 && stats[i].RequestRate > m.HotShardFactor*meanRate) ||
+				(meanSize > 0 && float64(stats[i].SizeBytes) > m.HotShardFactor*meanSize)
+		}
+	}
+	return stats
+}
+
+func (m *ShardManager) HotShards() int {
+	hot := 0
+	for _, stat := range m.GetStats() {
+		if stat.Hot {
+			hot++
+		}
+	}
+	return hot
+}
+
+// GetSplits returns how many shards were split by hand, and how many bytes
+// finished migrations moved
+func (m *ShardManager) GetSplits() (int64, int64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.splits, m.moved
+}
+
+func (m *ShardManager) GetCost() float64 {
+	cost := 0.0
+	for _, shard := range m.GetShards() {
+		cost += shard.Database.GetCost()
+	}
+	return cost
+}
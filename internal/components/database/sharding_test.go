@@ -0,0 +1,126 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// Rows whose path names no row id are routed by user but stored by path, so
+// resharding has to move each one with its user for the user to keep
+// finding it
+func TestReshardingKeepsUserRows(t *testing.T) {
+	for _, scheme := range GetShardingSchemes() {
+		t.Run(string(scheme), func(t *testing.T) {
+			db := NewDatabase("db", DatabaseTypeSQL, "us-east-1", config.GetDatabaseInstanceType("db.m5.large"))
+			// Every row a read misses shows up as not found
+			db.NotFoundRate = 1
+			// Only the rows written here, so migrations finish in a few ticks
+			db.WorkingSetGB = 0
+			if err := db.EnableSharding(scheme, 2); err != nil {
+				t.Fatal(err)
+			}
+
+			const users, rowsPerUser = 16, 4
+			for u := 0; u < users; u++ {
+				for r := 0; r < rowsPerUser; r++ {
+					resp, err := db.Process(userRequest(engine.RequestTypeWrite, u, r))
+					if err != nil || !resp.Success {
+						t.Fatalf("writing user %d row %d: %v", u, r, err)
+					}
+				}
+			}
+
+			reshard(t, db, func() error { return db.Sharding.SplitShard(db.Sharding.GetShards()[0].ID) })
+			reshard(t, db, db.Sharding.Rebalance)
+
+			for u := 0; u < users; u++ {
+				for r := 0; r < rowsPerUser; r++ {
+					resp, err := db.Process(userRequest(engine.RequestTypeRead, u, r))
+					if err != nil || !resp.Success {
+						t.Fatalf("reading user %d row %d: %v", u, r, err)
+					}
+					if resp.Metadata["not_found"] == true {
+						t.Errorf("user %d row %d is missing after resharding", u, r)
+					}
+				}
+			}
+		})
+	}
+}
+
+// reshard starts a migration and ticks the manager until it finishes
+func reshard(t *testing.T, db *Database, start func() error) {
+	t.Helper()
+
+	if err := start(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	db.Sharding.Tick(now)
+	for i := 0; db.Sharding.GetMigration() != nil; i++ {
+		if i == 100 {
+			t.Fatal("migration never finished")
+		}
+		now = now.Add(100 * time.Millisecond)
+		db.Sharding.Tick(now)
+	}
+}
+
+func userRequest(requestType engine.RequestType, user, row int) *engine.Request {
+	return &engine.Request{
+		ID:       fmt.Sprintf("req-%d-%d", user, row),
+		Type:     requestType,
+		Path:     fmt.Sprintf("/api/saved/%c%c", 'a'+user, 'a'+row),
+		UserID:   fmt.Sprintf("user-%d", user),
+		DataSize: 1024,
+	}
+}
+
+// Writes to one row from many users land on the shard holding the row, and
+// queue for its lock there
+func TestShardedHotRowContends(t *testing.T) {
+	db := NewDatabase("db", DatabaseTypeSQL, "us-east-1", config.GetDatabaseInstanceType("db.m5.large"))
+	if err := db.EnableSharding(ShardingHash, 4); err != nil {
+		t.Fatal(err)
+	}
+	db.SetLockSettings(IsolationRepeatableRead, 2*time.Second, 1)
+	for _, shard := range db.Sharding.GetShards() {
+		if shard.Database.Isolation != IsolationRepeatableRead || shard.Database.LockTimeout != 2*time.Second {
+			t.Fatalf("shard %s kept isolation %s and lock timeout %v", shard.ID, shard.Database.Isolation, shard.Database.LockTimeout)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for u := 0; u < 16; u++ {
+		wg.Add(1)
+		go func(u int) {
+			defer wg.Done()
+			db.Process(&engine.Request{
+				ID:       fmt.Sprintf("req-%d", u),
+				Type:     engine.RequestTypeWrite,
+				Path:     "/api/products/7/inventory",
+				UserID:   fmt.Sprintf("user-%d", u),
+				DataSize: 64,
+			})
+		}(u)
+	}
+	wg.Wait()
+
+	holding := 0
+	for _, shard := range db.Sharding.GetShards() {
+		if shard.Database.GetVersion("/api/products/7/inventory") > 0 {
+			holding++
+		}
+	}
+	if holding != 1 {
+		t.Errorf("%d shards hold the row, want 1", holding)
+	}
+	if stats := db.GetLockStats(); stats.Waits == 0 || stats.SerializationFailures == 0 {
+		t.Errorf("no contention on the hot row: %+v", stats)
+	}
+}
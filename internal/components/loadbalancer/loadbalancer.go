@@ -16,46 +16,146 @@ const (
 	StrategyLeastConnected LoadBalancingStrategy = "least-connected"
 	StrategyWeightedRandom LoadBalancingStrategy = "weighted-random"
 	StrategyIPHash         LoadBalancingStrategy = "ip-hash"
+	StrategyConsistentHash LoadBalancingStrategy = "consistent-hash"
+	StrategyPowerOfTwo     LoadBalancingStrategy = "power-of-two"
+	StrategyLeastResponse  LoadBalancingStrategy = "least-response-time"
+	StrategyMaglev         LoadBalancingStrategy = "maglev"
 )
 
+func GetStrategies() []LoadBalancingStrategy {
+	return []LoadBalancingStrategy{
+		StrategyRoundRobin,
+		StrategyWeightedRandom,
+		StrategyLeastConnected,
+		StrategyPowerOfTwo,
+		StrategyLeastResponse,
+		StrategyIPHash,
+		StrategyConsistentHash,
+		StrategyMaglev,
+	}
+}
+
 type LoadBalancer struct {
 	ID            string
 	Region        string
 	Strategy      LoadBalancingStrategy
 	Backends      []engine.Component
+	backendsMutex sync.RWMutex
 	currentIndex  uint64
 	healthy       bool
 	metrics       *engine.Metrics
 	metricsMutex  sync.RWMutex
 	costPerHour   float64
-	connections   map[string]int
+	connections   map[string]int // in-flight requests per backend
+	requestCounts map[string]int64
+	latencyEWMA   map[string]float64
+	weights       map[string]int
 	connMutex     sync.RWMutex
+	ring          []ringNode
+	maglev        *maglevTable
+	hashMutex     sync.Mutex
+	healthChecker *engine.HealthChecker
+
+	OutlierDetection OutlierDetectionConfig
+	outliers         map[string]*outlierState
+	outlierMutex     sync.Mutex
+
+	Stickiness    StickinessConfig
+	rules         []*ListenerRule
+	rulesMutex    sync.RWMutex
+	affinity      map[string]affinityEntry
+	affinityMutex sync.Mutex
+	cookieCounter uint64
 }
 
 func NewLoadBalancer(id, region string, strategy LoadBalancingStrategy) *LoadBalancer {
 	return &LoadBalancer{
-		ID:          id,
-		Region:      region,
-		Strategy:    strategy,
-		Backends:    make([]engine.Component, 0),
-		healthy:     true,
-		metrics:     &engine.Metrics{},
-		costPerHour: 0.025,
-		connections: make(map[string]int),
+		ID:            id,
+		Region:        region,
+		Strategy:      strategy,
+		Backends:      make([]engine.Component, 0),
+		healthy:       true,
+		metrics:       &engine.Metrics{},
+		costPerHour:   0.025,
+		connections:   make(map[string]int),
+		requestCounts: make(map[string]int64),
+		latencyEWMA:   make(map[string]float64),
+		weights:       make(map[string]int),
+
+		OutlierDetection: DefaultOutlierDetection,
+		outliers:         make(map[string]*outlierState),
+
+		Stickiness: StickinessConfig{Source: AffinityNone, CookieName: defaultAffinityCookie, Duration: 5 * time.Minute},
+		affinity:   make(map[string]affinityEntry),
 	}
 }
 
 func (lb *LoadBalancer) AddBackend(backend engine.Component) {
+	lb.backendsMutex.Lock()
+	for _, existing := range lb.Backends {
+		if existing.GetID() == backend.GetID() {
+			lb.backendsMutex.Unlock()
+			return
+		}
+	}
 	lb.Backends = append(lb.Backends, backend)
+
+	if lb.healthChecker != nil {
+		lb.healthChecker.AddTarget(backend)
+	}
+	lb.backendsMutex.Unlock()
+
+	// A backend joining a pool that is already serving starts cold
+	if lb.GetMetrics().RequestCount > 0 {
+		lb.markWarming(backend.GetID())
+	}
+
+	lb.invalidateHashing()
 }
 
 func (lb *LoadBalancer) RemoveBackend(backendID string) {
+	lb.backendsMutex.Lock()
 	for i, backend := range lb.Backends {
 		if backend.GetID() == backendID {
 			lb.Backends = append(lb.Backends[:i], lb.Backends[i+1:]...)
-			return
+			if lb.healthChecker != nil {
+				lb.healthChecker.RemoveTarget(backendID)
+			}
+			break
 		}
 	}
+	lb.backendsMutex.Unlock()
+
+	lb.connMutex.Lock()
+	delete(lb.connections, backendID)
+	delete(lb.requestCounts, backendID)
+	delete(lb.latencyEWMA, backendID)
+	delete(lb.weights, backendID)
+	lb.connMutex.Unlock()
+
+	lb.forgetOutlier(backendID)
+	lb.invalidateHashing()
+}
+
+// SetHealthChecker makes the load balancer route by the checker's probe
+// results instead of each backend's actual state
+func (lb *LoadBalancer) SetHealthChecker(hc *engine.HealthChecker) {
+	lb.backendsMutex.Lock()
+	defer lb.backendsMutex.Unlock()
+
+	lb.healthChecker = hc
+	for _, backend := range lb.Backends {
+		hc.AddTarget(backend)
+	}
+}
+
+func (lb *LoadBalancer) GetBackends() []engine.Component {
+	lb.backendsMutex.RLock()
+	defer lb.backendsMutex.RUnlock()
+
+	backends := make([]engine.Component, len(lb.Backends))
+	copy(backends, lb.Backends)
+	return backends
 }
 
 func (lb *LoadBalancer) GetID() string {
@@ -66,6 +166,10 @@ func (lb *LoadBalancer) GetType() string {
 	return "load-balancer"
 }
 
+func (lb *LoadBalancer) GetRegion() string {
+	return lb.Region
+}
+
 func (lb *LoadBalancer) Process(req *engine.Request) (*engine.Response, error) {
 	start := time.Now()
 	
@@ -85,7 +189,7 @@ func (lb *LoadBalancer) Process(req *engine.Request) (*engine.Response, error) {
 		}, fmt.Errorf("load balancer is unhealthy")
 	}
 
-	backend := lb.selectBackend(req)
+	backend, setCookie := lb.selectBackend(req)
 	if backend == nil {
 		lb.metricsMutex.Lock()
 		lb.metrics.FailureCount++
@@ -98,15 +202,26 @@ func (lb *LoadBalancer) Process(req *engine.Request) (*engine.Response, error) {
 		}, fmt.Errorf("no healthy backends available")
 	}
 
+	// Count the request against the backend as soon as it is picked so
+	// concurrent selections see it
+	endRequest := lb.beginRequest(backend)
+
 	lbLatency := time.Millisecond * 2
 	time.Sleep(lbLatency)
 
+	backendStart := time.Now()
 	resp, err := backend.Process(req)
+	endRequest(time.Since(backendStart))
+	// A request the backend blocked on purpose says nothing about its health
+	blocked := resp != nil && resp.Blocked
+	lb.recordOutcome(backend, blocked || err == nil && resp != nil && resp.Success)
 	
 	totalLatency := time.Since(start)
 	
 	lb.metricsMutex.Lock()
-	if err == nil && resp.Success {
+	if blocked {
+		lb.metrics.BlockedRequests++
+	} else if err == nil && resp.Success {
 		lb.metrics.SuccessCount++
 	} else {
 		lb.metrics.FailureCount++
@@ -118,49 +233,78 @@ func (lb *LoadBalancer) Process(req *engine.Request) (*engine.Response, error) {
 	if resp != nil {
 		resp.Latency = totalLatency
 		resp.HopsTrace = append([]string{lb.ID}, resp.HopsTrace...)
+		if setCookie != "" {
+			if resp.Metadata == nil {
+				resp.Metadata = make(map[string]interface{})
+			}
+			resp.Metadata["Set-Cookie"] = setCookie
+		}
 	}
 
 	return resp, err
 }
 
-func (lb *LoadBalancer) selectBackend(req *engine.Request) engine.Component {
+// selectBackend picks the backend for a request and, with cookie affinity,
+// the session cookie to hand back to the client
+func (lb *LoadBalancer) selectBackend(req *engine.Request) (engine.Component, string) {
 	healthyBackends := make([]engine.Component, 0)
-	for _, backend := range lb.Backends {
-		if backend.IsHealthy() {
+	lb.backendsMutex.RLock()
+	hc := lb.healthChecker
+	lb.backendsMutex.RUnlock()
+
+	client, setCookie := lb.clientKey(req)
+	backends, key, group := lb.routeBackends(req, client)
+	for _, backend := range backends {
+		inService := backend.IsHealthy()
+		if hc != nil {
+			inService = hc.IsInService(backend)
+		}
+		if inService {
 			healthyBackends = append(healthyBackends, backend)
 		}
 	}
 
 	if len(healthyBackends) == 0 {
-		return nil
+		return nil, ""
 	}
 
+	candidates := lb.filterOutliers(backends, healthyBackends)
+
+	if sticky := lb.stickyBackend(key, group, candidates); sticky != nil {
+		return sticky, ""
+	}
+
+	selected := lb.applySlowStart(lb.selectByStrategy(req, candidates), candidates)
+	lb.pin(key, group, selected)
+	return selected, setCookie
+}
+
+func (lb *LoadBalancer) selectByStrategy(req *engine.Request, backends []engine.Component) engine.Component {
 	switch lb.Strategy {
-	case StrategyRoundRobin:
-		index := atomic.AddUint64(&lb.currentIndex, 1)
-		return healthyBackends[index%uint64(len(healthyBackends))]
-	
+	case StrategyWeightedRandom:
+		return lb.selectWeightedRandom(backends)
 	case StrategyLeastConnected:
-		lb.connMutex.RLock()
-		defer lb.connMutex.RUnlock()
-		
-		minConn := int(^uint(0) >> 1)
-		var selected engine.Component
-		for _, backend := range healthyBackends {
-			conn := lb.connections[backend.GetID()]
-			if conn < minConn {
-				minConn = conn
-				selected = backend
-			}
-		}
-		return selected
-	
+		return lb.selectLeastConnected(backends)
+	case StrategyPowerOfTwo:
+		return lb.selectPowerOfTwo(backends)
+	case StrategyLeastResponse:
+		return lb.selectLeastResponseTime(backends)
+	case StrategyIPHash:
+		return lb.selectIPHash(req, backends)
+	case StrategyConsistentHash:
+		return lb.selectConsistentHash(req, backends)
+	case StrategyMaglev:
+		return lb.selectMaglev(req, backends)
 	default:
-		index := atomic.AddUint64(&lb.currentIndex, 1)
-		return healthyBackends[index%uint64(len(healthyBackends))]
+		index := lb.nextIndex()
+		return backends[index%uint64(len(backends))]
 	}
 }
 
+func (lb *LoadBalancer) nextIndex() uint64 {
+	return atomic.AddUint64(&lb.currentIndex, 1)
+}
+
 func (lb *LoadBalancer) GetMetrics() *engine.Metrics {
 	lb.metricsMutex.RLock()
 	defer lb.metricsMutex.RUnlock()
@@ -0,0 +1,33 @@
+package loadbalancer
+
+import (
+	"testing"
+	"time"
+)
+
+// Removing a backend forgets its counters and weight, including latency an
+// in-flight request reports after it is gone
+func TestRemoveBackendForgetsStats(t *testing.T) {
+	lb := NewLoadBalancer("lb", "us-east-1", StrategyRoundRobin)
+	backend := &stubBackend{id: "api-1"}
+	lb.AddBackend(backend)
+	lb.SetWeight("api-1", 5)
+
+	lb.beginRequest(backend)(10 * time.Millisecond)
+	end := lb.beginRequest(backend)
+	lb.RemoveBackend("api-1")
+	end(10 * time.Millisecond)
+
+	lb.connMutex.RLock()
+	defer lb.connMutex.RUnlock()
+	for name, size := range map[string]int{
+		"connections":   len(lb.connections),
+		"requestCounts": len(lb.requestCounts),
+		"latencyEWMA":   len(lb.latencyEWMA),
+		"weights":       len(lb.weights),
+	} {
+		if size != 0 {
+			t.Errorf("%s still holds %d entries", name, size)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package loadbalancer
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+type BackendState string
+
+const (
+	BackendStateActive    BackendState = "active"
+	BackendStateEjected   BackendState = "ejected"
+	BackendStateSlowStart BackendState = "slow-start"
+)
+
+// OutlierDetectionConfig controls passive outlier detection: backends are
+// ejected from the pool based on the responses they return, without waiting
+// for a health check to notice.
+type OutlierDetectionConfig struct {
+	Enabled            bool
+	ConsecutiveErrors  int
+	LatencyMultiplier  float64 // eject when EWMA latency exceeds this multiple of the pool median
+	MinRequests        int     // samples needed before latency is judged
+	BaseEjectionTime   time.Duration
+	MaxEjectionPercent int
+	SlowStartWindow    time.Duration // ramp for returning backends; 0 disables
+}
+
+var DefaultOutlierDetection = OutlierDetectionConfig{
+	Enabled:            true,
+	ConsecutiveErrors:  5,
+	LatencyMultiplier:  3.0,
+	MinRequests:        20,
+	BaseEjectionTime:   5 * time.Second,
+	MaxEjectionPercent: 50,
+	SlowStartWindow:    10 * time.Second,
+}
+
+// OutlierStats summarises outlier detection across the load balancer
+type OutlierStats struct {
+	TotalEjections int
+	Ejected        int
+	SlowStarting   int
+}
+
+type outlierState struct {
+	consecutiveErrors int
+	samples           int
+	ejections         int
+	ejectedUntil      time.Time
+	warmingSince      time.Time
+	wasInService      bool
+	seen              bool
+}
+
+func (lb *LoadBalancer) outlier(id string) *outlierState {
+	state, exists := lb.outliers[id]
+	if !exists {
+		state = &outlierState{}
+		lb.outliers[id] = state
+	}
+	return state
+}
+
+// recordOutcome feeds a backend response into outlier detection
+func (lb *LoadBalancer) recordOutcome(backend engine.Component, success bool) {
+	lb.outlierMutex.Lock()
+	defer lb.outlierMutex.Unlock()
+
+	config := lb.OutlierDetection
+	if !config.Enabled {
+		return
+	}
+
+	now := time.Now()
+	id := backend.GetID()
+	state := lb.outlier(id)
+	state.samples++
+
+	if success {
+		state.consecutiveErrors = 0
+	} else {
+		state.consecutiveErrors++
+	}
+
+	if now.Before(state.ejectedUntil) {
+		return
+	}
+
+	if config.ConsecutiveErrors > 0 && state.consecutiveErrors >= config.ConsecutiveErrors {
+		lb.eject(id, state, now)
+		return
+	}
+
+	if config.LatencyMultiplier > 0 && state.samples >= config.MinRequests && lb.isLatencyOutlier(id) {
+		lb.eject(id, state, now)
+	}
+}
+
+// isLatencyOutlier compares a backend's EWMA latency against the median of
+// the other backends
+func (lb *LoadBalancer) isLatencyOutlier(id string) bool {
+	lb.connMutex.RLock()
+	defer lb.connMutex.RUnlock()
+
+	latency, measured := lb.latencyEWMA[id]
+	if !measured {
+		return false
+	}
+
+	others := make([]float64, 0)
+	for otherID, other := range lb.latencyEWMA {
+		if otherID != id {
+			others = append(others, other)
+		}
+	}
+	if len(others) == 0 {
+		return false
+	}
+
+	sort.Float64s(others)
+	median := others[len(others)/2]
+	return median > 0 && latency > median*lb.OutlierDetection.LatencyMultiplier
+}
+
+// eject removes a backend from rotation unless that would push the share of
+// ejected backends over the cap. Each repeat ejection lasts longer.
+func (lb *LoadBalancer) eject(id string, state *outlierState, now time.Time) {
+	total := len(lb.GetBackends())
+	ejected := 0
+	for _, other := range lb.outliers {
+		if now.Before(other.ejectedUntil) {
+			ejected++
+		}
+	}
+	if total == 0 || (ejected+1)*100 > total*lb.OutlierDetection.MaxEjectionPercent {
+		return
+	}
+
+	state.ejections++
+	state.ejectedUntil = now.Add(lb.OutlierDetection.BaseEjectionTime * time.Duration(state.ejections))
+	state.consecutiveErrors = 0
+	state.samples = 0
+	state.warmingSince = state.ejectedUntil
+
+	// Forget the latency that got it ejected so it is judged afresh on return
+	lb.connMutex.Lock()
+	delete(lb.latencyEWMA, id)
+	lb.connMutex.Unlock()
+}
+
+// filterOutliers drops ejected backends from the candidates and notes the
+// ones that just came (back) into service so they can warm up
+func (lb *LoadBalancer) filterOutliers(all, inService []engine.Component) []engine.Component {
+	lb.outlierMutex.Lock()
+	defer lb.outlierMutex.Unlock()
+
+	now := time.Now()
+	serving := make(map[string]bool, len(inService))
+	for _, backend := range inService {
+		serving[backend.GetID()] = true
+	}
+
+	// Backends recovering from a failed health check warm up as well
+	for _, backend := range all {
+		state := lb.outlier(backend.GetID())
+		if serving[backend.GetID()] && state.seen && !state.wasInService {
+			state.warmingSince = now
+		}
+		state.wasInService = serving[backend.GetID()]
+		state.seen = true
+	}
+
+	if !lb.OutlierDetection.Enabled {
+		return inService
+	}
+
+	candidates := make([]engine.Component, 0, len(inService))
+	for _, backend := range inService {
+		if now.Before(lb.outlier(backend.GetID()).ejectedUntil) {
+			continue
+		}
+		candidates = append(candidates, backend)
+	}
+
+	// With everything left ejected, routing to an outlier beats failing
+	if len(candidates) == 0 {
+		return inService
+	}
+	return candidates
+}
+
+// applySlowStart gives a backend that is still warming up only a share of
+// the traffic its strategy picked for it, growing linearly over the window.
+// Declined requests go to a fully warm backend instead.
+func (lb *LoadBalancer) applySlowStart(selected engine.Component, candidates []engine.Component) engine.Component {
+	// Hashing strategies skip the ramp so clients stay sticky
+	window := lb.OutlierDetection.SlowStartWindow
+	if window <= 0 || selected == nil || lb.isHashing() {
+		return selected
+	}
+
+	lb.outlierMutex.Lock()
+	defer lb.outlierMutex.Unlock()
+
+	ramp := lb.rampLocked(selected.GetID())
+	if ramp >= 1 || rand.Float64() < ramp {
+		return selected
+	}
+
+	warm := make([]engine.Component, 0, len(candidates))
+	for _, backend := range candidates {
+		if lb.rampLocked(backend.GetID()) >= 1 {
+			warm = append(warm, backend)
+		}
+	}
+	if len(warm) == 0 {
+		return selected
+	}
+	return warm[rand.Intn(len(warm))]
+}
+
+func (lb *LoadBalancer) isHashing() bool {
+	switch lb.Strategy {
+	case StrategyIPHash, StrategyConsistentHash, StrategyMaglev:
+		return true
+	}
+	return false
+}
+
+func (lb *LoadBalancer) rampLocked(id string) float64 {
+	state, exists := lb.outliers[id]
+	if !exists || state.warmingSince.IsZero() {
+		return 1
+	}
+
+	ramp := float64(time.Since(state.warmingSince)) / float64(lb.OutlierDetection.SlowStartWindow)
+	if ramp < 0.1 {
+		return 0.1
+	}
+	return ramp
+}
+
+// markWarming starts the slow-start ramp for a backend joining a pool that is
+// already serving traffic
+func (lb *LoadBalancer) markWarming(id string) {
+	lb.outlierMutex.Lock()
+	defer lb.outlierMutex.Unlock()
+
+	lb.outlier(id).warmingSince = time.Now()
+}
+
+func (lb *LoadBalancer) forgetOutlier(id string) {
+	lb.outlierMutex.Lock()
+	defer lb.outlierMutex.Unlock()
+
+	delete(lb.outliers, id)
+}
+
+func (lb *LoadBalancer) GetBackendState(id string) BackendState {
+	lb.outlierMutex.Lock()
+	defer lb.outlierMutex.Unlock()
+
+	state, exists := lb.outliers[id]
+	if !exists {
+		return BackendStateActive
+	}
+	if time.Now().Before(state.ejectedUntil) {
+		return BackendStateEjected
+	}
+	if lb.OutlierDetection.SlowStartWindow > 0 && lb.rampLocked(id) < 1 {
+		return BackendStateSlowStart
+	}
+	return BackendStateActive
+}
+
+// IsOutlier reports whether a backend is ejected or still warming up
+func (lb *LoadBalancer) IsOutlier(backendID string) (bool, bool) {
+	state := lb.GetBackendState(backendID)
+	return state == BackendStateEjected, state == BackendStateSlowStart
+}
+
+func (lb *LoadBalancer) GetEjectedCount() int {
+	return lb.GetOutlierStats().Ejected
+}
+
+func (lb *LoadBalancer) GetOutlierStats() OutlierStats {
+	stats := OutlierStats{}
+	for _, backend := range lb.GetBackends() {
+		switch lb.GetBackendState(backend.GetID()) {
+		case BackendStateEjected:
+			stats.Ejected++
+		case BackendStateSlowStart:
+			stats.SlowStarting++
+		}
+	}
+
+	lb.outlierMutex.Lock()
+	for _, state := range lb.outliers {
+		stats.TotalEjections += state.ejections
+	}
+	lb.outlierMutex.Unlock()
+
+	return stats
+}
@@ -0,0 +1,371 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+type AffinitySource string
+
+const (
+	AffinityNone   AffinitySource = "none"
+	AffinityCookie AffinitySource = "cookie"
+	AffinityUserID AffinitySource = "user-id"
+)
+
+const defaultAffinityCookie = "LBSESSION"
+
+// RuleCondition matches requests on layer-7 attributes. Every condition that
+// is set must match; a rule with no conditions matches everything.
+type RuleCondition struct {
+	PathPrefix   string
+	PathRegex    *regexp.Regexp
+	Headers      map[string]string
+	RequestTypes []engine.RequestType
+}
+
+// TargetGroup is a named set of backends a rule forwards to. When a rule has
+// several groups, traffic is split between them by weight.
+type TargetGroup struct {
+	Name       string
+	BackendIDs []string
+	Weight     int
+}
+
+type ListenerRule struct {
+	Priority     int
+	Name         string
+	Condition    RuleCondition
+	TargetGroups []TargetGroup
+
+	matches int64
+}
+
+// StickinessConfig pins a client to the backend that first served it for
+// Duration. Cookie affinity relies on the client echoing the cookie the load
+// balancer issues; user-id affinity keys on Request.UserID.
+type StickinessConfig struct {
+	Source     AffinitySource
+	CookieName string
+	Duration   time.Duration
+}
+
+// affinityEntry pins a client within a rule: to the target group it was
+// sent to, and the backend in that group
+type affinityEntry struct {
+	group     string
+	backendID string
+	expires   time.Time
+}
+
+func (c RuleCondition) Matches(req *engine.Request) bool {
+	if c.PathPrefix != "" && !strings.HasPrefix(req.Path, c.PathPrefix) {
+		return false
+	}
+	if c.PathRegex != nil && !c.PathRegex.MatchString(req.Path) {
+		return false
+	}
+	for name, value := range c.Headers {
+		if req.Headers[name] != value {
+			return false
+		}
+	}
+	if len(c.RequestTypes) > 0 {
+		for _, reqType := range c.RequestTypes {
+			if req.Type == reqType {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (r *ListenerRule) GetMatches() int64 {
+	return atomic.LoadInt64(&r.matches)
+}
+
+// AddRule adds a listener rule. Rules are evaluated in priority order
+// (lowest first); requests matching none go to all backends.
+func (lb *LoadBalancer) AddRule(rule *ListenerRule) {
+	lb.rulesMutex.Lock()
+	defer lb.rulesMutex.Unlock()
+
+	lb.rules = append(lb.rules, rule)
+	sort.SliceStable(lb.rules, func(i, j int) bool { return lb.rules[i].Priority < lb.rules[j].Priority })
+}
+
+func (lb *LoadBalancer) SetRules(rules []*ListenerRule) {
+	lb.rulesMutex.Lock()
+	lb.rules = nil
+	lb.rulesMutex.Unlock()
+
+	for _, rule := range rules {
+		lb.AddRule(rule)
+	}
+}
+
+func (lb *LoadBalancer) GetRules() []*ListenerRule {
+	lb.rulesMutex.RLock()
+	defer lb.rulesMutex.RUnlock()
+
+	rules := make([]*ListenerRule, len(lb.rules))
+	copy(rules, lb.rules)
+	return rules
+}
+
+// routeBackends returns the backends the request may go to: those of the
+// first matching rule's target group, or every backend if no rule matches.
+// A client pinned within the rule stays with its target group; others are
+// split between the groups by weight. It also returns the client's affinity
+// key, scoped to the rule, and the group chosen.
+func (lb *LoadBalancer) routeBackends(req *engine.Request, client string) ([]engine.Component, string, string) {
+	backends := lb.GetBackends()
+
+	for _, rule := range lb.GetRules() {
+		if !rule.Condition.Matches(req) {
+			continue
+		}
+		atomic.AddInt64(&rule.matches, 1)
+
+		key := affinityKey(fmt.Sprintf("%d:%s", rule.Priority, rule.Name), client)
+		group := findTargetGroup(rule.TargetGroups, lb.pinnedGroup(key))
+		if group == nil {
+			group = pickTargetGroup(rule.TargetGroups)
+		}
+		if group == nil {
+			return nil, key, ""
+		}
+
+		members := make(map[string]bool, len(group.BackendIDs))
+		for _, id := range group.BackendIDs {
+			members[id] = true
+		}
+		routed := make([]engine.Component, 0, len(group.BackendIDs))
+		for _, backend := range backends {
+			if members[backend.GetID()] {
+				routed = append(routed, backend)
+			}
+		}
+		return routed, key, group.Name
+	}
+
+	return backends, affinityKey("", client), ""
+}
+
+// findTargetGroup returns the group of that name, if it still has weight
+func findTargetGroup(groups []TargetGroup, name string) *TargetGroup {
+	if name == "" {
+		return nil
+	}
+	for i := range groups {
+		if groups[i].Name == name && groups[i].Weight > 0 {
+			return &groups[i]
+		}
+	}
+	return nil
+}
+
+func pickTargetGroup(groups []TargetGroup) *TargetGroup {
+	total := 0
+	for _, group := range groups {
+		total += group.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	roll := rand.Intn(total)
+	for i := range groups {
+		roll -= groups[i].Weight
+		if roll < 0 {
+			return &groups[i]
+		}
+	}
+	return &groups[len(groups)-1]
+}
+
+// affinityKey identifies the client for session affinity within a rule, so
+// a client pinned by one rule keeps its pin while its requests matching
+// other rules are pinned separately
+func affinityKey(scope, client string) string {
+	if client == "" {
+		return ""
+	}
+	return scope + "|" + client
+}
+
+// clientKey identifies the client for session affinity. Cookie affinity
+// issues a new session cookie when the request carries none.
+func (lb *LoadBalancer) clientKey(req *engine.Request) (string, string) {
+	switch lb.Stickiness.Source {
+	case AffinityUserID:
+		if req.UserID == "" {
+			return "", ""
+		}
+		return "user:" + req.UserID, ""
+	case AffinityCookie:
+		name := lb.Stickiness.CookieName
+		if name == "" {
+			name = defaultAffinityCookie
+		}
+		if value := GetCookie(req.Headers["Cookie"], name); value != "" {
+			return "cookie:" + value, ""
+		}
+		value := fmt.Sprintf("%s-%d", lb.ID, atomic.AddUint64(&lb.cookieCounter, 1))
+		return "cookie:" + value, name + "=" + value
+	}
+	return "", ""
+}
+
+// pinnedGroup returns the target group the client is pinned to, or "" if
+// it is not pinned or the affinity has expired
+func (lb *LoadBalancer) pinnedGroup(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	lb.affinityMutex.Lock()
+	entry, exists := lb.affinity[key]
+	lb.affinityMutex.Unlock()
+	if !exists || time.Now().After(entry.expires) {
+		return ""
+	}
+	return entry.group
+}
+
+// stickyBackend returns the backend the client is pinned to if it is in the
+// same target group, still among the candidates, and the affinity has not
+// expired
+func (lb *LoadBalancer) stickyBackend(key, group string, candidates []engine.Component) engine.Component {
+	if key == "" {
+		return nil
+	}
+
+	lb.affinityMutex.Lock()
+	entry, exists := lb.affinity[key]
+	lb.affinityMutex.Unlock()
+	if !exists || time.Now().After(entry.expires) || entry.group != group {
+		return nil
+	}
+
+	for _, backend := range candidates {
+		if backend.GetID() == entry.backendID {
+			return backend
+		}
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) pin(key, group string, backend engine.Component) {
+	if key == "" || backend == nil {
+		return
+	}
+
+	lb.affinityMutex.Lock()
+	defer lb.affinityMutex.Unlock()
+
+	now := time.Now()
+	lb.affinity[key] = affinityEntry{group: group, backendID: backend.GetID(), expires: now.Add(lb.Stickiness.Duration)}
+
+	// Drop expired sessions now and then so the table does not grow unbounded
+	if len(lb.affinity) > 10000 {
+		for k, entry := range lb.affinity {
+			if now.After(entry.expires) {
+				delete(lb.affinity, k)
+			}
+		}
+	}
+}
+
+// GetCookie returns the value of the named cookie in a Cookie header
+func GetCookie(header, name string) string {
+	for _, part := range strings.Split(header, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if found && key == name {
+			return value
+		}
+	}
+	return ""
+}
+
+// ParseRule reads a rule from its compact text form, e.g.
+//
+//	prefix:/api type:write header:X-Canary=1 => api-1+api-2:90, api-3:10
+//
+// Conditions are prefix:, regex:, header:Name=Value and type: (comma
+// separated request types). Target groups are backends joined by '+' with
+// an optional weight (default 1).
+func ParseRule(priority int, text string) (*ListenerRule, error) {
+	conditionText, targetText, found := strings.Cut(text, "=>")
+	if !found {
+		return nil, fmt.Errorf("rule %q has no '=>' target", text)
+	}
+
+	rule := &ListenerRule{Priority: priority, Name: strings.TrimSpace(text)}
+	for _, field := range strings.Fields(conditionText) {
+		kind, value, found := strings.Cut(field, ":")
+		if !found {
+			return nil, fmt.Errorf("condition %q must be kind:value", field)
+		}
+		switch kind {
+		case "prefix":
+			rule.Condition.PathPrefix = value
+		case "regex":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path regex %q: %w", value, err)
+			}
+			rule.Condition.PathRegex = re
+		case "header":
+			name, headerValue, found := strings.Cut(value, "=")
+			if !found {
+				return nil, fmt.Errorf("header condition %q must be Name=Value", value)
+			}
+			if rule.Condition.Headers == nil {
+				rule.Condition.Headers = make(map[string]string)
+			}
+			rule.Condition.Headers[name] = headerValue
+		case "type":
+			for _, reqType := range strings.Split(value, ",") {
+				rule.Condition.RequestTypes = append(rule.Condition.RequestTypes, engine.RequestType(reqType))
+			}
+		default:
+			return nil, fmt.Errorf("unknown condition %q", kind)
+		}
+	}
+
+	for _, target := range strings.Split(targetText, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		members, weightText, hasWeight := strings.Cut(target, ":")
+		weight := 1
+		if hasWeight {
+			parsed, err := strconv.Atoi(weightText)
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("invalid weight in target %q", target)
+			}
+			weight = parsed
+		}
+		rule.TargetGroups = append(rule.TargetGroups, TargetGroup{
+			Name:       members,
+			BackendIDs: strings.Split(members, "+"),
+			Weight:     weight,
+		})
+	}
+	if len(rule.TargetGroups) == 0 {
+		return nil, fmt.Errorf("rule %q has no target groups", text)
+	}
+
+	return rule, nil
+}
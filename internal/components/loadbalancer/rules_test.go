@@ -0,0 +1,70 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// stubBackend answers every request at once
+type stubBackend struct {
+	id string
+}
+
+func (b *stubBackend) GetID() string   { return b.id }
+func (b *stubBackend) GetType() string { return "api-server" }
+func (b *stubBackend) Process(req *engine.Request) (*engine.Response, error) {
+	return &engine.Response{RequestID: req.ID, Success: true}, nil
+}
+func (b *stubBackend) GetMetrics() *engine.Metrics { return &engine.Metrics{} }
+func (b *stubBackend) GetCost() float64            { return 0 }
+func (b *stubBackend) IsHealthy() bool             { return true }
+func (b *stubBackend) SetHealthy(bool)             {}
+
+// A sticky client stays on the target group and backend it was first sent
+// to, however the weighted split rolls for later requests
+func TestStickinessHoldsAcrossWeightedGroups(t *testing.T) {
+	lb := NewLoadBalancer("lb", "us-east-1", StrategyRoundRobin)
+	for _, id := range []string{"stable-1", "stable-2", "canary-1", "canary-2"} {
+		lb.AddBackend(&stubBackend{id: id})
+	}
+	rule, err := ParseRule(10, "prefix:/api => stable-1+stable-2:50, canary-1+canary-2:50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.AddRule(rule)
+	lb.Stickiness.Source = AffinityUserID
+
+	for user := 0; user < 20; user++ {
+		req := &engine.Request{Path: "/api/items", UserID: fmt.Sprintf("user-%d", user)}
+		first, _ := lb.selectBackend(req)
+		for i := 0; i < 50; i++ {
+			if backend, _ := lb.selectBackend(req); backend != first {
+				t.Fatalf("user %d moved from %s to %s", user, first.GetID(), backend.GetID())
+			}
+		}
+	}
+}
+
+// Without stickiness the weighted split still sends traffic to every group
+func TestWeightedGroupsWithoutStickiness(t *testing.T) {
+	lb := NewLoadBalancer("lb", "us-east-1", StrategyRoundRobin)
+	for _, id := range []string{"stable-1", "canary-1"} {
+		lb.AddBackend(&stubBackend{id: id})
+	}
+	rule, err := ParseRule(10, "prefix:/api => stable-1:50, canary-1:50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.AddRule(rule)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		backend, _ := lb.selectBackend(&engine.Request{Path: "/api/items", UserID: "user-1"})
+		seen[backend.GetID()] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("traffic went to %v, want both groups", seen)
+	}
+}
@@ -0,0 +1,351 @@
+package loadbalancer
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+const (
+	// Virtual nodes each unit of backend weight gets on the hash ring
+	ringVirtualNodes = 100
+	// Maglev lookup table size; must be prime
+	maglevTableSize = 4099
+	// Smoothing factor for the response time moving average
+	ewmaAlpha = 0.2
+)
+
+// BackendStats is the load balancer's per-backend view, used to compare how
+// strategies spread load
+type BackendStats struct {
+	Weight      int
+	Requests    int64
+	InFlight    int
+	EWMALatency time.Duration
+	State       BackendState
+	Ejections   int
+}
+
+type ringNode struct {
+	hash    uint64
+	backend engine.Component
+}
+
+type maglevTable struct {
+	signature string
+	entries   []engine.Component
+}
+
+func hash64(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// fnv on short, similar keys clusters; mix the bits so virtual nodes
+	// spread evenly around the ring
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// hashKey identifies the client for sticky strategies. Requests carry no
+// source IP, so the user ID stands in for it.
+func hashKey(req *engine.Request) string {
+	if req.UserID != "" {
+		return req.UserID
+	}
+	if req.Path != "" {
+		return req.Path
+	}
+	return req.ID
+}
+
+func (lb *LoadBalancer) SetWeight(backendID string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+
+	lb.connMutex.Lock()
+	lb.weights[backendID] = weight
+	lb.connMutex.Unlock()
+
+	lb.invalidateHashing()
+}
+
+func (lb *LoadBalancer) GetWeight(backendID string) int {
+	lb.connMutex.RLock()
+	defer lb.connMutex.RUnlock()
+
+	return lb.weightLocked(backendID)
+}
+
+func (lb *LoadBalancer) weightLocked(backendID string) int {
+	if weight, exists := lb.weights[backendID]; exists {
+		return weight
+	}
+	return 1
+}
+
+func (lb *LoadBalancer) GetBackendStats() map[string]BackendStats {
+	backends := lb.GetBackends()
+
+	// Outlier state is read first; it must not be locked under connMutex
+	states := make(map[string]BackendState, len(backends))
+	ejections := make(map[string]int, len(backends))
+	for _, backend := range backends {
+		states[backend.GetID()] = lb.GetBackendState(backend.GetID())
+	}
+	lb.outlierMutex.Lock()
+	for id, state := range lb.outliers {
+		ejections[id] = state.ejections
+	}
+	lb.outlierMutex.Unlock()
+
+	lb.connMutex.RLock()
+	defer lb.connMutex.RUnlock()
+
+	stats := make(map[string]BackendStats)
+	for _, backend := range backends {
+		id := backend.GetID()
+		stats[id] = BackendStats{
+			Weight:      lb.weightLocked(id),
+			Requests:    lb.requestCounts[id],
+			InFlight:    lb.connections[id],
+			EWMALatency: time.Duration(lb.latencyEWMA[id]),
+			State:       states[id],
+			Ejections:   ejections[id],
+		}
+	}
+	return stats
+}
+
+// beginRequest tracks an in-flight request to backend; the returned function
+// ends it and feeds the observed latency into the moving average
+func (lb *LoadBalancer) beginRequest(backend engine.Component) func(latency time.Duration) {
+	id := backend.GetID()
+
+	lb.connMutex.Lock()
+	lb.connections[id]++
+	lb.requestCounts[id]++
+	lb.connMutex.Unlock()
+
+	return func(latency time.Duration) {
+		lb.connMutex.Lock()
+		defer lb.connMutex.Unlock()
+
+		// A backend removed mid-request leaves nothing to update
+		if _, tracked := lb.connections[id]; !tracked {
+			return
+		}
+		lb.connections[id]--
+		if previous, exists := lb.latencyEWMA[id]; exists {
+			lb.latencyEWMA[id] = ewmaAlpha*float64(latency) + (1-ewmaAlpha)*previous
+		} else {
+			lb.latencyEWMA[id] = float64(latency)
+		}
+	}
+}
+
+func (lb *LoadBalancer) invalidateHashing() {
+	lb.hashMutex.Lock()
+	lb.ring = nil
+	lb.maglev = nil
+	lb.hashMutex.Unlock()
+}
+
+func (lb *LoadBalancer) selectWeightedRandom(backends []engine.Component) engine.Component {
+	lb.connMutex.RLock()
+	defer lb.connMutex.RUnlock()
+
+	total := 0
+	for _, backend := range backends {
+		total += lb.weightLocked(backend.GetID())
+	}
+
+	roll := rand.Intn(total)
+	for _, backend := range backends {
+		roll -= lb.weightLocked(backend.GetID())
+		if roll < 0 {
+			return backend
+		}
+	}
+	return backends[len(backends)-1]
+}
+
+// selectIPHash maps a client onto the in-service backends by modulo, so any
+// change in the backend set remaps most clients
+func (lb *LoadBalancer) selectIPHash(req *engine.Request, backends []engine.Component) engine.Component {
+	return backends[hash64(hashKey(req))%uint64(len(backends))]
+}
+
+// selectLeastConnected picks the backend with the fewest in-flight requests
+// relative to its weight
+func (lb *LoadBalancer) selectLeastConnected(backends []engine.Component) engine.Component {
+	lb.connMutex.RLock()
+	defer lb.connMutex.RUnlock()
+
+	var selected engine.Component
+	best := 0.0
+	offset := int(lb.nextIndex())
+	for i := range backends {
+		// Start at a rotating offset so ties don't always go to the first backend
+		backend := backends[(offset+i)%len(backends)]
+		id := backend.GetID()
+		score := float64(lb.connections[id]) / float64(lb.weightLocked(id))
+		if selected == nil || score < best {
+			selected = backend
+			best = score
+		}
+	}
+	return selected
+}
+
+// selectPowerOfTwo samples two random backends and keeps the less loaded one
+func (lb *LoadBalancer) selectPowerOfTwo(backends []engine.Component) engine.Component {
+	if len(backends) == 1 {
+		return backends[0]
+	}
+
+	first := rand.Intn(len(backends))
+	second := rand.Intn(len(backends) - 1)
+	if second >= first {
+		second++
+	}
+
+	return lb.selectLeastConnected([]engine.Component{backends[first], backends[second]})
+}
+
+// selectLeastResponseTime prefers backends that have been answering fastest,
+// penalising the ones already busy. Backends without samples are tried first.
+func (lb *LoadBalancer) selectLeastResponseTime(backends []engine.Component) engine.Component {
+	lb.connMutex.RLock()
+	defer lb.connMutex.RUnlock()
+
+	var selected engine.Component
+	best := 0.0
+	offset := int(lb.nextIndex())
+	for i := range backends {
+		backend := backends[(offset+i)%len(backends)]
+		id := backend.GetID()
+		ewma, measured := lb.latencyEWMA[id]
+		if !measured {
+			return backend
+		}
+		score := ewma * float64(lb.connections[id]+1) / float64(lb.weightLocked(id))
+		if selected == nil || score < best {
+			selected = backend
+			best = score
+		}
+	}
+	return selected
+}
+
+// selectConsistentHash walks the ring clockwise from the client's hash to the
+// first in-service backend. The ring holds every backend, so a backend going
+// out of service only moves the clients that were mapped to it.
+func (lb *LoadBalancer) selectConsistentHash(req *engine.Request, inService []engine.Component) engine.Component {
+	ring := lb.getRing()
+	if len(ring) == 0 {
+		return nil
+	}
+
+	serving := make(map[string]bool, len(inService))
+	for _, backend := range inService {
+		serving[backend.GetID()] = true
+	}
+
+	key := hash64(hashKey(req))
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= key })
+	for i := 0; i < len(ring); i++ {
+		node := ring[(start+i)%len(ring)]
+		if serving[node.backend.GetID()] {
+			return node.backend
+		}
+	}
+	return nil
+}
+
+func (lb *LoadBalancer) getRing() []ringNode {
+	lb.hashMutex.Lock()
+	defer lb.hashMutex.Unlock()
+
+	if lb.ring != nil {
+		return lb.ring
+	}
+
+	ring := make([]ringNode, 0)
+	for _, backend := range lb.GetBackends() {
+		id := backend.GetID()
+		for v := 0; v < ringVirtualNodes*lb.GetWeight(id); v++ {
+			ring = append(ring, ringNode{hash: hash64(id + "#" + strconv.Itoa(v)), backend: backend})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	lb.ring = ring
+	return ring
+}
+
+// selectMaglev looks the client up in a Maglev table built over the
+// in-service backends. Tables are rebuilt when that set changes; Maglev's
+// population keeps most clients on the same backend across rebuilds.
+func (lb *LoadBalancer) selectMaglev(req *engine.Request, backends []engine.Component) engine.Component {
+	table := lb.getMaglevTable(backends)
+	return table[hash64(hashKey(req))%uint64(len(table))]
+}
+
+func (lb *LoadBalancer) getMaglevTable(backends []engine.Component) []engine.Component {
+	ids := make([]string, len(backends))
+	for i, backend := range backends {
+		ids[i] = backend.GetID() + ":" + strconv.Itoa(lb.GetWeight(backend.GetID()))
+	}
+	signature := strings.Join(ids, ",")
+
+	lb.hashMutex.Lock()
+	defer lb.hashMutex.Unlock()
+
+	if lb.maglev != nil && lb.maglev.signature == signature {
+		return lb.maglev.entries
+	}
+
+	// Each backend gets its own permutation of the table slots; backends take
+	// turns claiming their next free preferred slot, weighted backends taking
+	// several turns per round
+	offsets := make([]uint64, len(backends))
+	skips := make([]uint64, len(backends))
+	next := make([]uint64, len(backends))
+	weights := make([]int, len(backends))
+	for i, backend := range backends {
+		id := backend.GetID()
+		offsets[i] = hash64(id+"#offset") % maglevTableSize
+		skips[i] = hash64(id+"#skip")%(maglevTableSize-1) + 1
+		weights[i] = lb.GetWeight(id)
+	}
+
+	entries := make([]engine.Component, maglevTableSize)
+	filled := 0
+	for filled < maglevTableSize {
+		for i, backend := range backends {
+			for turn := 0; turn < weights[i] && filled < maglevTableSize; turn++ {
+				slot := (offsets[i] + next[i]*skips[i]) % maglevTableSize
+				for entries[slot] != nil {
+					next[i]++
+					slot = (offsets[i] + next[i]*skips[i]) % maglevTableSize
+				}
+				entries[slot] = backend
+				next[i]++
+				filled++
+			}
+		}
+	}
+
+	lb.maglev = &maglevTable{signature: signature, entries: entries}
+	return entries
+}
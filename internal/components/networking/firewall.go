@@ -0,0 +1,410 @@
+package networking
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+	"github.com/javanhut/systemdesignsim/internal/network"
+)
+
+const (
+	// ClientIPHeader carries the client's address, first of the list
+	ClientIPHeader = "X-Forwarded-For"
+	// PortMetadata and ProtocolMetadata say where a request arrives, in
+	// Request.Metadata. Requests without them are HTTPS on 443.
+	PortMetadata     = "port"
+	ProtocolMetadata = "protocol"
+)
+
+type FirewallAction string
+
+const (
+	ActionAllow FirewallAction = "allow"
+	ActionDeny  FirewallAction = "deny"
+)
+
+// FirewallRule matches requests on where they come from and where they
+// arrive. Fields left empty match anything.
+type FirewallRule struct {
+	Priority int
+	Name     string
+	Action   FirewallAction
+	Protocol network.Protocol
+	Ports    network.PortRange
+	Source   string   // IP or CIDR block
+	Regions  []string // regions the request comes from
+	hits     int64
+}
+
+func (r *FirewallRule) matches(protocol network.Protocol, port int, ip, region string) bool {
+	if r.Protocol != "" && r.Protocol != network.ProtocolAll && r.Protocol != protocol {
+		return false
+	}
+	if r.Ports != (network.PortRange{}) && !r.Ports.Contains(port) {
+		return false
+	}
+	if r.Source != "" && !network.MatchesSource(ip, r.Source) {
+		return false
+	}
+	if len(r.Regions) > 0 && !inRegions(region, r.Regions) {
+		return false
+	}
+	return true
+}
+
+func inRegions(region string, regions []string) bool {
+	for _, candidate := range regions {
+		if config.GetRegionName(candidate) == config.GetRegionName(region) {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleHits is how many requests a rule has decided
+type RuleHits struct {
+	Name   string
+	Action FirewallAction
+	Hits   int64
+}
+
+// FirewallStats counts what the firewall let through and why it blocked the
+// rest. Blocked requests are not failures: the firewall did its job.
+type FirewallStats struct {
+	Allowed     int64
+	Blocked     int64
+	ByReason    map[string]int64
+	RequestRate int64
+}
+
+// Firewall - Security filtering layer. Rules are evaluated in priority
+// order and the first match decides; requests matching none get the
+// default action. In WAF mode, managed rule sets then inspect what got
+// through.
+type Firewall struct {
+	ID            string
+	Region        string
+	Rules         []*FirewallRule
+	DefaultAction FirewallAction
+	Backend       engine.Component
+	waf           wafState
+	stats         FirewallStats
+	rate          engine.Rate // requests
+	healthy       bool
+	metrics       *engine.Metrics
+	metricsMutex  sync.RWMutex
+	mu            sync.Mutex
+	cost          float64
+}
+
+func NewFirewall(id, region string) *Firewall {
+	return &Firewall{
+		ID:     id,
+		Region: region,
+		Rules: []*FirewallRule{
+			{Priority: 100, Name: "allow-http", Action: ActionAllow, Protocol: network.ProtocolTCP, Ports: network.PortRange{From: 80, To: 80}},
+			{Priority: 110, Name: "allow-https", Action: ActionAllow, Protocol: network.ProtocolTCP, Ports: network.PortRange{From: 443, To: 443}},
+		},
+		DefaultAction: ActionDeny,
+		waf:           newWAFState(),
+		stats:         FirewallStats{ByReason: make(map[string]int64)},
+		healthy:       true,
+		metrics:       &engine.Metrics{},
+		cost:          0.02,
+	}
+}
+
+func (f *Firewall) SetBackend(backend engine.Component) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Backend = backend
+}
+
+func (f *Firewall) GetID() string     { return f.ID }
+func (f *Firewall) GetType() string   { return "firewall" }
+func (f *Firewall) GetRegion() string { return f.Region }
+
+func (f *Firewall) IsHealthy() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.healthy
+}
+
+func (f *Firewall) SetHealthy(healthy bool) {
+	f.mu.Lock()
+	f.healthy = healthy
+	f.mu.Unlock()
+}
+
+// AddRule adds a rule, replacing any with the same name
+func (f *Firewall) AddRule(rule FirewallRule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.addRuleLocked(&rule)
+}
+
+func (f *Firewall) addRuleLocked(rule *FirewallRule) {
+	for i, existing := range f.Rules {
+		if existing.Name == rule.Name {
+			f.Rules[i] = rule
+			f.sortRules()
+			return
+		}
+	}
+	f.Rules = append(f.Rules, rule)
+	f.sortRules()
+}
+
+func (f *Firewall) sortRules() {
+	sort.SliceStable(f.Rules, func(i, j int) bool { return f.Rules[i].Priority < f.Rules[j].Priority })
+}
+
+func (f *Firewall) RemoveRule(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rules := f.Rules[:0]
+	for _, rule := range f.Rules {
+		if rule.Name != name {
+			rules = append(rules, rule)
+		}
+	}
+	f.Rules = rules
+}
+
+// UseSecurityGroup replaces the rules with a security group's ingress
+// rules. Security groups only allow, so everything else is denied.
+func (f *Firewall) UseSecurityGroup(sg *network.SecurityGroup) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Rules = nil
+	for i, ingress := range sg.IngressRules {
+		name := ingress.ID
+		if ingress.Description != "" {
+			name = ingress.Description
+		}
+		f.addRuleLocked(&FirewallRule{
+			Priority: 100 + i*10,
+			Name:     name,
+			Action:   ActionAllow,
+			Protocol: ingress.Protocol,
+			Ports:    ingress.PortRange,
+			Source:   ingress.Source,
+		})
+	}
+	f.DefaultAction = ActionDeny
+}
+
+func (f *Firewall) SetDefaultAction(action FirewallAction) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.DefaultAction = action
+}
+
+// GetRuleHits reports each rule in evaluation order
+func (f *Firewall) GetRuleHits() []RuleHits {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	hits := make([]RuleHits, 0, len(f.Rules))
+	for _, rule := range f.Rules {
+		hits = append(hits, RuleHits{Name: rule.Name, Action: rule.Action, Hits: rule.hits})
+	}
+	return hits
+}
+
+// GetCost is the firewall itself, plus in WAF mode a web ACL, each rule in
+// it, and a charge per million requests inspected
+func (f *Firewall) GetCost() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.waf.enabled {
+		return f.cost
+	}
+	return f.cost + f.waf.cost(len(f.Rules), int64(f.rate.PerSecond(time.Now())))
+}
+
+func (f *Firewall) Process(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+
+	f.metricsMutex.Lock()
+	f.metrics.RequestCount++
+	f.metrics.Throughput++
+	f.metricsMutex.Unlock()
+
+	f.mu.Lock()
+	f.rate.Add(start, 1)
+	healthy := f.healthy
+	backend := f.Backend
+	inspect := f.waf.enabled
+	f.mu.Unlock()
+
+	if !healthy {
+		return f.fail(req, start, errors.New("firewall is unhealthy"))
+	}
+
+	// Firewall processing (~2ms), and the WAF reading the request (~1ms)
+	time.Sleep(2 * time.Millisecond)
+	if inspect {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	if reason := f.filter(req, start); reason != "" {
+		f.metricsMutex.Lock()
+		f.metrics.BlockedRequests++
+		f.metricsMutex.Unlock()
+
+		err := fmt.Errorf("403 blocked by firewall: %s", reason)
+		return &engine.Response{
+			RequestID: req.ID,
+			Success:   false,
+			Latency:   time.Since(start),
+			Error:     err,
+			Blocked:   true,
+			HopsTrace: []string{f.ID},
+		}, err
+	}
+
+	if backend == nil {
+		return f.fail(req, start, errors.New("no backend configured"))
+	}
+
+	resp, err := backend.Process(req)
+
+	totalLatency := time.Since(start)
+	f.metricsMutex.Lock()
+	if err == nil && resp != nil && resp.Success {
+		f.metrics.SuccessCount++
+	} else {
+		f.metrics.FailureCount++
+	}
+	f.metrics.TotalLatency += totalLatency
+	f.metrics.AverageLatency = time.Duration(int64(f.metrics.TotalLatency) / f.metrics.RequestCount)
+	f.metricsMutex.Unlock()
+
+	if resp != nil {
+		resp.Latency = totalLatency
+		resp.HopsTrace = append([]string{f.ID}, resp.HopsTrace...)
+	}
+	return resp, err
+}
+
+// filter returns why the request is blocked, or "" to let it through
+func (f *Firewall) filter(req *engine.Request, now time.Time) string {
+	ip := clientIP(req)
+	protocol, port := arrival(req)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	reason := ""
+	action := f.DefaultAction
+	for _, rule := range f.Rules {
+		if rule.matches(protocol, port, ip, req.Region) {
+			rule.hits++
+			action = rule.Action
+			reason = "rule " + rule.Name
+			break
+		}
+	}
+	if action == ActionDeny {
+		if reason == "" {
+			reason = "no rule allows it"
+		}
+	} else {
+		reason = ""
+		if f.waf.enabled {
+			reason = f.waf.inspect(req, ip, now)
+		}
+	}
+
+	if reason == "" {
+		f.stats.Allowed++
+		return ""
+	}
+	f.stats.Blocked++
+	f.stats.ByReason[reason]++
+	return reason
+}
+
+// clientIP is the address the request comes from. Simulated users without
+// one get a stable address of their own.
+func clientIP(req *engine.Request) string {
+	if req.Headers != nil {
+		if forwarded := req.Headers[ClientIPHeader]; forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	client := req.UserID
+	if client == "" {
+		client = req.Source
+	}
+	h := fnv.New32a()
+	h.Write([]byte(client))
+	sum := h.Sum32()
+	return net.IPv4(byte(11+sum%89), byte(sum>>8), byte(sum>>16), byte(sum>>24)).String()
+}
+
+func arrival(req *engine.Request) (network.Protocol, int) {
+	protocol := network.ProtocolTCP
+	port := 443
+	if value, ok := req.Metadata[ProtocolMetadata].(string); ok {
+		protocol = network.Protocol(value)
+	}
+	if value, ok := req.Metadata[PortMetadata].(int); ok {
+		port = value
+	}
+	return protocol, port
+}
+
+func (f *Firewall) fail(req *engine.Request, start time.Time, err error) (*engine.Response, error) {
+	f.metricsMutex.Lock()
+	f.metrics.FailureCount++
+	f.metricsMutex.Unlock()
+
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   false,
+		Latency:   time.Since(start),
+		Error:     err,
+		HopsTrace: []string{f.ID},
+	}, err
+}
+
+func (f *Firewall) GetFirewallStats() FirewallStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := f.stats
+	stats.ByReason = make(map[string]int64, len(f.stats.ByReason))
+	for reason, count := range f.stats.ByReason {
+		stats.ByReason[reason] = count
+	}
+	stats.RequestRate = int64(f.rate.PerSecond(time.Now()))
+	return stats
+}
+
+func (f *Firewall) GetMetrics() *engine.Metrics {
+	f.metricsMutex.RLock()
+	defer f.metricsMutex.RUnlock()
+
+	metricsCopy := *f.metrics
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	return &metricsCopy
+}
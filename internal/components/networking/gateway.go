@@ -0,0 +1,545 @@
+package networking
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+type AuthMode string
+
+const (
+	AuthNone AuthMode = "none"
+	// Tokens are JWTs the gateway verifies itself
+	AuthJWT AuthMode = "jwt"
+	// Tokens are opaque and checked by calling the authorizer, with results
+	// cached for AuthCacheTTL
+	AuthRemote AuthMode = "remote"
+)
+
+func GetAuthModes() []AuthMode {
+	return []AuthMode{AuthNone, AuthJWT, AuthRemote}
+}
+
+// jwtVerifyTime is the CPU a signature check takes
+const jwtVerifyTime = 300 * time.Microsecond
+
+// Route sends requests whose path starts with PathPrefix to Backend. The
+// prefix can be rewritten and headers set before forwarding.
+type Route struct {
+	PathPrefix    string
+	Backend       engine.Component
+	RewritePrefix string
+	SetHeaders    map[string]string
+	stats         routeStats
+}
+
+type routeStats struct {
+	requests     int64
+	served       int64 // forwarded to the backend
+	failures     int64
+	throttled    int64
+	totalLatency time.Duration
+	maxLatency   time.Duration
+}
+
+// RouteStats is what one route has served. The route with an empty prefix
+// is the default backend.
+type RouteStats struct {
+	PathPrefix     string
+	Backend        string
+	Requests       int64
+	Failures       int64
+	Throttled      int64
+	AverageLatency time.Duration
+	MaxLatency     time.Duration
+}
+
+// GatewayStats counts why the gateway turned requests away
+type GatewayStats struct {
+	Throttled    int64 // over the gateway's throughput or a usage plan
+	Unauthorized int64
+	TooLarge     int64 // request or response over the size limits
+	AuthCalls    int64
+	AuthCacheHit int64
+	RequestRate  int64 // requests in the last full second
+}
+
+// Gateway - Internet gateway or API gateway. It enforces its throughput,
+// meters callers against usage plans, validates tokens, and routes by path
+// to its backends.
+type Gateway struct {
+	ID              string
+	Region          string
+	Throughput      int // requests per second across all callers
+	Burst           int // requests at once before throttling; 0 for a second's worth
+	Backend         engine.Component
+	Auth            AuthMode
+	Authorizer      engine.Component
+	AuthCacheTTL    time.Duration
+	DefaultPlan     string // plan for callers without an API key
+	RequireAPIKey   bool
+	MaxRequestSize  int64
+	MaxResponseSize int64
+	PricePerMillion float64
+	routes          []*Route
+	defaultStats    routeStats
+	throttle        *tokenBucket
+	plans           map[string]UsagePlan
+	keys            map[string]string // API key to plan
+	clients         map[string]*client
+	authCache       map[string]time.Time
+	stats           GatewayStats
+	rate            engine.Rate // requests
+	healthy         bool
+	metrics         *engine.Metrics
+	metricsMutex    sync.RWMutex
+	mu              sync.Mutex
+}
+
+func NewGateway(id, region string) *Gateway {
+	return &Gateway{
+		ID:              id,
+		Region:          region,
+		Throughput:      10000, // requests per second
+		Burst:           5000,
+		Auth:            AuthNone,
+		AuthCacheTTL:    5 * time.Minute,
+		MaxRequestSize:  10 * 1024 * 1024,
+		MaxResponseSize: 10 * 1024 * 1024,
+		PricePerMillion: 3.50,
+		plans:           make(map[string]UsagePlan),
+		keys:            make(map[string]string),
+		clients:         make(map[string]*client),
+		authCache:       make(map[string]time.Time),
+		healthy:         true,
+		metrics:         &engine.Metrics{},
+	}
+}
+
+func (g *Gateway) SetBackend(backend engine.Component) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.Backend = backend
+}
+
+// AddBackend makes the first backend connected the default and routes to
+// the others under their own IDs until they are given a prefix
+func (g *Gateway) AddBackend(backend engine.Component) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Backend == nil || g.Backend == backend {
+		g.Backend = backend
+		return
+	}
+	for _, route := range g.routes {
+		if route.Backend == backend {
+			return
+		}
+	}
+	g.addRouteLocked(&Route{PathPrefix: "/" + backend.GetID(), Backend: backend})
+}
+
+// AddRoute adds a route, replacing any with the same prefix. The longest
+// matching prefix wins.
+func (g *Gateway) AddRoute(route Route) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.addRouteLocked(&route)
+}
+
+func (g *Gateway) addRouteLocked(route *Route) {
+	if route.Backend == nil {
+		return
+	}
+	for i, existing := range g.routes {
+		if existing.PathPrefix == route.PathPrefix {
+			route.stats = existing.stats
+			g.routes[i] = route
+			return
+		}
+	}
+	g.routes = append(g.routes, route)
+	sort.SliceStable(g.routes, func(i, j int) bool { return len(g.routes[i].PathPrefix) > len(g.routes[j].PathPrefix) })
+}
+
+// SetRoute changes the prefix and rewrite of the route to a backend
+func (g *Gateway) SetRoute(backendID, prefix, rewrite string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, route := range g.routes {
+		if route.Backend.GetID() == backendID {
+			route.PathPrefix = prefix
+			route.RewritePrefix = rewrite
+		}
+	}
+	sort.SliceStable(g.routes, func(i, j int) bool { return len(g.routes[i].PathPrefix) > len(g.routes[j].PathPrefix) })
+}
+
+func (g *Gateway) GetRoutes() []Route {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	routes := make([]Route, 0, len(g.routes))
+	for _, route := range g.routes {
+		routes = append(routes, Route{PathPrefix: route.PathPrefix, Backend: route.Backend, RewritePrefix: route.RewritePrefix, SetHeaders: route.SetHeaders})
+	}
+	return routes
+}
+
+// SetAuth changes how tokens are validated. A remote authorizer that is
+// also routed to stops taking traffic.
+func (g *Gateway) SetAuth(mode AuthMode, authorizer engine.Component, cacheTTL time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.Auth = mode
+	g.Authorizer = authorizer
+	g.AuthCacheTTL = cacheTTL
+	g.authCache = make(map[string]time.Time)
+	if authorizer == nil {
+		return
+	}
+	routes := g.routes[:0]
+	for _, route := range g.routes {
+		if route.Backend != authorizer {
+			routes = append(routes, route)
+		}
+	}
+	g.routes = routes
+}
+
+// SetLimits changes the gateway's throughput and size limits
+func (g *Gateway) SetLimits(throughput, burst int, maxRequest, maxResponse int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.Throughput = throughput
+	g.Burst = burst
+	g.MaxRequestSize = maxRequest
+	g.MaxResponseSize = maxResponse
+	g.throttle = nil
+}
+
+func (g *Gateway) GetID() string     { return g.ID }
+func (g *Gateway) GetType() string   { return "gateway" }
+func (g *Gateway) GetRegion() string { return g.Region }
+
+func (g *Gateway) IsHealthy() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.healthy
+}
+
+func (g *Gateway) SetHealthy(healthy bool) {
+	g.mu.Lock()
+	g.healthy = healthy
+	g.mu.Unlock()
+}
+
+// GetCost charges per request, at the rate of the last full second
+func (g *Gateway) GetCost() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.rate.PerSecond(time.Now()) * 3600 / 1e6 * g.PricePerMillion
+}
+
+func (g *Gateway) Process(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+
+	g.metricsMutex.Lock()
+	g.metrics.RequestCount++
+	g.metrics.Throughput++
+	g.metricsMutex.Unlock()
+
+	// Minimal latency for gateway (~1ms)
+	time.Sleep(1 * time.Millisecond)
+
+	backend, stats, forwarded, err := g.admit(req, start)
+	if err == nil {
+		err = g.authenticate(req)
+	}
+	if err != nil {
+		if stats != nil {
+			g.mu.Lock()
+			stats.requests++
+			stats.failures++
+			g.mu.Unlock()
+		}
+		return g.fail(req, start, err)
+	}
+
+	resp, err := backend.Process(forwarded)
+	if err == nil && resp != nil && resp.DataSize > g.maxResponseSize() {
+		g.mu.Lock()
+		g.stats.TooLarge++
+		g.mu.Unlock()
+		err = fmt.Errorf("502 response of %d bytes over the gateway's limit", resp.DataSize)
+		resp = nil
+	}
+
+	totalLatency := time.Since(start)
+	failed := err != nil || resp == nil || !resp.Success
+	g.mu.Lock()
+	stats.requests++
+	stats.served++
+	if failed {
+		stats.failures++
+	}
+	stats.totalLatency += totalLatency
+	if totalLatency > stats.maxLatency {
+		stats.maxLatency = totalLatency
+	}
+	g.mu.Unlock()
+
+	if resp == nil {
+		return g.fail(req, start, err)
+	}
+
+	g.metricsMutex.Lock()
+	if failed {
+		g.metrics.FailureCount++
+	} else {
+		g.metrics.SuccessCount++
+	}
+	g.metrics.TotalLatency += totalLatency
+	g.metrics.AverageLatency = time.Duration(int64(g.metrics.TotalLatency) / g.metrics.RequestCount)
+	g.metricsMutex.Unlock()
+
+	resp.Latency = totalLatency
+	resp.HopsTrace = append([]string{g.ID}, resp.HopsTrace...)
+	return resp, err
+}
+
+// admit routes the request and checks it against the size limit, the
+// gateway's throughput and the caller's usage plan. It returns the backend
+// and stats of the matching route, and the request as it is forwarded.
+func (g *Gateway) admit(req *engine.Request, now time.Time) (engine.Component, *routeStats, *engine.Request, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.rate.Add(now, 1)
+	if !g.healthy {
+		return nil, nil, nil, errors.New("gateway is unhealthy")
+	}
+	if req.DataSize > g.MaxRequestSize {
+		g.stats.TooLarge++
+		return nil, nil, nil, fmt.Errorf("413 request of %d bytes over the gateway's limit", req.DataSize)
+	}
+
+	backend, stats, forwarded := g.route(req)
+	if backend == nil {
+		return nil, nil, nil, errors.New("no backend configured")
+	}
+
+	if g.throttle == nil && g.Throughput > 0 {
+		g.throttle = newTokenBucket(g.Throughput, g.Burst)
+	}
+	if g.throttle != nil && !g.throttle.allow(now) {
+		g.stats.Throttled++
+		stats.throttled++
+		return nil, stats, nil, errors.New("429 gateway throughput exceeded")
+	}
+
+	key := ""
+	if req.Headers != nil {
+		key = req.Headers[APIKeyHeader]
+	}
+	plan := g.DefaultPlan
+	switch {
+	case key != "":
+		var known bool
+		if plan, known = g.keys[key]; !known {
+			g.stats.Unauthorized++
+			return nil, stats, nil, errors.New("403 unknown API key")
+		}
+	case g.RequireAPIKey:
+		g.stats.Unauthorized++
+		return nil, stats, nil, errors.New("403 API key required")
+	default:
+		key = "user:" + req.UserID
+	}
+	if status, reason := g.meter(key, plan, now); status != 0 {
+		g.stats.Throttled++
+		stats.throttled++
+		return nil, stats, nil, fmt.Errorf("%d %s", status, reason)
+	}
+
+	return backend, stats, forwarded, nil
+}
+
+// route picks the longest matching prefix, falling back to the default
+// backend, and applies the route's transformations to a copy of the
+// request. The caller holds g.mu.
+func (g *Gateway) route(req *engine.Request) (engine.Component, *routeStats, *engine.Request) {
+	for _, route := range g.routes {
+		if !strings.HasPrefix(req.Path, route.PathPrefix) {
+			continue
+		}
+		forwarded := *req
+		if route.RewritePrefix != "" || len(route.SetHeaders) > 0 {
+			if route.RewritePrefix != "" {
+				forwarded.Path = route.RewritePrefix + strings.TrimPrefix(req.Path, route.PathPrefix)
+			}
+			forwarded.Headers = make(map[string]string, len(req.Headers)+len(route.SetHeaders))
+			for name, value := range req.Headers {
+				forwarded.Headers[name] = value
+			}
+			for name, value := range route.SetHeaders {
+				forwarded.Headers[name] = value
+			}
+		}
+		return route.Backend, &route.stats, &forwarded
+	}
+	if g.Backend == nil {
+		return nil, nil, nil
+	}
+	return g.Backend, &g.defaultStats, req
+}
+
+// authenticate validates the caller's bearer token. Sessions without one
+// present their session ID, as a signed-in browser would its cookie.
+func (g *Gateway) authenticate(req *engine.Request) error {
+	g.mu.Lock()
+	mode := g.Auth
+	authorizer := g.Authorizer
+	g.mu.Unlock()
+
+	if mode == AuthNone {
+		return nil
+	}
+	token := ""
+	if req.Headers != nil {
+		token = req.Headers["Authorization"]
+	}
+	if token == "" && req.UserID != "" {
+		token = "session:" + req.UserID
+	}
+	if token == "" {
+		g.mu.Lock()
+		g.stats.Unauthorized++
+		g.mu.Unlock()
+		return errors.New("401 missing token")
+	}
+
+	if mode == AuthJWT || authorizer == nil {
+		time.Sleep(jwtVerifyTime)
+		return nil
+	}
+
+	g.mu.Lock()
+	expires, cached := g.authCache[token]
+	if cached && time.Now().Before(expires) {
+		g.stats.AuthCacheHit++
+		g.mu.Unlock()
+		return nil
+	}
+	delete(g.authCache, token)
+	g.stats.AuthCalls++
+	g.mu.Unlock()
+
+	resp, err := authorizer.Process(&engine.Request{
+		ID:        req.ID + "-auth",
+		Type:      engine.RequestTypeRead,
+		Timestamp: time.Now(),
+		UserID:    req.UserID,
+		Region:    req.Region,
+		DataSize:  256,
+		Path:      "/auth/validate",
+		Source:    g.ID,
+		Headers:   map[string]string{"Authorization": token},
+	})
+	if err != nil || resp == nil || !resp.Success {
+		g.mu.Lock()
+		g.stats.Unauthorized++
+		g.mu.Unlock()
+		return errors.New("401 token could not be validated")
+	}
+
+	g.mu.Lock()
+	if g.AuthCacheTTL > 0 {
+		g.authCache[token] = time.Now().Add(g.AuthCacheTTL)
+	}
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *Gateway) maxResponseSize() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.MaxResponseSize
+}
+
+func (g *Gateway) fail(req *engine.Request, start time.Time, err error) (*engine.Response, error) {
+	g.metricsMutex.Lock()
+	g.metrics.FailureCount++
+	g.metricsMutex.Unlock()
+
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   false,
+		Latency:   time.Since(start),
+		Error:     err,
+		HopsTrace: []string{g.ID},
+	}, err
+}
+
+func (g *Gateway) GetGatewayStats() GatewayStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	stats := g.stats
+	stats.RequestRate = int64(g.rate.PerSecond(time.Now()))
+	return stats
+}
+
+// GetRouteStats reports each route, the default backend last
+func (g *Gateway) GetRouteStats() []RouteStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	stats := make([]RouteStats, 0, len(g.routes)+1)
+	for _, route := range g.routes {
+		stats = append(stats, route.stats.report(route.PathPrefix, route.Backend))
+	}
+	if g.Backend != nil {
+		stats = append(stats, g.defaultStats.report("", g.Backend))
+	}
+	return stats
+}
+
+func (s routeStats) report(prefix string, backend engine.Component) RouteStats {
+	stats := RouteStats{
+		PathPrefix: prefix,
+		Backend:    backend.GetID(),
+		Requests:   s.requests,
+		Failures:   s.failures,
+		Throttled:  s.throttled,
+		MaxLatency: s.maxLatency,
+	}
+	if s.served > 0 {
+		stats.AverageLatency = s.totalLatency / time.Duration(s.served)
+	}
+	return stats
+}
+
+func (g *Gateway) GetMetrics() *engine.Metrics {
+	g.metricsMutex.RLock()
+	defer g.metricsMutex.RUnlock()
+
+	metricsCopy := *g.metrics
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	return &metricsCopy
+}
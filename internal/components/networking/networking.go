@@ -3,134 +3,14 @@ package networking
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/javanhut/systemdesignsim/internal/components/config"
 	"github.com/javanhut/systemdesignsim/internal/engine"
+	"github.com/javanhut/systemdesignsim/internal/network"
 )
 
-// Gateway - Internet gateway or API gateway
-type Gateway struct {
-	ID           string
-	Region       string
-	Throughput   int
-	Backend      engine.Component
-	healthy      bool
-	metrics      *engine.Metrics
-	metricsMutex sync.RWMutex
-	cost         float64
-}
-
-func NewGateway(id, region string) *Gateway {
-	return &Gateway{
-		ID:         id,
-		Region:     region,
-		Throughput: 10000, // requests per second
-		healthy:    true,
-		metrics:    &engine.Metrics{},
-		cost:       0.03,
-	}
-}
-
-func (g *Gateway) SetBackend(backend engine.Component) {
-	g.Backend = backend
-}
-
-func (g *Gateway) GetID() string           { return g.ID }
-func (g *Gateway) GetType() string         { return "gateway" }
-func (g *Gateway) GetRegion() string       { return g.Region }
-func (g *Gateway) IsHealthy() bool         { return g.healthy }
-func (g *Gateway) SetHealthy(healthy bool) { g.healthy = healthy }
-func (g *Gateway) GetCost() float64        { return g.cost }
-
-func (g *Gateway) Process(req *engine.Request) (*engine.Response, error) {
-	g.metricsMutex.Lock()
-	g.metrics.RequestCount++
-	g.metrics.Throughput++
-	g.metricsMutex.Unlock()
-
-	// Minimal latency for gateway (~1ms)
-	time.Sleep(1 * time.Millisecond)
-
-	if g.Backend != nil {
-		return g.Backend.Process(req)
-	}
-
-	return &engine.Response{
-		RequestID: req.ID,
-		Success:   false,
-		Latency:   1 * time.Millisecond,
-		Error:     errors.New("no backend configured"),
-	}, nil
-}
-
-func (g *Gateway) GetMetrics() *engine.Metrics {
-	g.metricsMutex.RLock()
-	defer g.metricsMutex.RUnlock()
-	return g.metrics
-}
-
-// Firewall - Security filtering layer
-type Firewall struct {
-	ID             string
-	Region         string
-	Rules          []string
-	BlockedCount   int
-	Backend        engine.Component
-	healthy        bool
-	metrics        *engine.Metrics
-	metricsMutex   sync.RWMutex
-	cost           float64
-}
-
-func NewFirewall(id, region string) *Firewall {
-	return &Firewall{
-		ID:      id,
-		Region:  region,
-		Rules:   []string{"allow-http", "allow-https"},
-		healthy: true,
-		metrics: &engine.Metrics{},
-		cost:    0.02,
-	}
-}
-
-func (f *Firewall) SetBackend(backend engine.Component) {
-	f.Backend = backend
-}
-
-func (f *Firewall) GetID() string           { return f.ID }
-func (f *Firewall) GetType() string         { return "firewall" }
-func (f *Firewall) GetRegion() string       { return f.Region }
-func (f *Firewall) IsHealthy() bool         { return f.healthy }
-func (f *Firewall) SetHealthy(healthy bool) { f.healthy = healthy }
-func (f *Firewall) GetCost() float64        { return f.cost }
-
-func (f *Firewall) Process(req *engine.Request) (*engine.Response, error) {
-	f.metricsMutex.Lock()
-	f.metrics.RequestCount++
-	f.metrics.Throughput++
-	f.metricsMutex.Unlock()
-
-	// Firewall processing (~2ms)
-	time.Sleep(2 * time.Millisecond)
-
-	if f.Backend != nil {
-		return f.Backend.Process(req)
-	}
-
-	return &engine.Response{
-		RequestID: req.ID,
-		Success:   false,
-		Latency:   2 * time.Millisecond,
-		Error:     errors.New("no backend configured"),
-	}, nil
-}
-
-func (f *Firewall) GetMetrics() *engine.Metrics {
-	f.metricsMutex.RLock()
-	defer f.metricsMutex.RUnlock()
-	return f.metrics
-}
-
 // NAT - Network Address Translation
 type NAT struct {
 	ID           string
@@ -258,12 +138,22 @@ func (r *Router) GetMetrics() *engine.Metrics {
 	return r.metrics
 }
 
-// UserPool - Simulated user traffic source
+// UserPool - Simulated user traffic source. Requests generated for the pool
+// enter the system through it and are forwarded to whatever it is connected
+// to, paying the network latency between the pool's region and the target.
 type UserPool struct {
 	ID             string
 	Region         string
 	UserCount      int
 	RequestRate    int // requests per second per user
+	// Share of users who all go after one featured item, as in a flash sale
+	FeaturedItemShare float64
+	// Sizes the pool from the scenario's geographic mix when its region
+	// changes; nil keeps UserCount as it is
+	UsersForRegion func(region string) int
+	Targets        []engine.Component
+	nextTarget     uint64
+	healthChecker  *engine.HealthChecker
 	healthy        bool
 	metrics        *engine.Metrics
 	metricsMutex   sync.RWMutex
@@ -276,12 +166,30 @@ func NewUserPool(id, region string, userCount int) *UserPool {
 		Region:      region,
 		UserCount:   userCount,
 		RequestRate: 5, // 5 requests/sec per user
+		Targets:     make([]engine.Component, 0),
 		healthy:     true,
 		metrics:     &engine.Metrics{},
 		cost:        0.0, // No cost for simulated users
 	}
 }
 
+func (u *UserPool) AddTarget(target engine.Component) {
+	u.Targets = append(u.Targets, target)
+	if u.healthChecker != nil {
+		u.healthChecker.AddTarget(target)
+	}
+}
+
+// SetHealthChecker makes the pool resolve entry points like DNS failover
+// routing: targets failing their health checks are skipped in favour of the
+// next closest one.
+func (u *UserPool) SetHealthChecker(hc *engine.HealthChecker) {
+	u.healthChecker = hc
+	for _, target := range u.Targets {
+		hc.AddTarget(target)
+	}
+}
+
 func (u *UserPool) GetID() string           { return u.ID }
 func (u *UserPool) GetType() string         { return "user-pool" }
 func (u *UserPool) GetRegion() string       { return u.Region }
@@ -290,18 +198,118 @@ func (u *UserPool) SetHealthy(healthy bool) { u.healthy = healthy }
 func (u *UserPool) GetCost() float64        { return u.cost }
 
 func (u *UserPool) Process(req *engine.Request) (*engine.Response, error) {
-	// UserPool generates requests, doesn't process them
-	return &engine.Response{
-		RequestID: req.ID,
-		Success:   true,
-		Latency:   0,
-	}, nil
+	start := time.Now()
+
+	u.metricsMutex.Lock()
+	u.metrics.RequestCount++
+	u.metrics.Throughput++
+	u.metricsMutex.Unlock()
+
+	var target engine.Component
+	if u.healthy {
+		target = u.selectTarget()
+	}
+	if target == nil {
+		err := errors.New("no healthy entry point connected")
+		if !u.healthy {
+			err = errors.New("user pool is offline")
+		}
+
+		u.metricsMutex.Lock()
+		u.metrics.FailureCount++
+		u.metricsMutex.Unlock()
+
+		return &engine.Response{
+			RequestID: req.ID,
+			Success:   false,
+			Latency:   time.Since(start),
+			Error:     err,
+		}, err
+	}
+
+	req.Region = config.GetRegionName(u.Region)
+
+	// Last-mile + inter-region latency from the users to the entry point
+	time.Sleep(u.latencyTo(target))
+
+	resp, err := target.Process(req)
+
+	totalLatency := time.Since(start)
+
+	u.metricsMutex.Lock()
+	if resp != nil && resp.Blocked {
+		u.metrics.BlockedRequests++
+	} else if err == nil && resp != nil && resp.Success {
+		u.metrics.SuccessCount++
+	} else {
+		u.metrics.FailureCount++
+	}
+	u.metrics.TotalLatency += totalLatency
+	u.metrics.AverageLatency = time.Duration(int64(u.metrics.TotalLatency) / u.metrics.RequestCount)
+	u.metrics.DataTransferred += req.DataSize
+	u.metricsMutex.Unlock()
+
+	if resp != nil {
+		resp.Latency = totalLatency
+		resp.HopsTrace = append([]string{u.ID}, resp.HopsTrace...)
+	}
+
+	return resp, err
+}
+
+// selectTarget prefers the closest healthy target, round-robining between
+// targets that are equally close.
+func (u *UserPool) selectTarget() engine.Component {
+	var closest []engine.Component
+	var closestLatency time.Duration
+
+	for _, target := range u.Targets {
+		inService := target.IsHealthy()
+		if u.healthChecker != nil {
+			inService = u.healthChecker.IsInService(target)
+		}
+		if !inService {
+			continue
+		}
+		latency := u.latencyTo(target)
+		if len(closest) == 0 || latency < closestLatency {
+			closest = []engine.Component{target}
+			closestLatency = latency
+		} else if latency == closestLatency {
+			closest = append(closest, target)
+		}
+	}
+
+	if len(closest) == 0 {
+		return nil
+	}
+
+	index := atomic.AddUint64(&u.nextTarget, 1)
+	return closest[index%uint64(len(closest))]
+}
+
+// latencyTo returns the network latency between the pool and a target.
+// Targets that don't report a region (e.g. a CDN with edges everywhere) are
+// treated as local to the users.
+func (u *UserPool) latencyTo(target engine.Component) time.Duration {
+	from := config.GetRegionName(u.Region)
+	to := from
+	if regional, ok := target.(interface{ GetRegion() string }); ok && regional.GetRegion() != "" {
+		to = config.GetRegionName(regional.GetRegion())
+	}
+
+	return network.CalculateLatency(from, to, network.LatencyProfile{Jitter: 2 * time.Millisecond})
 }
 
 func (u *UserPool) GetMetrics() *engine.Metrics {
 	u.metricsMutex.RLock()
 	defer u.metricsMutex.RUnlock()
-	return u.metrics
+
+	metricsCopy := *u.metrics
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	return &metricsCopy
 }
 
 func (u *UserPool) GetTotalRequestRate() int {
@@ -0,0 +1,171 @@
+package networking
+
+import (
+	"time"
+)
+
+// APIKeyHeader carries the caller's API key
+const APIKeyHeader = "X-Api-Key"
+
+// tokenBucket allows rate requests per second on average and bursts of up
+// to burst at once. A burst of zero allows a second's worth.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst)}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// UsagePlan limits each API key on it to RateLimit requests per second,
+// bursts of Burst, and Quota requests per QuotaPeriod. Zero means no limit,
+// except a zero Burst, which allows a second's worth of RateLimit.
+type UsagePlan struct {
+	Name        string
+	RateLimit   int
+	Burst       int
+	Quota       int64
+	QuotaPeriod time.Duration
+}
+
+// client is one API key's standing against its plan
+type client struct {
+	plan        string
+	bucket      *tokenBucket
+	used        int64
+	periodStart time.Time
+	requests    int64
+	throttled   int64
+}
+
+// ClientUsage is what one API key has used
+type ClientUsage struct {
+	Key       string
+	Plan      string
+	Requests  int64
+	Used      int64 // against the quota this period
+	Throttled int64
+}
+
+// AddUsagePlan adds a plan, or replaces the one with the same name. Keys on
+// a replaced plan get fresh rate limits.
+func (g *Gateway) AddUsagePlan(plan UsagePlan) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if plan.QuotaPeriod <= 0 {
+		plan.QuotaPeriod = 24 * time.Hour
+	}
+	g.plans[plan.Name] = plan
+	for _, c := range g.clients {
+		if c.plan == plan.Name {
+			c.bucket = nil
+		}
+	}
+}
+
+func (g *Gateway) GetUsagePlans() []UsagePlan {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	plans := make([]UsagePlan, 0, len(g.plans))
+	for _, plan := range g.plans {
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// AddAPIKey issues a key on a plan
+func (g *Gateway) AddAPIKey(key, plan string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.keys[key] = plan
+	if c, exists := g.clients[key]; exists {
+		c.plan = plan
+		c.bucket = nil
+	}
+}
+
+// SetDefaultPlan puts callers without an API key on a plan, each user
+// metered on their own. An empty name leaves them unmetered.
+func (g *Gateway) SetDefaultPlan(plan string, requireKey bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.DefaultPlan = plan
+	g.RequireAPIKey = requireKey
+}
+
+// meter checks a caller against their plan. It returns the HTTP status to
+// reject with, or 0 to let the request through. The caller holds g.mu.
+func (g *Gateway) meter(key, plan string, now time.Time) (int, string) {
+	usage, exists := g.plans[plan]
+	if !exists {
+		return 0, ""
+	}
+
+	c, exists := g.clients[key]
+	if !exists {
+		c = &client{plan: plan, periodStart: now}
+		g.clients[key] = c
+	}
+	c.requests++
+	if c.bucket == nil && usage.RateLimit > 0 {
+		c.bucket = newTokenBucket(usage.RateLimit, usage.Burst)
+	}
+
+	if now.Sub(c.periodStart) >= usage.QuotaPeriod {
+		c.used = 0
+		c.periodStart = now
+	}
+	if usage.Quota > 0 && c.used >= usage.Quota {
+		c.throttled++
+		return 429, "quota exceeded for plan " + plan
+	}
+	if c.bucket != nil && !c.bucket.allow(now) {
+		c.throttled++
+		return 429, "rate limit exceeded for plan " + plan
+	}
+	c.used++
+	return 0, ""
+}
+
+// GetClientUsage reports every caller the gateway has metered
+func (g *Gateway) GetClientUsage() []ClientUsage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	usage := make([]ClientUsage, 0, len(g.clients))
+	for key, c := range g.clients {
+		usage = append(usage, ClientUsage{
+			Key:       key,
+			Plan:      c.plan,
+			Requests:  c.requests,
+			Used:      c.used,
+			Throttled: c.throttled,
+		})
+	}
+	return usage
+}
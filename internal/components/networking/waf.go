@@ -0,0 +1,192 @@
+package networking
+
+import (
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+	"github.com/javanhut/systemdesignsim/internal/network"
+)
+
+// ManagedRuleSet is a group of WAF rules maintained for you
+type ManagedRuleSet string
+
+const (
+	RuleSetSQLInjection ManagedRuleSet = "sql-injection"
+	RuleSetXSS          ManagedRuleSet = "cross-site-scripting"
+	// Addresses known for abuse: botnets, scanners, anonymizing proxies
+	RuleSetIPReputation ManagedRuleSet = "ip-reputation"
+)
+
+func GetManagedRuleSets() []ManagedRuleSet {
+	return []ManagedRuleSet{RuleSetSQLInjection, RuleSetXSS, RuleSetIPReputation}
+}
+
+var (
+	sqlInjectionSignature = regexp.MustCompile(`(?i)(\bunion\b.*\bselect\b|\bor\b\s+['"]?\w+['"]?\s*=\s*['"]?\w+|'\s*(or|and)\s+'|;\s*(drop|delete|insert|update|shutdown)\b|--\s|/\*|\b(sleep|benchmark)\s*\()`)
+	xssSignature          = regexp.MustCompile(`(?i)(<\s*script|javascript\s*:|\bon(error|load|click|mouseover|focus)\s*=|<\s*(iframe|object|embed|svg)\b|document\.cookie)`)
+)
+
+// reputationList is the managed IP reputation list
+var reputationList = []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24"}
+
+// WAFSettings is what the player tunes in WAF mode
+type WAFSettings struct {
+	Enabled        bool
+	RuleSets       map[ManagedRuleSet]bool
+	BlockedRegions []string
+	RateLimit      int // requests per RateWindow from one address; 0 for none
+	RateWindow     time.Duration
+}
+
+type ipWindow struct {
+	start time.Time
+	count int
+}
+
+type wafState struct {
+	enabled        bool
+	ruleSets       map[ManagedRuleSet]bool
+	blockedRegions []string
+	blockedIPs     []string
+	rateLimit      int
+	rateWindow     time.Duration
+	windows        map[string]*ipWindow
+	lastSweep      time.Time
+}
+
+func newWAFState() wafState {
+	return wafState{
+		ruleSets:   make(map[ManagedRuleSet]bool),
+		rateWindow: time.Minute,
+		windows:    make(map[string]*ipWindow),
+	}
+}
+
+// SetWAF switches WAF mode and its managed rules
+func (f *Firewall) SetWAF(settings WAFSettings) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.waf.enabled = settings.Enabled
+	f.waf.ruleSets = make(map[ManagedRuleSet]bool)
+	for ruleSet, on := range settings.RuleSets {
+		if on {
+			f.waf.ruleSets[ruleSet] = true
+		}
+	}
+	f.waf.blockedRegions = append([]string(nil), settings.BlockedRegions...)
+	f.waf.rateLimit = settings.RateLimit
+	if settings.RateWindow > 0 {
+		f.waf.rateWindow = settings.RateWindow
+	}
+}
+
+func (f *Firewall) GetWAF() WAFSettings {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	settings := WAFSettings{
+		Enabled:        f.waf.enabled,
+		RuleSets:       make(map[ManagedRuleSet]bool),
+		BlockedRegions: append([]string(nil), f.waf.blockedRegions...),
+		RateLimit:      f.waf.rateLimit,
+		RateWindow:     f.waf.rateWindow,
+	}
+	for ruleSet, on := range f.waf.ruleSets {
+		settings.RuleSets[ruleSet] = on
+	}
+	return settings
+}
+
+// BlockIP adds an address or CIDR block to the WAF's own reputation list
+func (f *Firewall) BlockIP(source string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.waf.blockedIPs = append(f.waf.blockedIPs, source)
+}
+
+// inspect returns why the WAF blocks a request, or "". The caller holds
+// the firewall's lock.
+func (w *wafState) inspect(req *engine.Request, ip string, now time.Time) string {
+	if len(w.blockedRegions) > 0 && inRegions(req.Region, w.blockedRegions) {
+		return "geo-blocked " + req.Region
+	}
+	for _, source := range w.blockedIPs {
+		if network.MatchesSource(ip, source) {
+			return "blocked IP " + source
+		}
+	}
+	if w.ruleSets[RuleSetIPReputation] {
+		for _, source := range reputationList {
+			if network.MatchesSource(ip, source) {
+				return string(RuleSetIPReputation)
+			}
+		}
+	}
+	if w.ruleSets[RuleSetSQLInjection] && matchesRequest(sqlInjectionSignature, req) {
+		return string(RuleSetSQLInjection)
+	}
+	if w.ruleSets[RuleSetXSS] && matchesRequest(xssSignature, req) {
+		return string(RuleSetXSS)
+	}
+	if w.rateLimit > 0 && w.overRate(ip, now) {
+		return "rate-based"
+	}
+	return ""
+}
+
+// matchesRequest looks for a signature in the path and headers, decoded
+// the way the backend would see them
+func matchesRequest(signature *regexp.Regexp, req *engine.Request) bool {
+	path := req.Path
+	if decoded, err := url.QueryUnescape(path); err == nil {
+		path = decoded
+	}
+	if signature.MatchString(path) {
+		return true
+	}
+	for _, value := range req.Headers {
+		if signature.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// overRate counts a request from an address and reports whether it has
+// gone over the limit this window
+func (w *wafState) overRate(ip string, now time.Time) bool {
+	if now.Sub(w.lastSweep) >= w.rateWindow {
+		for address, window := range w.windows {
+			if now.Sub(window.start) >= w.rateWindow {
+				delete(w.windows, address)
+			}
+		}
+		w.lastSweep = now
+	}
+
+	window, exists := w.windows[ip]
+	if !exists || now.Sub(window.start) >= w.rateWindow {
+		window = &ipWindow{start: now}
+		w.windows[ip] = window
+	}
+	window.count++
+	return window.count > w.rateLimit
+}
+
+// cost is the hourly price of a web ACL with its rules, plus requests
+// inspected at the current rate
+func (w *wafState) cost(customRules int, perSecond int64) float64 {
+	const hoursPerMonth = 730
+	rules := customRules + len(w.ruleSets)
+	if len(w.blockedRegions) > 0 {
+		rules++
+	}
+	if w.rateLimit > 0 {
+		rules++
+	}
+	return (5+float64(rules))/hoursPerMonth + float64(perSecond)*3600/1e6*0.60
+}
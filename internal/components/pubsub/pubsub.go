@@ -0,0 +1,273 @@
+package pubsub
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// TopicMetadata names the topic a request is published to, in
+// Request.Metadata. Requests without it go to the default topic.
+const TopicMetadata = "topic"
+
+// Message is one publish, shared by every subscription it fans out to
+type Message struct {
+	ID        string
+	Topic     string
+	Request   *engine.Request
+	Published time.Time
+	Attempt   int // set on the copies Pull hands out
+}
+
+// PubSub fans every message published to a topic out to all of the topic's
+// subscriptions whose filter matches. Each subscription has a backlog of its
+// own and is delivered to at least once, so a slow or failing subscriber
+// only holds up itself.
+type PubSub struct {
+	ID             string
+	Region         string
+	DefaultTopic   string
+	PublishLatency time.Duration // until the message is durably stored
+	// With isolation off the publisher waits while the message is pushed to
+	// every subscriber in turn, so the slowest one slows every publish
+	Isolated      bool
+	healthy       bool
+	metrics       *engine.Metrics
+	metricsMutex  sync.RWMutex
+	topics        map[string]bool
+	subscriptions map[string]*Subscription
+	published     int64
+	mu            sync.Mutex
+	costPerHour   float64
+}
+
+func NewPubSub(id, region string) *PubSub {
+	ps := &PubSub{
+		ID:             id,
+		Region:         region,
+		DefaultTopic:   "notifications",
+		PublishLatency: 2 * time.Millisecond,
+		Isolated:       true,
+		healthy:        true,
+		metrics:        &engine.Metrics{},
+		topics:         make(map[string]bool),
+		subscriptions:  make(map[string]*Subscription),
+		costPerHour:    0.04,
+	}
+	ps.topics[ps.DefaultTopic] = true
+	return ps
+}
+
+func (ps *PubSub) GetID() string {
+	return ps.ID
+}
+
+func (ps *PubSub) GetType() string {
+	return "pubsub"
+}
+
+func (ps *PubSub) GetRegion() string {
+	return ps.Region
+}
+
+// AddTopic creates a topic to publish to
+func (ps *PubSub) AddTopic(name string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.topics[name] = true
+}
+
+func (ps *PubSub) GetTopics() []string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	topics := make([]string, 0, len(ps.topics))
+	for name := range ps.topics {
+		topics = append(topics, name)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// SetIsolated switches between publishing into per-subscriber backlogs and
+// pushing to every subscriber before the publish returns
+func (ps *PubSub) SetIsolated(isolated bool) {
+	ps.mu.Lock()
+	ps.Isolated = isolated
+	ps.mu.Unlock()
+}
+
+// Process publishes the request. It is answered once the message is stored
+// for every matching subscription, or with isolation off once every push
+// subscriber has had a first attempt at it.
+func (ps *PubSub) Process(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+
+	ps.metricsMutex.Lock()
+	ps.metrics.RequestCount++
+	ps.metricsMutex.Unlock()
+
+	name := ps.DefaultTopic
+	if topic, ok := req.Metadata[TopicMetadata].(string); ok {
+		name = topic
+	}
+
+	ps.mu.Lock()
+	if !ps.healthy {
+		ps.mu.Unlock()
+		return ps.fail(req, start, fmt.Errorf("pub/sub is unhealthy"))
+	}
+	if !ps.topics[name] {
+		ps.mu.Unlock()
+		return ps.fail(req, start, fmt.Errorf("topic %s not found", name))
+	}
+	ps.published++
+	msg := &Message{
+		ID:        fmt.Sprintf("%s-%d", name, ps.published),
+		Topic:     name,
+		Request:   req,
+		Published: time.Now(),
+	}
+	isolated := ps.Isolated
+	inline := make([]*delivery, 0)
+	fanOut := 0
+	for _, sub := range ps.subscriptions {
+		if sub.Topic != name || !sub.Filter.Matches(req) {
+			continue
+		}
+		fanOut++
+		d := sub.enqueue(msg, time.Now())
+		if !isolated && sub.Endpoint != nil {
+			d.inFlight = true
+			d.attempts++
+			inline = append(inline, d)
+		}
+	}
+	ps.mu.Unlock()
+
+	time.Sleep(ps.PublishLatency)
+
+	for _, d := range inline {
+		ps.push(d.sub, d)
+	}
+
+	totalLatency := time.Since(start)
+	ps.metricsMutex.Lock()
+	ps.metrics.SuccessCount++
+	ps.metrics.TotalLatency += totalLatency
+	ps.metrics.AverageLatency = time.Duration(int64(ps.metrics.TotalLatency) / ps.metrics.RequestCount)
+	ps.metricsMutex.Unlock()
+
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   true,
+		Latency:   totalLatency,
+		HopsTrace: []string{ps.ID},
+		Metadata: map[string]interface{}{
+			"topic":   name,
+			"fan_out": fanOut,
+		},
+	}, nil
+}
+
+func (ps *PubSub) fail(req *engine.Request, start time.Time, err error) (*engine.Response, error) {
+	ps.metricsMutex.Lock()
+	ps.metrics.FailureCount++
+	ps.metricsMutex.Unlock()
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   false,
+		Latency:   time.Since(start),
+		Error:     err,
+	}, err
+}
+
+// Tick takes back pulled messages past their ack deadline and sets push
+// deliveries to work
+func (ps *PubSub) Tick(now time.Time) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	wall := time.Now()
+	for _, sub := range ps.subscriptions {
+		sub.expireLeases(wall)
+		if sub.Endpoint == nil || !ps.healthy {
+			continue
+		}
+		ready := sub.ready(wall)
+		for sub.running < sub.MaxInFlight && sub.running < ready {
+			sub.running++
+			go ps.deliver(sub)
+		}
+	}
+}
+
+// HasSubscriber reports whether a subscription pushes to the component
+func (ps *PubSub) HasSubscriber(endpoint engine.Component) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for _, sub := range ps.subscriptions {
+		if sub.Endpoint == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// GetQueueDepth is the backlog of the subscription furthest behind
+func (ps *PubSub) GetQueueDepth() int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	depth := 0
+	for _, sub := range ps.subscriptions {
+		if len(sub.backlog) > depth {
+			depth = len(sub.backlog)
+		}
+	}
+	return depth
+}
+
+func (ps *PubSub) GetMetrics() *engine.Metrics {
+	ps.metricsMutex.RLock()
+	metricsCopy := *ps.metrics
+	ps.metricsMutex.RUnlock()
+
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	metricsCopy.QueueDepth = int64(ps.GetQueueDepth())
+	for _, stats := range ps.GetSubscriptionStats() {
+		metricsCopy.ConsumerLag += int64(stats.Backlog)
+		if stats.OldestAge > metricsCopy.OldestMessageAge {
+			metricsCopy.OldestMessageAge = stats.OldestAge
+		}
+	}
+	return &metricsCopy
+}
+
+// GetCost is the broker plus a share per subscription
+func (ps *PubSub) GetCost() float64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.costPerHour + 0.005*float64(len(ps.subscriptions))
+}
+
+func (ps *PubSub) IsHealthy() bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.healthy
+}
+
+func (ps *PubSub) SetHealthy(healthy bool) {
+	ps.mu.Lock()
+	ps.healthy = healthy
+	ps.mu.Unlock()
+}
@@ -0,0 +1,439 @@
+package pubsub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// Filter picks the messages a subscription receives. Empty fields match
+// everything.
+type Filter struct {
+	PathPrefix string
+	Attribute  string // a Request.Metadata key that must equal Value
+	Value      string
+}
+
+func (f Filter) Matches(req *engine.Request) bool {
+	if f.PathPrefix != "" && !strings.HasPrefix(req.Path, f.PathPrefix) {
+		return false
+	}
+	if f.Attribute != "" {
+		value, exists := req.Metadata[f.Attribute]
+		if !exists || fmt.Sprint(value) != f.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func (f Filter) String() string {
+	parts := []string{}
+	if f.PathPrefix != "" {
+		parts = append(parts, "path "+f.PathPrefix+"*")
+	}
+	if f.Attribute != "" {
+		parts = append(parts, f.Attribute+"="+f.Value)
+	}
+	if len(parts) == 0 {
+		return "all messages"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Subscription receives a topic's matching messages. Push subscriptions
+// deliver to their endpoint, retrying failures with exponential backoff;
+// pull subscriptions wait for consumers to Pull and Ack. A message that
+// fails MaxAttempts times goes to the dead letters, and a backlog over
+// MaxBacklog sheds its oldest messages.
+type Subscription struct {
+	Name         string
+	Topic        string
+	Endpoint     engine.Component // nil for pull subscriptions
+	Filter       Filter
+	MaxInFlight  int // concurrent pushes to the endpoint
+	MaxAttempts  int
+	RetryBackoff time.Duration // before the first retry, doubling after each up to maxRetryBackoff
+	AckDeadline  time.Duration // for pulled messages
+	MaxBacklog   int
+	backlog      []*delivery // oldest first
+	deadLetters  []*Message
+	running      int // push deliveries under way
+	stats        SubscriptionStats
+	totalLatency time.Duration
+}
+
+// maxRetryBackoff caps the doubling, so unlimited attempts keep retrying
+// every ten minutes instead of overflowing
+const maxRetryBackoff = 10 * time.Minute
+
+// delivery is a message waiting on one subscription
+type delivery struct {
+	sub       *Subscription
+	msg       *Message
+	attempts  int
+	inFlight  bool
+	deadline  time.Time // for pulled messages, when they are handed out again
+	notBefore time.Time // retry backoff
+}
+
+// SubscriptionStats is how one subscriber is keeping up
+type SubscriptionStats struct {
+	Name           string
+	Topic          string
+	Mode           string
+	Endpoint       string
+	Filter         string
+	Backlog        int
+	InFlight       int
+	Delivered      int64
+	Retries        int64
+	TimedOut       int64 // pulled messages not acked within the ack deadline
+	DeadLettered   int64
+	Dropped        int64         // shed because the backlog was full
+	DeadLetters    int           // waiting to be redriven
+	AverageLatency time.Duration // from publish to delivery
+	OldestAge      time.Duration
+}
+
+// AddSubscription subscribes to a topic from now on. A nil endpoint makes a
+// pull subscription.
+func (ps *PubSub) AddSubscription(name, topic string, endpoint engine.Component) (*Subscription, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if !ps.topics[topic] {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+	if sub, exists := ps.subscriptions[name]; exists {
+		return sub, nil
+	}
+	sub := &Subscription{
+		Name:         name,
+		Topic:        topic,
+		Endpoint:     endpoint,
+		MaxInFlight:  10,
+		MaxAttempts:  5,
+		RetryBackoff: 100 * time.Millisecond,
+		AckDeadline:  10 * time.Second,
+		MaxBacklog:   10000,
+	}
+	ps.subscriptions[name] = sub
+	return sub, nil
+}
+
+// RemoveSubscription drops a subscription and its backlog
+func (ps *PubSub) RemoveSubscription(name string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.subscriptions, name)
+}
+
+func (ps *PubSub) SetFilter(name string, filter Filter) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sub, exists := ps.subscriptions[name]
+	if !exists {
+		return fmt.Errorf("subscription %s not found", name)
+	}
+	sub.Filter = filter
+	return nil
+}
+
+// SetDeliverySettings changes how a subscription is delivered to
+func (ps *PubSub) SetDeliverySettings(name string, maxInFlight, maxAttempts int, backoff, ackDeadline time.Duration, maxBacklog int) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sub, exists := ps.subscriptions[name]
+	if !exists {
+		return fmt.Errorf("subscription %s not found", name)
+	}
+	sub.MaxInFlight = maxInFlight
+	sub.MaxAttempts = maxAttempts
+	sub.RetryBackoff = backoff
+	sub.AckDeadline = ackDeadline
+	sub.MaxBacklog = maxBacklog
+	return nil
+}
+
+// enqueue adds a message to the backlog, shedding the oldest waiting
+// message when it is full. The caller holds ps.mu.
+func (sub *Subscription) enqueue(msg *Message, now time.Time) *delivery {
+	if sub.MaxBacklog > 0 && len(sub.backlog) >= sub.MaxBacklog {
+		for i, d := range sub.backlog {
+			if !d.inFlight {
+				sub.backlog = append(sub.backlog[:i], sub.backlog[i+1:]...)
+				sub.stats.Dropped++
+				break
+			}
+		}
+	}
+	d := &delivery{sub: sub, msg: msg, notBefore: now}
+	sub.backlog = append(sub.backlog, d)
+	return d
+}
+
+// ready counts messages waiting to be handed out. The caller holds ps.mu.
+func (sub *Subscription) ready(now time.Time) int {
+	count := 0
+	for _, d := range sub.backlog {
+		if !d.inFlight && !now.Before(d.notBefore) {
+			count++
+		}
+	}
+	return count
+}
+
+// next hands out the oldest message ready for delivery. The caller holds
+// ps.mu.
+func (sub *Subscription) next(now time.Time) *delivery {
+	for _, d := range sub.backlog {
+		if !d.inFlight && !now.Before(d.notBefore) {
+			d.inFlight = true
+			d.attempts++
+			return d
+		}
+	}
+	return nil
+}
+
+func (sub *Subscription) remove(d *delivery) bool {
+	for i, waiting := range sub.backlog {
+		if waiting == d {
+			sub.backlog = append(sub.backlog[:i], sub.backlog[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// find looks a message up in the backlog. The caller holds ps.mu.
+func (sub *Subscription) find(msgID string) *delivery {
+	for _, d := range sub.backlog {
+		if d.msg.ID == msgID {
+			return d
+		}
+	}
+	return nil
+}
+
+// delivered settles a message the subscriber took. The caller holds ps.mu.
+func (sub *Subscription) delivered(d *delivery) {
+	if sub.remove(d) {
+		sub.stats.Delivered++
+		sub.totalLatency += time.Since(d.msg.Published)
+	}
+}
+
+// failed backs a message off for a retry, or dead-letters it once it has
+// used up its attempts. The caller holds ps.mu.
+func (sub *Subscription) failed(d *delivery, now time.Time) {
+	d.inFlight = false
+	d.deadline = time.Time{}
+	if sub.MaxAttempts > 0 && d.attempts >= sub.MaxAttempts {
+		if sub.remove(d) {
+			sub.deadLetters = append(sub.deadLetters, d.msg)
+			sub.stats.DeadLettered++
+		}
+		return
+	}
+	sub.stats.Retries++
+	d.notBefore = now.Add(sub.retryBackoff(d.attempts))
+}
+
+// retryBackoff is the wait before retrying a message that has failed
+// attempts times
+func (sub *Subscription) retryBackoff(attempts int) time.Duration {
+	backoff := sub.RetryBackoff
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
+
+// expireLeases takes back pulled messages past their ack deadline. The
+// caller holds ps.mu.
+func (sub *Subscription) expireLeases(now time.Time) {
+	for _, d := range append([]*delivery(nil), sub.backlog...) {
+		if d.inFlight && !d.deadline.IsZero() && now.After(d.deadline) {
+			sub.stats.TimedOut++
+			sub.failed(d, now)
+		}
+	}
+}
+
+// deliver is one push delivery loop for a subscription. It stops when
+// nothing is ready, and Tick starts it again.
+func (ps *PubSub) deliver(sub *Subscription) {
+	for {
+		ps.mu.Lock()
+		var d *delivery
+		if ps.healthy {
+			d = sub.next(time.Now())
+		}
+		if d == nil {
+			sub.running--
+			ps.mu.Unlock()
+			return
+		}
+		ps.mu.Unlock()
+
+		ps.push(sub, d)
+	}
+}
+
+// push makes one attempt at delivering a message to the endpoint
+func (ps *PubSub) push(sub *Subscription, d *delivery) {
+	req := *d.msg.Request
+	req.Source = ps.ID
+	resp, err := sub.Endpoint.Process(&req)
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err != nil || (resp != nil && !resp.Success) {
+		sub.failed(d, time.Now())
+		return
+	}
+	sub.delivered(d)
+}
+
+// Pull hands out up to max waiting messages of a subscription. Each must be
+// acked within the ack deadline or it is delivered again.
+func (ps *PubSub) Pull(name string, max int) ([]*Message, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sub, exists := ps.subscriptions[name]
+	if !exists {
+		return nil, fmt.Errorf("subscription %s not found", name)
+	}
+	if !ps.healthy {
+		return nil, fmt.Errorf("pub/sub is unhealthy")
+	}
+	now := time.Now()
+	sub.expireLeases(now)
+
+	messages := make([]*Message, 0, max)
+	for len(messages) < max {
+		d := sub.next(now)
+		if d == nil {
+			break
+		}
+		d.deadline = now.Add(sub.AckDeadline)
+		copied := *d.msg
+		copied.Attempt = d.attempts
+		messages = append(messages, &copied)
+	}
+	return messages, nil
+}
+
+// Ack settles a pulled message. Acking one that was already settled is a
+// no-op, as happens when a redelivered duplicate is acked too.
+func (ps *PubSub) Ack(name, msgID string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if sub, exists := ps.subscriptions[name]; exists {
+		if d := sub.find(msgID); d != nil {
+			sub.delivered(d)
+		}
+	}
+}
+
+// Nack gives a pulled message back for a retry
+func (ps *PubSub) Nack(name, msgID string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if sub, exists := ps.subscriptions[name]; exists {
+		if d := sub.find(msgID); d != nil && d.inFlight {
+			sub.failed(d, time.Now())
+		}
+	}
+}
+
+// RedriveDeadLetters puts a subscription's dead letters back in its backlog
+// with fresh attempts
+func (ps *PubSub) RedriveDeadLetters(name string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sub, exists := ps.subscriptions[name]
+	if !exists {
+		return 0
+	}
+	now := time.Now()
+	for _, msg := range sub.deadLetters {
+		sub.enqueue(msg, now)
+	}
+	count := len(sub.deadLetters)
+	sub.deadLetters = nil
+	return count
+}
+
+func (ps *PubSub) GetSubscriptionStats() []SubscriptionStats {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]SubscriptionStats, 0, len(ps.subscriptions))
+	for _, sub := range ps.subscriptions {
+		subStats := sub.stats
+		subStats.Name = sub.Name
+		subStats.Topic = sub.Topic
+		subStats.Mode = "pull"
+		if sub.Endpoint != nil {
+			subStats.Mode = "push"
+			subStats.Endpoint = sub.Endpoint.GetID()
+		}
+		subStats.Filter = sub.Filter.String()
+		subStats.Backlog = len(sub.backlog)
+		subStats.DeadLetters = len(sub.deadLetters)
+		for _, d := range sub.backlog {
+			if d.inFlight {
+				subStats.InFlight++
+			}
+			if age := now.Sub(d.msg.Published); age > subStats.OldestAge {
+				subStats.OldestAge = age
+			}
+		}
+		if sub.stats.Delivered > 0 {
+			subStats.AverageLatency = sub.totalLatency / time.Duration(sub.stats.Delivered)
+		}
+		stats = append(stats, subStats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// GetSubscription returns a subscription's settings
+func (ps *PubSub) GetSubscription(name string) (Subscription, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sub, exists := ps.subscriptions[name]
+	if !exists {
+		return Subscription{}, false
+	}
+	return Subscription{
+		Name:         sub.Name,
+		Topic:        sub.Topic,
+		Endpoint:     sub.Endpoint,
+		Filter:       sub.Filter,
+		MaxInFlight:  sub.MaxInFlight,
+		MaxAttempts:  sub.MaxAttempts,
+		RetryBackoff: sub.RetryBackoff,
+		AckDeadline:  sub.AckDeadline,
+		MaxBacklog:   sub.MaxBacklog,
+	}, true
+}
@@ -0,0 +1,344 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// ConsumerGroup works through a topic, each partition in order. Only one
+// delivery per partition is out at a time, so consumers beyond the number of
+// partitions sit idle. A delivery not acked within the visibility timeout
+// is handed out again; after MaxDeliveries it goes to the dead letters.
+type ConsumerGroup struct {
+	Name              string
+	Topic             string
+	Target            engine.Component // push consumers call it; nil for pull consumers
+	Parallelism       int
+	ProcessingTime    time.Duration // spent on each message before calling Target
+	VisibilityTimeout time.Duration
+	MaxDeliveries     int
+	committed         []int64 // next offset to consume in each partition
+	leases            map[int]*lease
+	deliveries        map[string]int // by message ID, until the message is committed
+	nextPartition     int
+	running           int // push consumers delivering now
+	stats             GroupStats
+	totalAge          time.Duration
+}
+
+// lease is a run of one partition's messages handed out together
+type lease struct {
+	receipt  int64
+	messages []*Message
+	acked    map[int64]bool
+	deadline time.Time
+}
+
+// GroupStats is how far a consumer group has got
+type GroupStats struct {
+	Name         string
+	Topic        string
+	Lag          int64 // messages produced but not yet consumed
+	InFlight     int
+	Processed    int64
+	Failed       int64 // deliveries nacked by consumers
+	Redelivered  int64
+	TimedOut     int64 // deliveries not acked within the visibility timeout
+	DeadLettered int64
+	Expired      int64         // dropped by retention before the group consumed them
+	AverageAge   time.Duration // from produce to ack
+	OldestAge    time.Duration // of the oldest message not yet consumed
+	Idle         int           // consumers with no partition free to work on
+}
+
+// AddConsumerGroup starts a consumer group at the end of the topic's
+// current log. A nil target makes a pull group that consumers drive
+// through Receive, Ack and Nack.
+func (q *Queue) AddConsumerGroup(name, topicName string, target engine.Component) (*ConsumerGroup, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	topic, exists := q.topics[topicName]
+	if !exists {
+		return nil, fmt.Errorf("topic %s not found", topicName)
+	}
+	if group, exists := q.groups[name]; exists {
+		return group, nil
+	}
+
+	group := &ConsumerGroup{
+		Name:              name,
+		Topic:             topicName,
+		Target:            target,
+		Parallelism:       len(topic.partitions),
+		ProcessingTime:    20 * time.Millisecond,
+		VisibilityTimeout: 5 * time.Second,
+		MaxDeliveries:     5,
+		leases:            make(map[int]*lease),
+		deliveries:        make(map[string]int),
+	}
+	for _, part := range topic.partitions {
+		group.committed = append(group.committed, part.next)
+	}
+	q.groups[name] = group
+	return group, nil
+}
+
+// RemoveConsumerGroup stops a group; what it had in flight is dropped
+func (q *Queue) RemoveConsumerGroup(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.groups, name)
+}
+
+// SetConsumerSettings changes how a group consumes
+func (q *Queue) SetConsumerSettings(name string, parallelism int, processing, visibility time.Duration, maxDeliveries int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	group, exists := q.groups[name]
+	if !exists {
+		return fmt.Errorf("consumer group %s not found", name)
+	}
+	group.Parallelism = parallelism
+	group.ProcessingTime = processing
+	group.VisibilityTimeout = visibility
+	group.MaxDeliveries = maxDeliveries
+	return nil
+}
+
+func (g *ConsumerGroup) grow(partitions int) {
+	for len(g.committed) < partitions {
+		g.committed = append(g.committed, 0)
+	}
+}
+
+// Receive hands out up to max messages from the next partition with nothing
+// in flight, in order. Messages that have used up their deliveries go to
+// the dead letters instead.
+func (q *Queue) Receive(groupName string, max int) ([]*Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	group, exists := q.groups[groupName]
+	if !exists {
+		return nil, fmt.Errorf("consumer group %s not found", groupName)
+	}
+	if !q.healthy {
+		return nil, fmt.Errorf("queue is unhealthy")
+	}
+	topic := q.topics[group.Topic]
+	now := time.Now()
+	group.expireLeases(q, now)
+
+	for i := 0; i < len(topic.partitions); i++ {
+		p := (group.nextPartition + i) % len(topic.partitions)
+		if _, leased := group.leases[p]; leased {
+			continue
+		}
+		part := topic.partitions[p]
+
+		offset := group.committed[p]
+		for msg := part.at(offset); msg != nil && group.MaxDeliveries > 0 && group.deliveries[msg.ID] >= group.MaxDeliveries; msg = part.at(offset) {
+			topic.deadLetters = append(topic.deadLetters, msg)
+			delete(group.deliveries, msg.ID)
+			group.stats.DeadLettered++
+			offset++
+		}
+		group.committed[p] = offset
+
+		q.nextReceipt++
+		l := &lease{receipt: q.nextReceipt, acked: make(map[int64]bool), deadline: now.Add(group.VisibilityTimeout)}
+		for msg := part.at(offset); msg != nil && len(l.messages) < max; msg = part.at(offset) {
+			l.messages = append(l.messages, msg)
+			offset++
+		}
+		if len(l.messages) == 0 {
+			continue
+		}
+
+		delivered := make([]*Message, 0, len(l.messages))
+		for _, msg := range l.messages {
+			group.deliveries[msg.ID]++
+			if group.deliveries[msg.ID] > 1 {
+				group.stats.Redelivered++
+			}
+			copied := *msg
+			copied.Receipt = l.receipt
+			delivered = append(delivered, &copied)
+		}
+		group.leases[p] = l
+		group.nextPartition = p + 1
+		return delivered, nil
+	}
+	return nil, nil
+}
+
+// Ack marks a message consumed. Acks for a delivery that already timed out
+// are ignored; the message is being delivered again.
+func (q *Queue) Ack(groupName string, msg *Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	group, l := q.leaseFor(groupName, msg)
+	if l == nil {
+		return
+	}
+	l.acked[msg.Offset] = true
+	group.stats.Processed++
+	group.totalAge += time.Since(msg.Produced)
+	if len(l.acked) == len(l.messages) {
+		group.settle(q, msg.Partition, l)
+	}
+}
+
+// Nack gives a message back. It and the rest of its delivery are handed
+// out again.
+func (q *Queue) Nack(groupName string, msg *Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	group, l := q.leaseFor(groupName, msg)
+	if l == nil {
+		return
+	}
+	group.stats.Failed++
+	group.settle(q, msg.Partition, l)
+}
+
+// leaseFor finds the delivery a message came in. The caller holds q.mu.
+func (q *Queue) leaseFor(groupName string, msg *Message) (*ConsumerGroup, *lease) {
+	group, exists := q.groups[groupName]
+	if !exists {
+		return nil, nil
+	}
+	l, leased := group.leases[msg.Partition]
+	if !leased || l.receipt != msg.Receipt {
+		return nil, nil
+	}
+	return group, l
+}
+
+// settle commits the acked messages at the start of a delivery and frees
+// its partition, so the rest is delivered again. The caller holds q.mu.
+func (g *ConsumerGroup) settle(q *Queue, p int, l *lease) {
+	offset := g.committed[p]
+	for _, msg := range l.messages {
+		if !l.acked[msg.Offset] {
+			break
+		}
+		offset = msg.Offset + 1
+		delete(g.deliveries, msg.ID)
+	}
+	if base := q.topics[g.Topic].partitions[p].base; offset < base {
+		offset = base
+	}
+	if offset > g.committed[p] {
+		g.committed[p] = offset
+	}
+	delete(g.leases, p)
+}
+
+// expireLeases takes back deliveries past their visibility timeout. The
+// caller holds q.mu.
+func (g *ConsumerGroup) expireLeases(q *Queue, now time.Time) {
+	for p, l := range g.leases {
+		if now.After(l.deadline) {
+			g.stats.TimedOut++
+			g.settle(q, p, l)
+		}
+	}
+}
+
+// lag is how many messages the group has yet to consume. The caller holds
+// q.mu.
+func (g *ConsumerGroup) lag(topic *Topic) int64 {
+	lag := int64(0)
+	for p, part := range topic.partitions {
+		lag += part.next - g.committed[p]
+	}
+	return lag
+}
+
+// consume is one push consumer: it takes messages one at a time, spends
+// the processing time on each and hands it to the target, until no
+// partition has work for it
+func (q *Queue) consume(group *ConsumerGroup) {
+	defer func() {
+		q.mu.Lock()
+		group.running--
+		q.mu.Unlock()
+	}()
+
+	for {
+		messages, err := q.Receive(group.Name, 1)
+		if err != nil || len(messages) == 0 {
+			return
+		}
+		msg := messages[0]
+
+		time.Sleep(group.ProcessingTime)
+		req := *msg.Request
+		req.Source = q.ID
+		resp, err := group.Target.Process(&req)
+		if err != nil || (resp != nil && !resp.Success) {
+			q.Nack(group.Name, msg)
+		} else {
+			q.Ack(group.Name, msg)
+		}
+	}
+}
+
+func (q *Queue) GetGroupStats() []GroupStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]GroupStats, 0, len(q.groups))
+	for _, group := range q.groups {
+		topic := q.topics[group.Topic]
+		groupStats := group.stats
+		groupStats.Name = group.Name
+		groupStats.Topic = group.Topic
+		groupStats.Lag = group.lag(topic)
+		groupStats.InFlight = len(group.leases)
+		if group.stats.Processed > 0 {
+			groupStats.AverageAge = group.totalAge / time.Duration(group.stats.Processed)
+		}
+		for p, part := range topic.partitions {
+			if msg := part.at(group.committed[p]); msg != nil && now.Sub(msg.Produced) > groupStats.OldestAge {
+				groupStats.OldestAge = now.Sub(msg.Produced)
+			}
+		}
+		if group.Target != nil && group.Parallelism > len(topic.partitions) {
+			groupStats.Idle = group.Parallelism - len(topic.partitions)
+		}
+		stats = append(stats, groupStats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// GetConsumerGroup returns a group's settings
+func (q *Queue) GetConsumerGroup(name string) (ConsumerGroup, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	group, exists := q.groups[name]
+	if !exists {
+		return ConsumerGroup{}, false
+	}
+	return ConsumerGroup{
+		Name:              group.Name,
+		Topic:             group.Topic,
+		Target:            group.Target,
+		Parallelism:       group.Parallelism,
+		ProcessingTime:    group.ProcessingTime,
+		VisibilityTimeout: group.VisibilityTimeout,
+		MaxDeliveries:     group.MaxDeliveries,
+	}, true
+}
@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// newPullQueue returns a queue with a one-partition topic and a pull group
+// reading it
+func newPullQueue(t *testing.T, visibility time.Duration, maxDeliveries int) *Queue {
+	t.Helper()
+	q := NewQueue("queue", "us-east-1")
+	q.ProduceLatency = 0
+	q.AddTopic("orders", 1)
+	if _, err := q.AddConsumerGroup("billing", "orders", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.SetConsumerSettings("billing", 1, 0, visibility, maxDeliveries); err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func produce(t *testing.T, q *Queue, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		req := &engine.Request{ID: fmt.Sprintf("order-%d", i), DataSize: 64, Metadata: map[string]interface{}{TopicMetadata: "orders"}}
+		if _, err := q.Process(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func receive(t *testing.T, q *Queue, max int) []*Message {
+	t.Helper()
+	messages, err := q.Receive("billing", max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func offsets(messages []*Message) []int64 {
+	result := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		result = append(result, msg.Offset)
+	}
+	return result
+}
+
+func groupStats(q *Queue) GroupStats {
+	return q.GetGroupStats()[0]
+}
+
+func ordersStats(t *testing.T, q *Queue) TopicStats {
+	t.Helper()
+	for _, stats := range q.GetTopicStats() {
+		if stats.Name == "orders" {
+			return stats
+		}
+	}
+	t.Fatal("topic orders not found")
+	return TopicStats{}
+}
+
+// A delivery holds its partition until its visibility timeout, then goes
+// out again; an ack for the expired delivery is ignored
+func TestVisibilityTimeoutRedelivers(t *testing.T) {
+	q := newPullQueue(t, 20*time.Millisecond, 5)
+	produce(t, q, 2)
+
+	first := receive(t, q, 2)
+	if len(first) != 2 {
+		t.Fatalf("received %d messages, want 2", len(first))
+	}
+	if again := receive(t, q, 2); len(again) != 0 {
+		t.Fatalf("received %v while the partition was leased", offsets(again))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	second := receive(t, q, 2)
+	if fmt.Sprint(offsets(second)) != "[0 1]" {
+		t.Fatalf("redelivered %v, want [0 1]", offsets(second))
+	}
+	stats := groupStats(q)
+	if stats.TimedOut != 1 || stats.Redelivered != 2 {
+		t.Errorf("%d timed out and %d redelivered, want 1 and 2", stats.TimedOut, stats.Redelivered)
+	}
+
+	q.Ack("billing", first[0])
+	if stats := groupStats(q); stats.Processed != 0 {
+		t.Error("an ack for an expired delivery counted")
+	}
+	for _, msg := range second {
+		q.Ack("billing", msg)
+	}
+	if stats := groupStats(q); stats.Processed != 2 || stats.Lag != 0 || stats.InFlight != 0 {
+		t.Errorf("processed %d, lag %d, in flight %d; want 2, 0 and 0", stats.Processed, stats.Lag, stats.InFlight)
+	}
+}
+
+// Expiry also happens on Tick, so a lease does not outlive its timeout
+// just because no consumer asks for more
+func TestTickExpiresLeases(t *testing.T) {
+	q := newPullQueue(t, 10*time.Millisecond, 5)
+	produce(t, q, 1)
+	receive(t, q, 1)
+
+	time.Sleep(20 * time.Millisecond)
+	q.Tick(time.Now())
+	if stats := groupStats(q); stats.TimedOut != 1 || stats.InFlight != 0 {
+		t.Errorf("%d timed out, %d in flight; want 1 and 0", stats.TimedOut, stats.InFlight)
+	}
+}
+
+// A nack commits the messages acked before it and hands out the rest again
+func TestNackRedeliversRest(t *testing.T) {
+	q := newPullQueue(t, time.Minute, 5)
+	produce(t, q, 3)
+
+	messages := receive(t, q, 3)
+	q.Ack("billing", messages[0])
+	q.Nack("billing", messages[1])
+
+	again := receive(t, q, 3)
+	if fmt.Sprint(offsets(again)) != "[1 2]" {
+		t.Errorf("redelivered %v, want [1 2]", offsets(again))
+	}
+	if stats := groupStats(q); stats.Failed != 1 || stats.Processed != 1 {
+		t.Errorf("%d failed and %d processed, want 1 and 1", stats.Failed, stats.Processed)
+	}
+}
+
+// A message delivered MaxDeliveries times without an ack goes to the dead
+// letters, and the messages behind it are delivered
+func TestMaxDeliveriesDeadLetters(t *testing.T) {
+	q := newPullQueue(t, time.Minute, 2)
+	produce(t, q, 2)
+
+	for i := 0; i < 2; i++ {
+		messages := receive(t, q, 1)
+		if len(messages) != 1 || messages[0].Offset != 0 {
+			t.Fatalf("delivery %d was %v, want [0]", i+1, offsets(messages))
+		}
+		q.Nack("billing", messages[0])
+	}
+
+	next := receive(t, q, 1)
+	if fmt.Sprint(offsets(next)) != "[1]" {
+		t.Errorf("after dead-lettering received %v, want [1]", offsets(next))
+	}
+	if stats := groupStats(q); stats.DeadLettered != 1 {
+		t.Errorf("%d dead-lettered, want 1", stats.DeadLettered)
+	}
+	if topic := ordersStats(t, q); topic.DeadLetters != 1 {
+		t.Errorf("the topic holds %d dead letters, want 1", topic.DeadLetters)
+	}
+}
+
+// Retention drops messages by age or by bytes, and a group that never
+// consumed them counts them as expired and moves past them
+func TestRetentionExpiresUnconsumed(t *testing.T) {
+	tests := []struct {
+		name     string
+		age      time.Duration
+		bytes    int64
+		retained int
+	}{
+		{"by age", 10 * time.Millisecond, 0, 0},
+		{"by bytes", 0, 128, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newPullQueue(t, time.Minute, 5)
+			if err := q.SetRetention("orders", tt.age, tt.bytes); err != nil {
+				t.Fatal(err)
+			}
+			produce(t, q, 5)
+			time.Sleep(20 * time.Millisecond)
+			q.Tick(time.Now())
+
+			if topic := ordersStats(t, q); topic.Messages != tt.retained {
+				t.Errorf("%d messages retained, want %d", topic.Messages, tt.retained)
+			}
+			stats := groupStats(q)
+			if expired := int64(5 - tt.retained); stats.Expired != expired || stats.Lag != int64(tt.retained) {
+				t.Errorf("%d expired and lag %d, want %d and %d", stats.Expired, stats.Lag, expired, tt.retained)
+			}
+			if messages := receive(t, q, 5); len(messages) != tt.retained {
+				t.Errorf("received %d messages, want the %d retained", len(messages), tt.retained)
+			}
+		})
+	}
+}
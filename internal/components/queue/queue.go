@@ -0,0 +1,437 @@
+package queue
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+const (
+	// TopicMetadata names the topic a request is produced to, in
+	// Request.Metadata. Requests without it go to the default topic.
+	TopicMetadata = "topic"
+	// PartitionKeyMetadata overrides the key messages are partitioned by,
+	// which is otherwise the user, then the path
+	PartitionKeyMetadata = "partition_key"
+)
+
+// Message is a request produced to a topic. Receive hands out copies
+// carrying the receipt of that delivery.
+type Message struct {
+	ID        string
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       string
+	Request   *engine.Request
+	Size      int64
+	Produced  time.Time
+	Receipt   int64 // identifies the delivery, so acks after a timeout are ignored
+}
+
+type partition struct {
+	messages []*Message // retained log, oldest first
+	base     int64      // offset of messages[0]
+	next     int64      // offset of the next message produced
+	bytes    int64
+}
+
+func (p *partition) at(offset int64) *Message {
+	if offset < p.base || offset >= p.next {
+		return nil
+	}
+	return p.messages[offset-p.base]
+}
+
+// Topic is a log split into partitions. Messages with the same key go to
+// the same partition and are consumed in the order they were produced.
+type Topic struct {
+	Name           string
+	RetentionTime  time.Duration // 0 keeps messages until size retention drops them
+	RetentionBytes int64         // per partition; 0 keeps messages until they age out
+	partitions     []*partition
+	deadLetters    []*Message
+	nextPartition  int // for messages without a key
+}
+
+func newTopic(name string, partitions int) *Topic {
+	t := &Topic{
+		Name:          name,
+		RetentionTime: 10 * time.Minute,
+	}
+	t.addPartitions(partitions)
+	return t
+}
+
+func (t *Topic) addPartitions(count int) {
+	for len(t.partitions) < count {
+		t.partitions = append(t.partitions, &partition{})
+	}
+}
+
+// partitionFor hashes the key to a partition, spreading keyless messages
+// round-robin
+func (t *Topic) partitionFor(key string) int {
+	if key == "" {
+		p := t.nextPartition % len(t.partitions)
+		t.nextPartition++
+		return p
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(t.partitions)))
+}
+
+// TopicStats is one topic's log
+type TopicStats struct {
+	Name        string
+	Partitions  int
+	Messages    int   // retained in the log
+	Bytes       int64 // retained in the log
+	DeadLetters int
+}
+
+// Queue is a message log in the style of Kafka, with SQS-like visibility
+// timeouts: producers send requests to its topics through Process and
+// consumer groups work through each partition in order.
+type Queue struct {
+	ID             string
+	Region         string
+	DefaultTopic   string
+	ProduceLatency time.Duration // until the message is durably appended
+	healthy        bool
+	metrics        *engine.Metrics
+	metricsMutex   sync.RWMutex
+	topics         map[string]*Topic
+	groups         map[string]*ConsumerGroup
+	nextReceipt    int64
+	mu             sync.Mutex
+	costPerHour    float64
+}
+
+func NewQueue(id, region string) *Queue {
+	q := &Queue{
+		ID:             id,
+		Region:         region,
+		DefaultTopic:   "events",
+		ProduceLatency: 2 * time.Millisecond,
+		healthy:        true,
+		metrics:        &engine.Metrics{},
+		topics:         make(map[string]*Topic),
+		groups:         make(map[string]*ConsumerGroup),
+		costPerHour:    0.05,
+	}
+	q.AddTopic(q.DefaultTopic, 4)
+	return q
+}
+
+func (q *Queue) GetID() string {
+	return q.ID
+}
+
+func (q *Queue) GetType() string {
+	return "queue"
+}
+
+func (q *Queue) GetRegion() string {
+	return q.Region
+}
+
+// AddTopic creates a topic, or grows an existing one to the given number of
+// partitions. Partitions are never removed, and adding some moves keys to
+// new partitions, so their order only holds from then on.
+func (q *Queue) AddTopic(name string, partitions int) *Topic {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if partitions < 1 {
+		partitions = 1
+	}
+	if topic, exists := q.topics[name]; exists {
+		topic.addPartitions(partitions)
+		for _, group := range q.groups {
+			if group.Topic == name {
+				group.grow(len(topic.partitions))
+			}
+		}
+		return topic
+	}
+	topic := newTopic(name, partitions)
+	q.topics[name] = topic
+	return topic
+}
+
+// SetRetention changes how long, and how much per partition, a topic keeps
+func (q *Queue) SetRetention(name string, age time.Duration, bytes int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	topic, exists := q.topics[name]
+	if !exists {
+		return fmt.Errorf("topic %s not found", name)
+	}
+	topic.RetentionTime = age
+	topic.RetentionBytes = bytes
+	return nil
+}
+
+// Process produces the request as a message. The producer is answered once
+// the message is appended, long before anyone consumes it.
+func (q *Queue) Process(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+
+	q.metricsMutex.Lock()
+	q.metrics.RequestCount++
+	q.metricsMutex.Unlock()
+
+	if !q.IsHealthy() {
+		return q.fail(req, start, fmt.Errorf("queue is unhealthy"))
+	}
+
+	name := q.DefaultTopic
+	if topic, ok := req.Metadata[TopicMetadata].(string); ok {
+		name = topic
+	}
+	key, ok := req.Metadata[PartitionKeyMetadata].(string)
+	if !ok {
+		key = req.UserID
+		if key == "" {
+			key = req.Path
+		}
+	}
+
+	q.mu.Lock()
+	topic, exists := q.topics[name]
+	if !exists {
+		q.mu.Unlock()
+		return q.fail(req, start, fmt.Errorf("topic %s not found", name))
+	}
+	p := topic.partitionFor(key)
+	part := topic.partitions[p]
+	msg := &Message{
+		ID:        fmt.Sprintf("%s-%d-%d", name, p, part.next),
+		Topic:     name,
+		Partition: p,
+		Offset:    part.next,
+		Key:       key,
+		Request:   req,
+		Size:      req.DataSize,
+		Produced:  time.Now(),
+	}
+	part.messages = append(part.messages, msg)
+	part.next++
+	part.bytes += msg.Size
+	q.mu.Unlock()
+
+	time.Sleep(q.ProduceLatency)
+
+	totalLatency := time.Since(start)
+	q.metricsMutex.Lock()
+	q.metrics.SuccessCount++
+	q.metrics.TotalLatency += totalLatency
+	q.metrics.AverageLatency = time.Duration(int64(q.metrics.TotalLatency) / q.metrics.RequestCount)
+	q.metricsMutex.Unlock()
+
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   true,
+		Latency:   totalLatency,
+		HopsTrace: []string{q.ID},
+		Metadata: map[string]interface{}{
+			"topic":     name,
+			"partition": p,
+			"offset":    msg.Offset,
+		},
+	}, nil
+}
+
+func (q *Queue) fail(req *engine.Request, start time.Time, err error) (*engine.Response, error) {
+	q.metricsMutex.Lock()
+	q.metrics.FailureCount++
+	q.metricsMutex.Unlock()
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   false,
+		Latency:   time.Since(start),
+		Error:     err,
+	}, err
+}
+
+// Tick applies retention, expires deliveries past their visibility timeout
+// and sets push consumers to work
+func (q *Queue) Tick(now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	wall := time.Now()
+	for _, topic := range q.topics {
+		for p, part := range topic.partitions {
+			for len(part.messages) > 0 {
+				head := part.messages[0]
+				aged := topic.RetentionTime > 0 && wall.Sub(head.Produced) > topic.RetentionTime
+				full := topic.RetentionBytes > 0 && part.bytes > topic.RetentionBytes
+				if !aged && !full {
+					break
+				}
+				part.messages = part.messages[1:]
+				part.base++
+				part.bytes -= head.Size
+			}
+			for _, group := range q.groups {
+				if group.Topic == topic.Name && group.committed[p] < part.base {
+					// Consumers fell so far behind that retention dropped
+					// messages they never saw
+					group.stats.Expired += part.base - group.committed[p]
+					group.committed[p] = part.base
+				}
+			}
+		}
+	}
+
+	for _, group := range q.groups {
+		group.expireLeases(q, wall)
+		if group.Target == nil {
+			continue
+		}
+		for group.running < group.Parallelism {
+			group.running++
+			go q.consume(group)
+		}
+	}
+}
+
+// GetQueueDepth is the number of messages the furthest behind consumer
+// group has yet to finish, or all retained messages if nothing consumes
+// them. Autoscaling groups can scale consumers on it.
+func (q *Queue) GetQueueDepth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.groups) == 0 {
+		depth := 0
+		for _, topic := range q.topics {
+			for _, part := range topic.partitions {
+				depth += len(part.messages)
+			}
+		}
+		return depth
+	}
+	depth := int64(0)
+	for _, group := range q.groups {
+		if lag := group.lag(q.topics[group.Topic]); lag > depth {
+			depth = lag
+		}
+	}
+	return int(depth)
+}
+
+// HasConsumer reports whether a consumer group delivers to the component
+func (q *Queue) HasConsumer(target engine.Component) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, group := range q.groups {
+		if group.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Queue) GetTopicStats() []TopicStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := make([]TopicStats, 0, len(q.topics))
+	for _, topic := range q.topics {
+		topicStats := TopicStats{
+			Name:        topic.Name,
+			Partitions:  len(topic.partitions),
+			DeadLetters: len(topic.deadLetters),
+		}
+		for _, part := range topic.partitions {
+			topicStats.Messages += len(part.messages)
+			topicStats.Bytes += part.bytes
+		}
+		stats = append(stats, topicStats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// GetTopic returns a topic's settings
+func (q *Queue) GetTopic(name string) (Topic, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	topic, exists := q.topics[name]
+	if !exists {
+		return Topic{}, false
+	}
+	return Topic{Name: topic.Name, RetentionTime: topic.RetentionTime, RetentionBytes: topic.RetentionBytes}, true
+}
+
+// RedriveDeadLetters produces a topic's dead letters to it again
+func (q *Queue) RedriveDeadLetters(name string) int {
+	q.mu.Lock()
+	topic, exists := q.topics[name]
+	if !exists {
+		q.mu.Unlock()
+		return 0
+	}
+	deadLetters := topic.deadLetters
+	topic.deadLetters = nil
+	q.mu.Unlock()
+
+	for _, msg := range deadLetters {
+		go q.Process(msg.Request)
+	}
+	return len(deadLetters)
+}
+
+func (q *Queue) GetMetrics() *engine.Metrics {
+	q.metricsMutex.RLock()
+	metricsCopy := *q.metrics
+	q.metricsMutex.RUnlock()
+
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	metricsCopy.QueueDepth = int64(q.GetQueueDepth())
+	for _, stats := range q.GetGroupStats() {
+		metricsCopy.ConsumerLag += stats.Lag
+		if stats.OldestAge > metricsCopy.OldestMessageAge {
+			metricsCopy.OldestMessageAge = stats.OldestAge
+		}
+	}
+	return &metricsCopy
+}
+
+// GetCost is the broker plus a share per partition
+func (q *Queue) GetCost() float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	partitions := 0
+	for _, topic := range q.topics {
+		partitions += len(topic.partitions)
+	}
+	return q.costPerHour + 0.01*float64(partitions)
+}
+
+func (q *Queue) IsHealthy() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.healthy
+}
+
+func (q *Queue) SetHealthy(healthy bool) {
+	q.mu.Lock()
+	q.healthy = healthy
+	q.mu.Unlock()
+}
@@ -0,0 +1,439 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/database"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// QueryComplexityMetadata scales how much work a query is, in
+// Request.Metadata: 1 for a term lookup, more for wildcards, aggregations
+// and the like
+const QueryComplexityMetadata = "query_complexity"
+
+const gb = 1024 * 1024 * 1024
+
+// mergeSegments is how many segments a shard collects before they are
+// merged back into one
+const mergeSegments = 10
+
+// document is one indexed entry. Writes are buffered until the next
+// refresh makes them searchable.
+type document struct {
+	size       int64
+	searchable bool
+	pending    bool
+	written    time.Time
+}
+
+// SearchStats counts what the index has done
+type SearchStats struct {
+	Queries        int64
+	Indexed        int64
+	Rejected       int64 // refused by the circuit breaker or a full search queue
+	Refreshes      int64
+	Merges         int64
+	Searchable     int64
+	Pending        int64 // indexed but not searchable until the next refresh
+	Segments       int   // per shard, since the last merge
+	HeapUsage      float64
+	AverageLag     time.Duration // from write to searchable
+	MaxLag         time.Duration
+	ChangesApplied int64 // writes streamed from databases
+}
+
+// SearchIndex is a search cluster in the style of Elasticsearch. Queries
+// fan out to every shard and wait for the slowest; writes become
+// searchable only at the next refresh. A heap filling up slows everything
+// with GC pauses and eventually trips the circuit breaker.
+type SearchIndex struct {
+	ID              string
+	Region          string
+	Shards          int
+	Replicas        int // copies of each shard, which spread queries over more nodes
+	Nodes           int
+	HeapGB          float64 // per node
+	QueryThreads    int     // shard searches each node runs at once
+	RefreshInterval time.Duration
+	IndexLatency    time.Duration // a write on the primary shard, before replicating
+	docs            map[string]*document
+	pending         []string
+	searchable      int64
+	bytes           int64
+	segments        int
+	inFlight        int
+	lastRefresh     time.Time
+	stats           SearchStats
+	totalLag        time.Duration
+	lagged          int64
+	healthy         bool
+	metrics         *engine.Metrics
+	metricsMutex    sync.RWMutex
+	mu              sync.Mutex
+}
+
+func NewSearchIndex(id, region string, nodes int) *SearchIndex {
+	return &SearchIndex{
+		ID:              id,
+		Region:          region,
+		Shards:          5,
+		Replicas:        1,
+		Nodes:           nodes,
+		HeapGB:          4,
+		QueryThreads:    8,
+		RefreshInterval: time.Second,
+		IndexLatency:    3 * time.Millisecond,
+		docs:            make(map[string]*document),
+		healthy:         true,
+		metrics:         &engine.Metrics{},
+	}
+}
+
+func (si *SearchIndex) GetID() string {
+	return si.ID
+}
+
+func (si *SearchIndex) GetType() string {
+	return "search"
+}
+
+func (si *SearchIndex) GetRegion() string {
+	return si.Region
+}
+
+// SetTopology changes shards, replicas and nodes. Changing the number of
+// shards reindexes, so every document is searchable again only after the
+// next refresh.
+func (si *SearchIndex) SetTopology(shards, replicas, nodes int) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	if shards != si.Shards {
+		now := time.Now()
+		for key, doc := range si.docs {
+			if doc.searchable {
+				doc.searchable = false
+				doc.pending = true
+				doc.written = now
+				si.pending = append(si.pending, key)
+			}
+		}
+		si.searchable = 0
+		si.segments = 0
+	}
+	si.Shards = shards
+	si.Replicas = replicas
+	si.Nodes = nodes
+}
+
+// SetTuning changes the heap, search threads and refresh interval
+func (si *SearchIndex) SetTuning(heapGB float64, queryThreads int, refresh time.Duration) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	si.HeapGB = heapGB
+	si.QueryThreads = queryThreads
+	si.RefreshInterval = refresh
+}
+
+// Seed indexes documents the scenario starts with, already searchable
+func (si *SearchIndex) Seed(prefix string, count int, size int64) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	now := time.Now()
+	for i := 0; i < count; i++ {
+		key := fmt.Sprintf("%s/%d", prefix, i)
+		if _, exists := si.docs[key]; exists {
+			continue
+		}
+		si.docs[key] = &document{size: size, searchable: true, written: now}
+		si.searchable++
+		si.bytes += size
+	}
+}
+
+// heapUsage is the share of the cluster's heap in use. Every document costs
+// heap for its terms and doc values, pending writes sit in the indexing
+// buffer, and each query in flight holds its results. The caller holds
+// si.mu.
+func (si *SearchIndex) heapUsage() float64 {
+	capacity := float64(si.Nodes) * si.HeapGB * gb
+	if capacity <= 0 {
+		return 1
+	}
+	used := float64(len(si.docs))*1024 + float64(si.bytes)*0.1 + float64(si.inFlight)*10*1024*1024
+	for _, key := range si.pending {
+		used += float64(si.docs[key].size)
+	}
+	return used / capacity
+}
+
+// gcFactor slows everything down as the heap fills past 75%
+func gcFactor(usage float64) float64 {
+	if usage <= 0.75 {
+		return 1
+	}
+	return 1 + (usage-0.75)*20
+}
+
+// Process indexes writes and searches for everything else
+func (si *SearchIndex) Process(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+
+	si.metricsMutex.Lock()
+	si.metrics.RequestCount++
+	si.metricsMutex.Unlock()
+
+	var latency time.Duration
+	var err error
+	if req.Type == engine.RequestTypeWrite {
+		latency, err = si.index(req.Path, req.DataSize, start)
+	} else {
+		latency, err = si.search(req)
+	}
+	if err != nil {
+		si.metricsMutex.Lock()
+		si.metrics.FailureCount++
+		si.metricsMutex.Unlock()
+		return &engine.Response{
+			RequestID: req.ID,
+			Success:   false,
+			Latency:   time.Since(start),
+			Error:     err,
+		}, err
+	}
+
+	time.Sleep(latency)
+	if req.Type != engine.RequestTypeWrite {
+		si.mu.Lock()
+		si.inFlight--
+		si.mu.Unlock()
+	}
+
+	totalLatency := time.Since(start)
+	si.metricsMutex.Lock()
+	si.metrics.SuccessCount++
+	si.metrics.TotalLatency += totalLatency
+	si.metrics.AverageLatency = time.Duration(int64(si.metrics.TotalLatency) / si.metrics.RequestCount)
+	si.metricsMutex.Unlock()
+
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   true,
+		Latency:   totalLatency,
+		DataSize:  req.DataSize,
+		HopsTrace: []string{si.ID},
+	}, nil
+}
+
+// index buffers a document until the next refresh and returns how long the
+// write takes: the primary shard, then its replicas in parallel
+func (si *SearchIndex) index(key string, size int64, written time.Time) (time.Duration, error) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	if !si.healthy {
+		return 0, fmt.Errorf("search cluster is unhealthy")
+	}
+	usage := si.heapUsage()
+	if usage >= 0.95 {
+		si.stats.Rejected++
+		return 0, fmt.Errorf("circuit breaker tripped: heap %.0f%% full", usage*100)
+	}
+
+	doc, exists := si.docs[key]
+	if !exists {
+		doc = &document{}
+		si.docs[key] = doc
+	}
+	si.bytes += size - doc.size
+	doc.size = size
+	if doc.searchable {
+		doc.searchable = false
+		si.searchable--
+	}
+	if !doc.pending {
+		doc.pending = true
+		si.pending = append(si.pending, key)
+	}
+	doc.written = written
+	si.stats.Indexed++
+
+	latency := si.IndexLatency
+	if si.Replicas > 0 {
+		latency += time.Millisecond
+	}
+	return time.Duration(float64(latency) * gcFactor(usage)), nil
+}
+
+// ApplyChange indexes a write streamed from a database. Its lag counts from
+// the database commit.
+func (si *SearchIndex) ApplyChange(event database.ChangeEvent) {
+	if _, err := si.index(event.Key, event.Size, event.Committed); err == nil {
+		si.mu.Lock()
+		si.stats.ChangesApplied++
+		si.mu.Unlock()
+	}
+}
+
+// search returns how long a query takes. It runs on one copy of every
+// shard at once and waits for the slowest, so more shards mean a longer
+// tail. Each shard's time grows with the documents it holds, the segments
+// it has not merged yet and the query's complexity.
+func (si *SearchIndex) search(req *engine.Request) (time.Duration, error) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	if !si.healthy {
+		return 0, fmt.Errorf("search cluster is unhealthy")
+	}
+	usage := si.heapUsage()
+	if usage >= 0.95 {
+		si.stats.Rejected++
+		return 0, fmt.Errorf("circuit breaker tripped: heap %.0f%% full", usage*100)
+	}
+
+	// Shard searches run on the nodes holding a copy of the shard
+	copies := si.Shards * (1 + si.Replicas)
+	nodes := si.Nodes
+	if copies < nodes {
+		nodes = copies
+	}
+	capacity := nodes * si.QueryThreads
+	busy := (si.inFlight + 1) * si.Shards
+	if busy > capacity*4 {
+		si.stats.Rejected++
+		return 0, fmt.Errorf("search queue full")
+	}
+	si.inFlight++
+	si.stats.Queries++
+
+	complexity := 1.0
+	switch value := req.Metadata[QueryComplexityMetadata].(type) {
+	case float64:
+		complexity = value
+	case int:
+		complexity = float64(value)
+	}
+
+	docsPerShard := float64(si.searchable) / float64(si.Shards)
+	perShard := time.Millisecond + time.Duration(docsPerShard*100*complexity)*time.Nanosecond
+	perShard = time.Duration(float64(perShard) * (1 + 0.05*float64(si.segments)))
+
+	slowest := time.Duration(0)
+	for i := 0; i < si.Shards; i++ {
+		shard := perShard + time.Duration(rand.ExpFloat64()*float64(perShard)*0.2)
+		if shard > slowest {
+			slowest = shard
+		}
+	}
+	// Past the thread pool, shard searches queue behind each other
+	queueing := 1.0
+	if utilization := float64(busy) / float64(capacity); utilization > 1 {
+		queueing = math.Ceil(utilization)
+	}
+	merge := time.Duration(si.Shards) * 100 * time.Microsecond
+	latency := time.Duration(float64(slowest)*queueing) + merge
+	return time.Duration(float64(latency) * gcFactor(usage)), nil
+}
+
+// Tick refreshes the index once the refresh interval has passed, making
+// buffered writes searchable, and merges segments that have piled up
+func (si *SearchIndex) Tick(now time.Time) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	wall := time.Now()
+	if wall.Sub(si.lastRefresh) < si.RefreshInterval {
+		return
+	}
+	si.lastRefresh = wall
+	if len(si.pending) == 0 {
+		return
+	}
+
+	for _, key := range si.pending {
+		doc := si.docs[key]
+		doc.pending = false
+		doc.searchable = true
+		si.searchable++
+		lag := wall.Sub(doc.written)
+		si.totalLag += lag
+		si.lagged++
+		if lag > si.stats.MaxLag {
+			si.stats.MaxLag = lag
+		}
+	}
+	si.pending = nil
+	si.stats.Refreshes++
+	si.segments++
+	if si.segments >= mergeSegments {
+		si.segments = 1
+		si.stats.Merges++
+	}
+}
+
+func (si *SearchIndex) GetSearchStats() SearchStats {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	stats := si.stats
+	stats.Searchable = si.searchable
+	stats.Pending = int64(len(si.pending))
+	stats.Segments = si.segments
+	stats.HeapUsage = si.heapUsage()
+	if si.lagged > 0 {
+		stats.AverageLag = si.totalLag / time.Duration(si.lagged)
+	}
+	return stats
+}
+
+// GetNodeCounts reports the cluster's nodes, all up while it is healthy
+func (si *SearchIndex) GetNodeCounts() (int, int) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	if !si.healthy {
+		return 0, si.Nodes
+	}
+	return si.Nodes, si.Nodes
+}
+
+func (si *SearchIndex) GetMetrics() *engine.Metrics {
+	si.metricsMutex.RLock()
+	metricsCopy := *si.metrics
+	si.metricsMutex.RUnlock()
+
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	metricsCopy.IndexingLag = si.GetSearchStats().AverageLag
+	return &metricsCopy
+}
+
+// GetCost is a memory-heavy instance per node
+func (si *SearchIndex) GetCost() float64 {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	return float64(si.Nodes) * (0.05 + 0.02*si.HeapGB)
+}
+
+func (si *SearchIndex) IsHealthy() bool {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	return si.healthy
+}
+
+func (si *SearchIndex) SetHealthy(healthy bool) {
+	si.mu.Lock()
+	si.healthy = healthy
+	si.mu.Unlock()
+}
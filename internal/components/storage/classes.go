@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// StorageClass trades what an object costs to keep against what it costs
+// to read back
+type StorageClass string
+
+const (
+	ClassStandard   StorageClass = "standard"
+	ClassInfrequent StorageClass = "infrequent-access"
+	// Archived objects must be restored before they can be read
+	ClassArchive StorageClass = "archive"
+)
+
+func GetStorageClasses() []StorageClass {
+	return []StorageClass{ClassStandard, ClassInfrequent, ClassArchive}
+}
+
+type classProfile struct {
+	rank            int // colder classes rank higher; lifecycle only moves objects colder
+	pricePerGBMonth float64
+	retrievalPerGB  float64
+	firstByte       time.Duration
+}
+
+var classProfiles = map[StorageClass]classProfile{
+	ClassStandard:   {rank: 0, pricePerGBMonth: 0.023, retrievalPerGB: 0, firstByte: 15 * time.Millisecond},
+	ClassInfrequent: {rank: 1, pricePerGBMonth: 0.0125, retrievalPerGB: 0.01, firstByte: 25 * time.Millisecond},
+	ClassArchive:    {rank: 2, pricePerGBMonth: 0.004, retrievalPerGB: 0.03, firstByte: 25 * time.Millisecond},
+}
+
+// LifecycleRule moves objects that have not been read for AfterIdle to a
+// colder class, or deletes them when Expire is set
+type LifecycleRule struct {
+	AfterIdle time.Duration
+	To        StorageClass
+	Expire    bool
+}
+
+func sortRules(rules []LifecycleRule) []LifecycleRule {
+	sorted := append([]LifecycleRule(nil), rules...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].AfterIdle < sorted[j].AfterIdle })
+	return sorted
+}
+
+// applyLifecycle returns what rules, sorted by idle time, do to an object
+// idle for the given time: the class to move it to, and whether to delete
+// it instead
+func applyLifecycle(rules []LifecycleRule, class StorageClass, idle time.Duration) (StorageClass, bool) {
+	target := class
+	for _, rule := range rules {
+		if rule.AfterIdle <= 0 {
+			continue
+		}
+		if idle < rule.AfterIdle {
+			break
+		}
+		if rule.Expire {
+			return class, true
+		}
+		if classProfiles[rule.To].rank > classProfiles[target].rank {
+			target = rule.To
+		}
+	}
+	return target, false
+}
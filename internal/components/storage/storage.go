@@ -0,0 +1,434 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// BucketMetadata names the bucket a request is for, in Request.Metadata.
+// Otherwise the first segment of the path is the bucket and the rest the
+// key.
+const BucketMetadata = "bucket"
+
+const gb = 1024 * 1024 * 1024
+
+// Object is one blob in a bucket
+type Object struct {
+	Key           string
+	Size          int64
+	Class         StorageClass
+	Created       time.Time
+	LastAccess    time.Time
+	restoreReady  time.Time // when a restore of an archived object completes
+	restoredUntil time.Time // a restored copy stays readable until then
+}
+
+// Bucket holds objects. New objects go in its default class and its
+// lifecycle rules move them colder as they sit unread.
+type Bucket struct {
+	Name         string
+	DefaultClass StorageClass
+	Lifecycle    []LifecycleRule
+	objects      map[string]*Object
+}
+
+// StorageStats counts what the store has done
+type StorageStats struct {
+	Gets             int64
+	Puts             int64
+	MultipartUploads int64
+	BytesIn          int64
+	BytesOut         int64
+	ArchiveMisses    int64 // reads of archived objects that had to wait for a restore
+	Restores         int64
+	Transitions      int64 // objects lifecycle moved to a colder class
+	Expired          int64 // objects lifecycle deleted
+	RetrievalFees    float64
+}
+
+// BucketStats is what one bucket holds in each class
+type BucketStats struct {
+	Name         string
+	DefaultClass StorageClass
+	Objects      map[StorageClass]int
+	Bytes        map[StorageClass]int64
+}
+
+// ObjectStorage is an S3-like blob store. Transfers are limited by
+// bandwidth, large uploads go up in parallel parts, and each storage class
+// has its own first-byte latency, price and retrieval fee. It can sit
+// behind a CDN as its origin.
+type ObjectStorage struct {
+	ID        string
+	Region    string
+	Bandwidth int64 // bytes per second for each transfer
+	// Uploads larger than the threshold are split into parts of PartSize,
+	// MultipartConcurrency of them uploading at once
+	MultipartThreshold   int64
+	PartSize             int64
+	MultipartConcurrency int
+	RestoreDelay         time.Duration // until an archived object can be read
+	RestoreDuration      time.Duration // how long a restored copy stays readable
+	buckets              map[string]*Bucket
+	stats                StorageStats
+	fees                 engine.Rate // retrieval fees, billed by the hour
+	healthy              bool
+	metrics              *engine.Metrics
+	metricsMutex         sync.RWMutex
+	mu                   sync.Mutex
+	costPerHour          float64
+}
+
+func NewObjectStorage(id, region string) *ObjectStorage {
+	return &ObjectStorage{
+		ID:                   id,
+		Region:               region,
+		Bandwidth:            50 * 1024 * 1024,
+		MultipartThreshold:   16 * 1024 * 1024,
+		PartSize:             8 * 1024 * 1024,
+		MultipartConcurrency: 4,
+		RestoreDelay:         10 * time.Second,
+		RestoreDuration:      time.Minute,
+		buckets:              make(map[string]*Bucket),
+		healthy:              true,
+		metrics:              &engine.Metrics{},
+		costPerHour:          0.01,
+	}
+}
+
+func (s *ObjectStorage) GetID() string {
+	return s.ID
+}
+
+func (s *ObjectStorage) GetType() string {
+	return "object-storage"
+}
+
+func (s *ObjectStorage) GetRegion() string {
+	return s.Region
+}
+
+// SetTransferSettings changes bandwidth, multipart uploads and how archived
+// objects are restored
+func (s *ObjectStorage) SetTransferSettings(bandwidth, multipartThreshold, partSize int64, concurrency int, restoreDelay, restoreDuration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Bandwidth = bandwidth
+	s.MultipartThreshold = multipartThreshold
+	s.PartSize = partSize
+	s.MultipartConcurrency = concurrency
+	s.RestoreDelay = restoreDelay
+	s.RestoreDuration = restoreDuration
+}
+
+// AddBucket creates a bucket, or returns the existing one
+func (s *ObjectStorage) AddBucket(name string, class StorageClass) *Bucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bucketLocked(name, class)
+}
+
+func (s *ObjectStorage) bucketLocked(name string, class StorageClass) *Bucket {
+	if bucket, exists := s.buckets[name]; exists {
+		return bucket
+	}
+	bucket := &Bucket{Name: name, DefaultClass: class, objects: make(map[string]*Object)}
+	s.buckets[name] = bucket
+	return bucket
+}
+
+// SetBucketPolicy changes a bucket's default class and lifecycle rules
+func (s *ObjectStorage) SetBucketPolicy(name string, class StorageClass, rules []LifecycleRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, exists := s.buckets[name]
+	if !exists {
+		return fmt.Errorf("bucket %s not found", name)
+	}
+	bucket.DefaultClass = class
+	bucket.Lifecycle = sortRules(rules)
+	return nil
+}
+
+// GetBucket returns a bucket's settings
+func (s *ObjectStorage) GetBucket(name string) (Bucket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, exists := s.buckets[name]
+	if !exists {
+		return Bucket{}, false
+	}
+	return Bucket{Name: bucket.Name, DefaultClass: bucket.DefaultClass, Lifecycle: append([]LifecycleRule(nil), bucket.Lifecycle...)}, true
+}
+
+// Seed stores an object of one size at each path, in the bucket and under
+// the key requests for that path look for. Buckets that already have
+// objects are left alone.
+func (s *ObjectStorage) Seed(paths []string, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	seeded := make(map[string]bool)
+	for _, path := range paths {
+		name, key := locate(&engine.Request{Path: path})
+		bucket := s.bucketLocked(name, ClassStandard)
+		if _, seeding := seeded[name]; !seeding {
+			seeded[name] = len(bucket.objects) == 0
+		}
+		if !seeded[name] {
+			continue
+		}
+		bucket.objects[key] = &Object{Key: key, Size: size, Class: bucket.DefaultClass, Created: now, LastAccess: now}
+	}
+}
+
+// locate splits a request into bucket and key
+func locate(req *engine.Request) (string, string) {
+	path := strings.TrimPrefix(req.Path, "/")
+	if bucket, ok := req.Metadata[BucketMetadata].(string); ok {
+		return bucket, path
+	}
+	bucket, key, found := strings.Cut(path, "/")
+	if !found {
+		return "default", path
+	}
+	return bucket, key
+}
+
+// Process puts the object for writes and gets it for anything else. Reads
+// of keys nobody has put are served as part of the catalog the scenario
+// describes, sized by the request.
+func (s *ObjectStorage) Process(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+
+	s.metricsMutex.Lock()
+	s.metrics.RequestCount++
+	s.metricsMutex.Unlock()
+
+	if !s.IsHealthy() {
+		return s.fail(req, start, fmt.Errorf("object storage is unhealthy"))
+	}
+
+	bucketName, key := locate(req)
+	var latency time.Duration
+	var size int64
+	var err error
+	if req.Type == engine.RequestTypeWrite {
+		latency, size = s.put(bucketName, key, req.DataSize)
+	} else {
+		latency, size, err = s.get(bucketName, key, req.DataSize)
+	}
+	if err != nil {
+		return s.fail(req, start, err)
+	}
+
+	time.Sleep(latency)
+
+	totalLatency := time.Since(start)
+	s.metricsMutex.Lock()
+	s.metrics.SuccessCount++
+	s.metrics.DataTransferred += size
+	s.metrics.TotalLatency += totalLatency
+	s.metrics.AverageLatency = time.Duration(int64(s.metrics.TotalLatency) / s.metrics.RequestCount)
+	s.metricsMutex.Unlock()
+
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   true,
+		Latency:   totalLatency,
+		DataSize:  size,
+		HopsTrace: []string{s.ID},
+	}, nil
+}
+
+func (s *ObjectStorage) fail(req *engine.Request, start time.Time, err error) (*engine.Response, error) {
+	s.metricsMutex.Lock()
+	s.metrics.FailureCount++
+	s.metricsMutex.Unlock()
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   false,
+		Latency:   time.Since(start),
+		Error:     err,
+	}, err
+}
+
+// transferTime is how long size bytes take at the store's bandwidth
+func (s *ObjectStorage) transferTime(size int64) time.Duration {
+	if s.Bandwidth <= 0 {
+		return 0
+	}
+	return time.Duration(float64(size) / float64(s.Bandwidth) * float64(time.Second))
+}
+
+// put stores an object and returns how long the upload takes. Large
+// objects are uploaded as parts in parallel rounds.
+func (s *ObjectStorage) put(bucketName, key string, size int64) (time.Duration, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket := s.bucketLocked(bucketName, ClassStandard)
+	profile := classProfiles[bucket.DefaultClass]
+	now := time.Now()
+	bucket.objects[key] = &Object{Key: key, Size: size, Class: bucket.DefaultClass, Created: now, LastAccess: now}
+
+	s.stats.Puts++
+	s.stats.BytesIn += size
+
+	latency := profile.firstByte + s.transferTime(size)
+	if s.MultipartThreshold > 0 && size > s.MultipartThreshold && s.PartSize > 0 {
+		s.stats.MultipartUploads++
+		parts := (size + s.PartSize - 1) / s.PartSize
+		concurrency := int64(s.MultipartConcurrency)
+		if concurrency < 1 {
+			concurrency = 1
+		}
+		rounds := (parts + concurrency - 1) / concurrency
+		// Each round sends its parts side by side, then the upload is
+		// completed in one more request
+		latency = profile.firstByte + time.Duration(rounds)*(profile.firstByte+s.transferTime(s.PartSize)) + profile.firstByte
+	}
+	return latency, size
+}
+
+// get reads an object and returns how long the download takes. Archived
+// objects fail until a restore, started by the first read, completes.
+func (s *ObjectStorage) get(bucketName, key string, catalogSize int64) (time.Duration, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	bucket := s.bucketLocked(bucketName, ClassStandard)
+	obj, exists := bucket.objects[key]
+	if !exists {
+		obj = &Object{Key: key, Size: catalogSize, Class: bucket.DefaultClass, Created: now, LastAccess: now}
+		bucket.objects[key] = obj
+	}
+
+	if obj.Class == ClassArchive && !now.Before(obj.restoredUntil) {
+		switch {
+		case obj.restoreReady.IsZero() || now.After(obj.restoreReady.Add(s.RestoreDuration)):
+			obj.restoreReady = now.Add(s.RestoreDelay)
+			s.stats.Restores++
+			fallthrough
+		case now.Before(obj.restoreReady):
+			s.stats.ArchiveMisses++
+			return 0, 0, fmt.Errorf("object %s/%s is archived; restore ready in %v", bucketName, key, obj.restoreReady.Sub(now).Round(time.Millisecond))
+		default:
+			obj.restoredUntil = obj.restoreReady.Add(s.RestoreDuration)
+		}
+	}
+
+	profile := classProfiles[obj.Class]
+	obj.LastAccess = now
+	s.stats.Gets++
+	s.stats.BytesOut += obj.Size
+	fee := float64(obj.Size) / gb * profile.retrievalPerGB
+	s.stats.RetrievalFees += fee
+	s.fees.Add(now, fee)
+	return profile.firstByte + s.transferTime(obj.Size), obj.Size, nil
+}
+
+// Tick applies each bucket's lifecycle rules
+func (s *ObjectStorage) Tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wall := time.Now()
+	for _, bucket := range s.buckets {
+		if len(bucket.Lifecycle) == 0 {
+			continue
+		}
+		for key, obj := range bucket.objects {
+			class, expire := applyLifecycle(bucket.Lifecycle, obj.Class, wall.Sub(obj.LastAccess))
+			if expire {
+				delete(bucket.objects, key)
+				s.stats.Expired++
+				continue
+			}
+			if class != obj.Class {
+				obj.Class = class
+				s.stats.Transitions++
+			}
+		}
+	}
+}
+
+func (s *ObjectStorage) GetStorageStats() StorageStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stats
+}
+
+func (s *ObjectStorage) GetBucketStats() []BucketStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]BucketStats, 0, len(s.buckets))
+	for _, bucket := range s.buckets {
+		bucketStats := BucketStats{
+			Name:         bucket.Name,
+			DefaultClass: bucket.DefaultClass,
+			Objects:      make(map[StorageClass]int),
+			Bytes:        make(map[StorageClass]int64),
+		}
+		for _, obj := range bucket.objects {
+			bucketStats.Objects[obj.Class]++
+			bucketStats.Bytes[obj.Class] += obj.Size
+		}
+		stats = append(stats, bucketStats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+func (s *ObjectStorage) GetMetrics() *engine.Metrics {
+	s.metricsMutex.RLock()
+	defer s.metricsMutex.RUnlock()
+
+	metricsCopy := *s.metrics
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	return &metricsCopy
+}
+
+// GetCost is the service plus every stored GB at its class's monthly price,
+// spread over the hours of a month, plus retrieval fees at the rate reads
+// are running up
+func (s *ObjectStorage) GetCost() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cost := s.costPerHour + s.fees.PerSecond(time.Now())*3600
+	for _, bucket := range s.buckets {
+		for _, obj := range bucket.objects {
+			cost += float64(obj.Size) / gb * classProfiles[obj.Class].pricePerGBMonth / 730
+		}
+	}
+	return cost
+}
+
+func (s *ObjectStorage) IsHealthy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.healthy
+}
+
+func (s *ObjectStorage) SetHealthy(healthy bool) {
+	s.mu.Lock()
+	s.healthy = healthy
+	s.mu.Unlock()
+}
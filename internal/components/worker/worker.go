@@ -0,0 +1,408 @@
+package worker
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/components/queue"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+// latencySamples is how many recent jobs the latency percentiles cover
+const latencySamples = 1000
+
+// cacheWriter is a cache that can have keys invalidated
+type cacheWriter interface {
+	Invalidate(key string)
+}
+
+// Worker is a fleet of background workers. Each pulls a batch of messages
+// from its queue's consumer group, spends CPU time on every message, calls
+// its downstream components and acks or nacks. Work done here is off the
+// request path, so users only wait for the queue to take it.
+type Worker struct {
+	ID           string
+	Region       string
+	Workers      int
+	BatchSize    int
+	CPUTime      time.Duration // spent on each message before calling downstream
+	Instance     *config.InstanceType
+	Database     engine.Component
+	Cache        engine.Component
+	Services     []engine.Component // external APIs called for every job, e.g. email or image processing
+	source       *queue.Queue
+	group        string
+	running      int
+	busy         int
+	healthy      bool
+	metrics      *engine.Metrics
+	metricsMutex sync.RWMutex
+	latencies    []time.Duration // ring of the latest jobs
+	nextLatency  int
+	lastTick     time.Time
+	lastCount    int64
+	mu           sync.Mutex
+}
+
+func NewWorker(id, region string, workers int) *Worker {
+	return &Worker{
+		ID:        id,
+		Region:    region,
+		Workers:   workers,
+		BatchSize: 10,
+		CPUTime:   50 * time.Millisecond,
+		Instance:  config.GetInstanceType("t3.small"),
+		healthy:   true,
+		metrics:   &engine.Metrics{},
+	}
+}
+
+func (w *Worker) GetID() string {
+	return w.ID
+}
+
+func (w *Worker) GetType() string {
+	return "worker"
+}
+
+func (w *Worker) GetRegion() string {
+	return w.Region
+}
+
+// SetSource makes the workers consume a queue's default topic through a
+// consumer group of their own
+func (w *Worker) SetSource(q *queue.Queue) error {
+	if _, err := q.AddConsumerGroup(w.ID, q.DefaultTopic, nil); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.source != nil && w.source != q {
+		w.source.RemoveConsumerGroup(w.group)
+	}
+	w.source = q
+	w.group = w.ID
+	return nil
+}
+
+// GetSource returns the queue the workers consume, if any
+func (w *Worker) GetSource() *queue.Queue {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.source
+}
+
+func (w *Worker) SetDatabase(db engine.Component) {
+	w.Database = db
+}
+
+func (w *Worker) SetCache(cache engine.Component) {
+	w.Cache = cache
+}
+
+// AddService adds an external API every job calls
+func (w *Worker) AddService(service engine.Component) {
+	for _, existing := range w.Services {
+		if existing == service {
+			return
+		}
+	}
+	w.Services = append(w.Services, service)
+}
+
+// SetWorkers scales the fleet. Workers beyond the new count stop once they
+// finish their batch.
+func (w *Worker) SetWorkers(workers int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if workers < 1 {
+		workers = 1
+	}
+	w.Workers = workers
+}
+
+// SetJobSettings changes how many messages a worker takes at a time and the
+// CPU time each costs
+func (w *Worker) SetJobSettings(batchSize int, cpuTime time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	w.BatchSize = batchSize
+	w.CPUTime = cpuTime
+}
+
+// SetInstance changes the instance each worker runs on
+func (w *Worker) SetInstance(instance *config.InstanceType) {
+	if instance == nil {
+		return
+	}
+	w.mu.Lock()
+	w.Instance = instance
+	w.mu.Unlock()
+}
+
+// Process runs one job right away, when something hands work to the
+// workers directly rather than through a queue
+func (w *Worker) Process(req *engine.Request) (*engine.Response, error) {
+	w.mu.Lock()
+	if !w.healthy {
+		w.mu.Unlock()
+		return w.reject(req, fmt.Errorf("worker is unhealthy"))
+	}
+	if w.busy >= w.Workers {
+		w.mu.Unlock()
+		return w.reject(req, fmt.Errorf("all workers busy"))
+	}
+	w.busy++
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		w.busy--
+		w.mu.Unlock()
+	}()
+	return w.run(req)
+}
+
+func (w *Worker) reject(req *engine.Request, err error) (*engine.Response, error) {
+	w.metricsMutex.Lock()
+	w.metrics.RequestCount++
+	w.metrics.FailureCount++
+	w.metricsMutex.Unlock()
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   false,
+		Error:     err,
+	}, err
+}
+
+// run does one job: the CPU time, then the cache or database, then every
+// external service in turn. The first failure fails the job.
+func (w *Worker) run(req *engine.Request) (*engine.Response, error) {
+	start := time.Now()
+
+	w.metricsMutex.Lock()
+	w.metrics.RequestCount++
+	w.metricsMutex.Unlock()
+
+	w.mu.Lock()
+	cpuTime := w.CPUTime
+	w.mu.Unlock()
+	if cpuTime > 0 {
+		cpuTime += time.Duration(rand.Int63n(int64(cpuTime)/5 + 1))
+	}
+	time.Sleep(cpuTime)
+
+	hops := []string{w.ID}
+	var resp *engine.Response
+	var err error
+
+	writeCache, cacheWrites := w.Cache.(cacheWriter)
+	if w.Cache != nil && req.Type == engine.RequestTypeRead {
+		resp, err = w.Cache.Process(req)
+	} else if w.Database != nil {
+		resp, err = w.Database.Process(req)
+		if err == nil && req.Type == engine.RequestTypeWrite && cacheWrites {
+			writeCache.Invalidate(req.Path)
+		}
+	}
+	if resp != nil {
+		hops = append(hops, resp.HopsTrace...)
+	}
+	for _, service := range w.Services {
+		if err != nil || (resp != nil && !resp.Success) {
+			break
+		}
+		resp, err = service.Process(req)
+		if resp != nil {
+			hops = append(hops, resp.HopsTrace...)
+		}
+	}
+	if err == nil && resp != nil && !resp.Success {
+		err = resp.Error
+		if err == nil {
+			err = fmt.Errorf("job failed downstream")
+		}
+	}
+
+	latency := time.Since(start)
+	w.metricsMutex.Lock()
+	if err == nil {
+		w.metrics.SuccessCount++
+	} else {
+		w.metrics.FailureCount++
+	}
+	w.metrics.TotalLatency += latency
+	w.metrics.AverageLatency = time.Duration(int64(w.metrics.TotalLatency) / w.metrics.RequestCount)
+	if len(w.latencies) < latencySamples {
+		w.latencies = append(w.latencies, latency)
+	} else {
+		w.latencies[w.nextLatency] = latency
+		w.nextLatency = (w.nextLatency + 1) % latencySamples
+	}
+	w.metricsMutex.Unlock()
+
+	return &engine.Response{
+		RequestID: req.ID,
+		Success:   err == nil,
+		Latency:   latency,
+		HopsTrace: hops,
+		Error:     err,
+	}, err
+}
+
+// Tick measures throughput and sets idle workers to pull from the queue
+func (w *Worker) Tick(now time.Time) {
+	w.metricsMutex.Lock()
+	if !w.lastTick.IsZero() && now.After(w.lastTick) {
+		done := w.metrics.SuccessCount - w.lastCount
+		w.metrics.Throughput = float64(done) / now.Sub(w.lastTick).Seconds()
+	}
+	w.lastTick = now
+	w.lastCount = w.metrics.SuccessCount
+	w.metricsMutex.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.source == nil || !w.healthy {
+		return
+	}
+	for w.running < w.Workers {
+		w.running++
+		go w.poll(w.source, w.group)
+	}
+}
+
+// poll is one worker: it takes a batch at a time and works through it
+// until the queue has nothing for it, or the fleet has shrunk
+func (w *Worker) poll(source *queue.Queue, group string) {
+	defer func() {
+		w.mu.Lock()
+		w.running--
+		w.mu.Unlock()
+	}()
+
+	for {
+		w.mu.Lock()
+		stop := !w.healthy || w.running > w.Workers
+		batchSize := w.BatchSize
+		w.mu.Unlock()
+		if stop {
+			return
+		}
+
+		messages, err := source.Receive(group, batchSize)
+		if err != nil || len(messages) == 0 {
+			return
+		}
+
+		w.mu.Lock()
+		w.busy++
+		w.mu.Unlock()
+		for _, msg := range messages {
+			req := *msg.Request
+			req.Source = source.GetID()
+			if _, err := w.run(&req); err != nil {
+				// The rest of the batch comes back with it, in order
+				source.Nack(group, msg)
+				break
+			}
+			source.Ack(group, msg)
+		}
+		w.mu.Lock()
+		w.busy--
+		w.mu.Unlock()
+	}
+}
+
+// WorkerStats is how the fleet is keeping up
+type WorkerStats struct {
+	Workers    int
+	Busy       int
+	Processed  int64
+	Failed     int64
+	Throughput float64 // jobs finished per second
+	Average    time.Duration
+	P99        time.Duration
+	Backlog    int // messages waiting for these workers in the queue
+}
+
+func (w *Worker) GetWorkerStats() WorkerStats {
+	w.mu.Lock()
+	stats := WorkerStats{Workers: w.Workers, Busy: w.busy}
+	source, group := w.source, w.group
+	w.mu.Unlock()
+
+	metrics := w.GetMetrics()
+	stats.Processed = metrics.SuccessCount
+	stats.Failed = metrics.FailureCount
+	stats.Throughput = metrics.Throughput
+	stats.Average = metrics.AverageLatency
+	stats.P99 = metrics.P99Latency
+
+	if source != nil {
+		for _, groupStats := range source.GetGroupStats() {
+			if groupStats.Name == group {
+				stats.Backlog = int(groupStats.Lag)
+			}
+		}
+	}
+	return stats
+}
+
+// GetCurrentLoad is the share of workers busy with a batch
+func (w *Worker) GetCurrentLoad() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return float64(w.busy) / float64(w.Workers)
+}
+
+func (w *Worker) GetMetrics() *engine.Metrics {
+	w.metricsMutex.RLock()
+	metricsCopy := *w.metrics
+	latencies := append([]time.Duration(nil), w.latencies...)
+	w.metricsMutex.RUnlock()
+
+	if metricsCopy.RequestCount > 0 {
+		metricsCopy.ErrorRate = float64(metricsCopy.FailureCount) / float64(metricsCopy.RequestCount)
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		metricsCopy.P95Latency = latencies[len(latencies)*95/100]
+		metricsCopy.P99Latency = latencies[len(latencies)*99/100]
+	}
+	return &metricsCopy
+}
+
+// GetCost is one instance per worker
+func (w *Worker) GetCost() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.Instance.CostPerHour * float64(w.Workers)
+}
+
+func (w *Worker) IsHealthy() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.healthy
+}
+
+func (w *Worker) SetHealthy(healthy bool) {
+	w.mu.Lock()
+	w.healthy = healthy
+	w.mu.Unlock()
+}
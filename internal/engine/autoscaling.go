@@ -0,0 +1,364 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type ScalingMetric string
+
+const (
+	ScalingMetricCPU         ScalingMetric = "cpu"
+	ScalingMetricRequestRate ScalingMetric = "request-rate"
+	ScalingMetricQueueDepth  ScalingMetric = "queue-depth"
+)
+
+type ScalingAction string
+
+const (
+	ScalingActionScaleOut ScalingAction = "scale-out"
+	ScalingActionReady    ScalingAction = "instance-ready"
+	ScalingActionScaleIn  ScalingAction = "scale-in"
+)
+
+// ScalingPolicy decides when an AutoScalingGroup changes capacity. Thresholds
+// are percentages of the target utilization of the chosen metric: for CPU the
+// target is a fully loaded instance, for request rate TargetRequestRate per
+// instance and for queue depth TargetQueueDepth per instance.
+type ScalingPolicy struct {
+	Metric             ScalingMetric
+	MinInstances       int
+	MaxInstances       int
+	ScaleUpThreshold   float64
+	ScaleDownThreshold float64
+	TargetRequestRate  float64
+	TargetQueueDepth   int
+	Cooldown           time.Duration
+	StartupDelay       time.Duration
+	HealthCheckGrace   time.Duration
+}
+
+type ScalingEvent struct {
+	Time        time.Time
+	GroupID     string
+	Action      ScalingAction
+	Instance    Component
+	Reason      string
+	Capacity    int
+	Utilization float64
+}
+
+// BackendPool is anything that spreads traffic over a set of backends
+// (typically a load balancer)
+type BackendPool interface {
+	AddBackend(backend Component)
+	RemoveBackend(backendID string)
+}
+
+type loadReporter interface {
+	GetCurrentLoad() float64
+}
+
+type queueReporter interface {
+	GetQueueDepth() int
+}
+
+type scalingInstance struct {
+	component    Component
+	managed      bool
+	ready        bool
+	readyAt      time.Time
+	lastRequests int64
+}
+
+// AutoScalingGroup keeps a fleet of instances behind a BackendPool sized to
+// its load. New instances are built by NewInstance, registered with the
+// simulator right away (so they cost money while booting) and only receive
+// traffic once their startup delay has passed.
+type AutoScalingGroup struct {
+	ID          string
+	Policy      ScalingPolicy
+	Pool        BackendPool
+	NewInstance func(id string) Component
+	QueueSource Component
+	OnScale     func(event ScalingEvent)
+
+	// When set, managed instances that fail their health checks after the
+	// grace period are terminated and replaced
+	HealthChecker *HealthChecker
+
+	sim         *Simulator
+	instances   []*scalingInstance
+	lastScale   time.Time
+	lastTick    time.Time
+	utilization float64
+	launched    int
+	events      []ScalingEvent
+	mu          sync.Mutex
+}
+
+func NewAutoScalingGroup(id string, sim *Simulator, pool BackendPool, policy ScalingPolicy, newInstance func(id string) Component) *AutoScalingGroup {
+	return &AutoScalingGroup{
+		ID:          id,
+		Policy:      policy,
+		Pool:        pool,
+		NewInstance: newInstance,
+		sim:         sim,
+		instances:   make([]*scalingInstance, 0),
+		events:      make([]ScalingEvent, 0),
+	}
+}
+
+// AddInstance adopts an instance that is already serving behind the pool.
+// Adopted instances count toward capacity but are never terminated.
+func (asg *AutoScalingGroup) AddInstance(component Component) {
+	asg.mu.Lock()
+	defer asg.mu.Unlock()
+
+	asg.instances = append(asg.instances, &scalingInstance{
+		component:    component,
+		ready:        true,
+		lastRequests: component.GetMetrics().RequestCount,
+	})
+}
+
+func (asg *AutoScalingGroup) Tick(now time.Time) {
+	asg.mu.Lock()
+	events := asg.reconcile(now)
+	asg.mu.Unlock()
+
+	for _, event := range events {
+		asg.sim.recordScalingEvent(event)
+		if asg.OnScale != nil {
+			asg.OnScale(event)
+		}
+	}
+}
+
+func (asg *AutoScalingGroup) reconcile(now time.Time) []ScalingEvent {
+	events := make([]ScalingEvent, 0)
+
+	elapsed := now.Sub(asg.lastTick)
+	if asg.lastTick.IsZero() {
+		elapsed = 0
+	}
+	asg.lastTick = now
+
+	// Instances that finished booting start taking traffic
+	for _, inst := range asg.instances {
+		if !inst.ready && !now.Before(inst.readyAt) {
+			inst.ready = true
+			inst.component.SetHealthy(true)
+			inst.lastRequests = inst.component.GetMetrics().RequestCount
+			asg.Pool.AddBackend(inst.component)
+			events = append(events, asg.newEvent(now, ScalingActionReady, inst.component, "startup complete"))
+		}
+	}
+
+	if asg.HealthChecker != nil {
+		events = append(events, asg.replaceUnhealthy(now)...)
+	}
+
+	// Smooth the samples so a single burst does not trigger a scale event
+	asg.utilization = asg.utilization*0.8 + asg.measure(elapsed)*0.2
+
+	ready, pending := asg.countInstances()
+	if !asg.lastScale.IsZero() && now.Sub(asg.lastScale) < asg.Policy.Cooldown {
+		return events
+	}
+
+	switch {
+	case ready+pending < asg.Policy.MinInstances:
+		for i := ready + pending; i < asg.Policy.MinInstances; i++ {
+			events = append(events, asg.launch(now, "below minimum capacity"))
+		}
+		asg.lastScale = now
+
+	case asg.utilization > asg.Policy.ScaleUpThreshold && ready+pending < asg.Policy.MaxInstances:
+		// Step scaling: add enough instances to bring utilization back
+		// under the threshold, assuming load spreads evenly
+		desired := int(math.Ceil(float64(ready) * asg.utilization / asg.Policy.ScaleUpThreshold))
+		if desired > asg.Policy.MaxInstances {
+			desired = asg.Policy.MaxInstances
+		}
+		count := desired - (ready + pending)
+		if count < 1 {
+			count = 1
+		}
+		reason := fmt.Sprintf("%s at %.0f%% (threshold %.0f%%)", asg.Policy.Metric, asg.utilization, asg.Policy.ScaleUpThreshold)
+		for i := 0; i < count; i++ {
+			events = append(events, asg.launch(now, reason))
+		}
+		asg.lastScale = now
+
+	case asg.utilization < asg.Policy.ScaleDownThreshold && pending == 0 && ready > asg.Policy.MinInstances:
+		reason := fmt.Sprintf("%s at %.0f%% (threshold %.0f%%)", asg.Policy.Metric, asg.utilization, asg.Policy.ScaleDownThreshold)
+		if event, ok := asg.terminate(now, reason); ok {
+			events = append(events, event)
+			asg.lastScale = now
+		}
+	}
+
+	return events
+}
+
+// measure returns the current utilization of the ready instances as a
+// percentage of the policy's target
+func (asg *AutoScalingGroup) measure(elapsed time.Duration) float64 {
+	ready := make([]*scalingInstance, 0, len(asg.instances))
+	for _, inst := range asg.instances {
+		if inst.ready {
+			ready = append(ready, inst)
+		}
+	}
+	if len(ready) == 0 {
+		return 0
+	}
+
+	switch asg.Policy.Metric {
+	case ScalingMetricRequestRate:
+		var requests int64
+		for _, inst := range ready {
+			count := inst.component.GetMetrics().RequestCount
+			requests += count - inst.lastRequests
+			inst.lastRequests = count
+		}
+		if elapsed <= 0 || asg.Policy.TargetRequestRate <= 0 {
+			return asg.utilization
+		}
+		rate := float64(requests) / elapsed.Seconds()
+		return rate / (asg.Policy.TargetRequestRate * float64(len(ready))) * 100
+
+	case ScalingMetricQueueDepth:
+		queue, ok := asg.QueueSource.(queueReporter)
+		if !ok || asg.Policy.TargetQueueDepth <= 0 {
+			return 0
+		}
+		return float64(queue.GetQueueDepth()) / float64(asg.Policy.TargetQueueDepth*len(ready)) * 100
+
+	default:
+		total := 0.0
+		for _, inst := range ready {
+			if reporter, ok := inst.component.(loadReporter); ok {
+				total += reporter.GetCurrentLoad()
+			}
+		}
+		return total / float64(len(ready)) * 100
+	}
+}
+
+func (asg *AutoScalingGroup) launch(now time.Time, reason string) ScalingEvent {
+	asg.launched++
+	instance := asg.NewInstance(fmt.Sprintf("%s-%d", asg.ID, asg.launched))
+
+	// The instance is billed from launch but serves nothing until it is up
+	instance.SetHealthy(false)
+	asg.sim.RegisterComponent(instance)
+	asg.instances = append(asg.instances, &scalingInstance{
+		component: instance,
+		managed:   true,
+		readyAt:   now.Add(asg.Policy.StartupDelay),
+	})
+
+	return asg.newEvent(now, ScalingActionScaleOut, instance, reason)
+}
+
+// terminate removes the most recently launched ready instance
+func (asg *AutoScalingGroup) terminate(now time.Time, reason string) (ScalingEvent, bool) {
+	for i := len(asg.instances) - 1; i >= 0; i-- {
+		inst := asg.instances[i]
+		if !inst.managed || !inst.ready {
+			continue
+		}
+
+		asg.remove(i)
+		return asg.newEvent(now, ScalingActionScaleIn, inst.component, reason), true
+	}
+	return ScalingEvent{}, false
+}
+
+// replaceUnhealthy swaps out managed instances the health checker took out
+// of service. Replacements are not subject to the cooldown.
+func (asg *AutoScalingGroup) replaceUnhealthy(now time.Time) []ScalingEvent {
+	events := make([]ScalingEvent, 0)
+
+	for i := len(asg.instances) - 1; i >= 0; i-- {
+		inst := asg.instances[i]
+		if !inst.managed || !inst.ready || now.Sub(inst.readyAt) < asg.Policy.HealthCheckGrace {
+			continue
+		}
+		if asg.HealthChecker.IsInService(inst.component) {
+			continue
+		}
+
+		asg.remove(i)
+		events = append(events, asg.newEvent(now, ScalingActionScaleIn, inst.component, "failed health checks"))
+		events = append(events, asg.launch(now, fmt.Sprintf("replacing unhealthy %s", inst.component.GetID())))
+	}
+
+	return events
+}
+
+func (asg *AutoScalingGroup) remove(index int) {
+	inst := asg.instances[index]
+
+	asg.Pool.RemoveBackend(inst.component.GetID())
+	asg.sim.UnregisterComponent(inst.component.GetID())
+	asg.instances = append(asg.instances[:index], asg.instances[index+1:]...)
+}
+
+func (asg *AutoScalingGroup) countInstances() (int, int) {
+	ready, pending := 0, 0
+	for _, inst := range asg.instances {
+		if inst.ready {
+			ready++
+		} else {
+			pending++
+		}
+	}
+	return ready, pending
+}
+
+func (asg *AutoScalingGroup) newEvent(now time.Time, action ScalingAction, instance Component, reason string) ScalingEvent {
+	event := ScalingEvent{
+		Time:        now,
+		GroupID:     asg.ID,
+		Action:      action,
+		Instance:    instance,
+		Reason:      reason,
+		Capacity:    len(asg.instances),
+		Utilization: asg.utilization,
+	}
+
+	asg.events = append(asg.events, event)
+	if len(asg.events) > 100 {
+		asg.events = asg.events[1:]
+	}
+	return event
+}
+
+// GetCapacity returns the number of serving and booting instances
+func (asg *AutoScalingGroup) GetCapacity() (int, int) {
+	asg.mu.Lock()
+	defer asg.mu.Unlock()
+
+	return asg.countInstances()
+}
+
+func (asg *AutoScalingGroup) GetUtilization() float64 {
+	asg.mu.Lock()
+	defer asg.mu.Unlock()
+
+	return asg.utilization
+}
+
+func (asg *AutoScalingGroup) GetEvents() []ScalingEvent {
+	asg.mu.Lock()
+	defer asg.mu.Unlock()
+
+	events := make([]ScalingEvent, len(asg.events))
+	copy(events, asg.events)
+	return events
+}
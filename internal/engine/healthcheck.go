@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type HealthState string
+
+const (
+	HealthStateHealthy   HealthState = "healthy"
+	HealthStateUnhealthy HealthState = "unhealthy"
+)
+
+// probeBaseLatency is how long a health endpoint takes to answer on an idle
+// instance. Busy instances answer slower and eventually time out.
+const probeBaseLatency = 5 * time.Millisecond
+
+type HealthCheckPolicy struct {
+	Interval           time.Duration
+	Timeout            time.Duration
+	HealthyThreshold   int
+	UnhealthyThreshold int
+}
+
+// TargetHealth is the health checker's view of a single target
+type TargetHealth struct {
+	State                HealthState
+	ConsecutiveSuccesses int
+	ConsecutiveFailures  int
+	LastCheck            time.Time
+	LastError            error
+}
+
+type HealthChange struct {
+	Time      time.Time
+	CheckerID string
+	Component Component
+	State     HealthState
+	Reason    string
+}
+
+type healthTarget struct {
+	component Component
+	health    TargetHealth
+}
+
+// HealthChecker actively probes its targets on an interval and decides
+// whether they should receive traffic. Its view deliberately lags reality:
+// a component that breaks (IsHealthy() == false) keeps its healthy state
+// until UnhealthyThreshold probes in a row fail, and a component can be
+// marked unhealthy by failing probes (e.g. because it is overloaded) while
+// it is not actually broken.
+type HealthChecker struct {
+	ID       string
+	Policy   HealthCheckPolicy
+	OnChange func(change HealthChange)
+
+	targets map[string]*healthTarget
+	mu      sync.RWMutex
+}
+
+func NewHealthChecker(id string, policy HealthCheckPolicy) *HealthChecker {
+	return &HealthChecker{
+		ID:      id,
+		Policy:  policy,
+		targets: make(map[string]*healthTarget),
+	}
+}
+
+// AddTarget starts probing a component. Targets start in the state matching
+// whether the component is currently working.
+func (hc *HealthChecker) AddTarget(component Component) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if _, exists := hc.targets[component.GetID()]; exists {
+		return
+	}
+
+	state := HealthStateHealthy
+	if !component.IsHealthy() {
+		state = HealthStateUnhealthy
+	}
+	hc.targets[component.GetID()] = &healthTarget{
+		component: component,
+		health:    TargetHealth{State: state},
+	}
+}
+
+func (hc *HealthChecker) RemoveTarget(id string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	delete(hc.targets, id)
+}
+
+// IsInService reports whether traffic should be sent to the component.
+// Components the checker does not probe fall back to their actual health.
+func (hc *HealthChecker) IsInService(component Component) bool {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	target, exists := hc.targets[component.GetID()]
+	if !exists {
+		return component.IsHealthy()
+	}
+	return target.health.State == HealthStateHealthy
+}
+
+func (hc *HealthChecker) GetTargetHealth(id string) (TargetHealth, bool) {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	target, exists := hc.targets[id]
+	if !exists {
+		return TargetHealth{}, false
+	}
+	return target.health, true
+}
+
+// GetCounts returns how many targets are in and out of service
+func (hc *HealthChecker) GetCounts() (int, int) {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	inService, outOfService := 0, 0
+	for _, target := range hc.targets {
+		if target.health.State == HealthStateHealthy {
+			inService++
+		} else {
+			outOfService++
+		}
+	}
+	return inService, outOfService
+}
+
+func (hc *HealthChecker) Tick(now time.Time) {
+	hc.mu.Lock()
+	changes := make([]HealthChange, 0)
+	for _, target := range hc.targets {
+		if !target.health.LastCheck.IsZero() && now.Sub(target.health.LastCheck) < hc.Policy.Interval {
+			continue
+		}
+		if change, changed := hc.check(target, now); changed {
+			changes = append(changes, change)
+		}
+	}
+	hc.mu.Unlock()
+
+	if hc.OnChange != nil {
+		for _, change := range changes {
+			hc.OnChange(change)
+		}
+	}
+}
+
+func (hc *HealthChecker) check(target *healthTarget, now time.Time) (HealthChange, bool) {
+	health := &target.health
+	health.LastCheck = now
+	health.LastError = hc.probe(target.component)
+
+	if health.LastError == nil {
+		health.ConsecutiveSuccesses++
+		health.ConsecutiveFailures = 0
+		if health.State == HealthStateUnhealthy && health.ConsecutiveSuccesses >= hc.Policy.HealthyThreshold {
+			health.State = HealthStateHealthy
+			return hc.newChange(target, now, fmt.Sprintf("%d consecutive probes passed", health.ConsecutiveSuccesses)), true
+		}
+		return HealthChange{}, false
+	}
+
+	health.ConsecutiveFailures++
+	health.ConsecutiveSuccesses = 0
+	if health.State == HealthStateHealthy && health.ConsecutiveFailures >= hc.Policy.UnhealthyThreshold {
+		health.State = HealthStateUnhealthy
+		return hc.newChange(target, now, fmt.Sprintf("%d consecutive probes failed: %v", health.ConsecutiveFailures, health.LastError)), true
+	}
+	return HealthChange{}, false
+}
+
+// probe simulates a request to the component's health endpoint. Broken
+// components refuse the connection; loaded ones answer slower, failing once
+// the answer would take longer than the timeout.
+func (hc *HealthChecker) probe(component Component) error {
+	if !component.IsHealthy() {
+		return fmt.Errorf("connection refused")
+	}
+
+	if reporter, ok := component.(loadReporter); ok {
+		load := reporter.GetCurrentLoad()
+		if load >= 1 {
+			return fmt.Errorf("timed out after %v", hc.Policy.Timeout)
+		}
+		if latency := time.Duration(float64(probeBaseLatency) / (1 - load)); latency > hc.Policy.Timeout {
+			return fmt.Errorf("timed out after %v", hc.Policy.Timeout)
+		}
+	}
+
+	return nil
+}
+
+func (hc *HealthChecker) newChange(target *healthTarget, now time.Time, reason string) HealthChange {
+	return HealthChange{
+		Time:      now,
+		CheckerID: hc.ID,
+		Component: target.component,
+		State:     target.health.State,
+		Reason:    reason,
+	}
+}
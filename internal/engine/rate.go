@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"time"
+)
+
+// Rate sums amounts a second at a time, such as requests or fees, so they
+// can be reported or billed as a rate. It is not safe for concurrent use.
+type Rate struct {
+	start time.Time
+	sum   float64
+	last  float64 // sum over the last full second
+}
+
+func (r *Rate) Add(now time.Time, amount float64) {
+	if elapsed := now.Sub(r.start); elapsed >= time.Second {
+		r.last = 0
+		if elapsed < 2*time.Second {
+			r.last = r.sum
+		}
+		r.start = now
+		r.sum = 0
+	}
+	r.sum += amount
+}
+
+// PerSecond is the sum over the last full second, or zero once adds have
+// stopped
+func (r *Rate) PerSecond(now time.Time) float64 {
+	if now.Sub(r.start) >= 2*time.Second {
+		return 0
+	}
+	return r.last
+}
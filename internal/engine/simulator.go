@@ -3,6 +3,7 @@ package engine
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 )
@@ -18,6 +19,7 @@ type Simulator struct {
 	tickRate       time.Duration
 	currentTime    time.Time
 	metrics        *AggregateMetrics
+	controllers    []Controller
 }
 
 type AggregateMetrics struct {
@@ -25,9 +27,34 @@ type AggregateMetrics struct {
 	TotalSuccesses    int64
 	TotalFailures     int64
 	TotalCost         float64
+	AccruedCost       float64 // TotalCost integrated over simulated time
 	TotalLatency      time.Duration
 	RecentLatencies   []time.Duration // Track last 1000 latencies for P99
 	ComponentMetrics  map[string]*Metrics
+
+	// Session-level metrics reported by journey-driven traffic
+	PageLoads         int64
+	AbandonedPages    int64
+	JourneysStarted   int64
+	JourneysCompleted int64
+	JourneysAbandoned int64
+	RecentPageLoads   []time.Duration // Track last 1000 page load times for P95
+
+	ScaleOutEvents    int64
+	ScaleInEvents     int64
+	TotalStaleReads   int64
+	TotalCoalesced    int64
+	TotalLoadSaved    int64
+	TotalShardSplits  int64
+	HotShards         int64
+	TotalConflicts    int64
+	TotalLostUpdates  int64
+	TotalQueueDepth   int64
+	TotalConsumerLag  int64
+	OldestMessageAge  time.Duration
+	PeakQueueDepth    int64
+	IndexingLag       time.Duration
+	TotalBlocked      int64 // requests refused on purpose; not failures
 	mu                sync.RWMutex
 }
 
@@ -45,6 +72,7 @@ func NewSimulator(tickRate time.Duration) *Simulator {
 		metrics: &AggregateMetrics{
 			ComponentMetrics:  make(map[string]*Metrics),
 			RecentLatencies: make([]time.Duration, 0, 1000),
+			RecentPageLoads: make([]time.Duration, 0, 1000),
 		},
 	}
 }
@@ -86,6 +114,14 @@ func (s *Simulator) GetComponent(id string) (Component, error) {
 	return component, nil
 }
 
+// AddController attaches a control loop that runs on every simulator tick
+func (s *Simulator) AddController(controller Controller) {
+	s.componentMutex.Lock()
+	defer s.componentMutex.Unlock()
+
+	s.controllers = append(s.controllers, controller)
+}
+
 func (s *Simulator) SubmitRequest(req *Request) {
 	if s.running {
 		s.eventQueue <- req
@@ -98,11 +134,33 @@ func (s *Simulator) Start() {
 	go s.tick()
 }
 
+func (s *Simulator) IsRunning() bool {
+	return s.running
+}
+
 func (s *Simulator) Stop() {
 	s.running = false
 	s.cancel()
 	close(s.eventQueue)
 	close(s.responseQueue)
+
+	s.componentMutex.RLock()
+	stoppers := make([]Stopper, 0)
+	for _, component := range s.components {
+		if stopper, ok := component.(Stopper); ok {
+			stoppers = append(stoppers, stopper)
+		}
+	}
+	for _, controller := range s.controllers {
+		if stopper, ok := controller.(Stopper); ok {
+			stoppers = append(stoppers, stopper)
+		}
+	}
+	s.componentMutex.RUnlock()
+
+	for _, stopper := range stoppers {
+		stopper.Stop()
+	}
 }
 
 func (s *Simulator) processEvents() {
@@ -111,21 +169,32 @@ func (s *Simulator) processEvents() {
 		case <-s.ctx.Done():
 			return
 		case req := <-s.eventQueue:
-			go s.handleRequest(req)
+			go s.Execute(req)
 		}
 	}
 }
 
-func (s *Simulator) handleRequest(req *Request) {
+// Execute routes a request through the system synchronously and records it in
+// the aggregate metrics. Callers that depend on the response (e.g. a page load
+// waiting on its first request) use this instead of SubmitRequest.
+func (s *Simulator) Execute(req *Request) (*Response, error) {
 	s.componentMutex.RLock()
 	var entryPoint Component
+
+	// Requests generated by a traffic source (e.g. a user pool) enter the
+	// system through that source rather than a guessed entry point
+	if req.Source != "" {
+		entryPoint = s.components[req.Source]
+	}
 	
 	// Strategy: Try to find CDN first, then LB, then API
 	// In a real sim, we'd check Region match too, but keeping it simple for now.
-	for _, comp := range s.components {
-		if comp.GetType() == "cdn" {
-			entryPoint = comp
-			break
+	if entryPoint == nil {
+		for _, comp := range s.components {
+			if comp.GetType() == "cdn" {
+				entryPoint = comp
+				break
+			}
 		}
 	}
 	if entryPoint == nil {
@@ -154,14 +223,17 @@ func (s *Simulator) handleRequest(req *Request) {
 		s.metrics.mu.Lock()
 		s.metrics.TotalFailures++
 		s.metrics.mu.Unlock()
-		return
+		err := fmt.Errorf("no entry point available for request %s", req.ID)
+		return &Response{RequestID: req.ID, Success: false, Error: err}, err
 	}
 
 	// Process request
 	resp, err := entryPoint.Process(req)
 
 	s.metrics.mu.Lock()
-	if err == nil && (resp == nil || resp.Success) {
+	if resp != nil && resp.Blocked {
+		s.metrics.TotalBlocked++
+	} else if err == nil && (resp == nil || resp.Success) {
 		s.metrics.TotalSuccesses++
 	} else {
 		s.metrics.TotalFailures++
@@ -175,6 +247,44 @@ func (s *Simulator) handleRequest(req *Request) {
 		}
 	}
 	s.metrics.mu.Unlock()
+
+	return resp, err
+}
+
+// RecordPageLoad tracks the time a user waited for a full page, including all
+// of its dependent requests
+func (s *Simulator) RecordPageLoad(duration time.Duration, abandoned bool) {
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+
+	s.metrics.PageLoads++
+	if abandoned {
+		s.metrics.AbandonedPages++
+	}
+	s.metrics.RecentPageLoads = append(s.metrics.RecentPageLoads, duration)
+	if len(s.metrics.RecentPageLoads) > 1000 {
+		s.metrics.RecentPageLoads = s.metrics.RecentPageLoads[1:]
+	}
+}
+
+// RecordJourneyStart counts a user session beginning a journey
+func (s *Simulator) RecordJourneyStart() {
+	s.metrics.mu.Lock()
+	s.metrics.JourneysStarted++
+	s.metrics.mu.Unlock()
+}
+
+// RecordJourneyEnd counts a journey that either reached its last step or was
+// abandoned along the way
+func (s *Simulator) RecordJourneyEnd(completed bool) {
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+
+	if completed {
+		s.metrics.JourneysCompleted++
+	} else {
+		s.metrics.JourneysAbandoned++
+	}
 }
 
 func (s *Simulator) tick() {
@@ -187,11 +297,37 @@ func (s *Simulator) tick() {
 			return
 		case <-ticker.C:
 			s.currentTime = s.currentTime.Add(s.tickRate)
+			s.runControllers()
 			s.updateMetrics()
 		}
 	}
 }
 
+func (s *Simulator) recordScalingEvent(event ScalingEvent) {
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+
+	switch event.Action {
+	case ScalingActionScaleOut:
+		s.metrics.ScaleOutEvents++
+	case ScalingActionScaleIn:
+		s.metrics.ScaleInEvents++
+	}
+}
+
+func (s *Simulator) runControllers() {
+	s.componentMutex.RLock()
+	controllers := make([]Controller, len(s.controllers))
+	copy(controllers, s.controllers)
+	s.componentMutex.RUnlock()
+
+	// Controllers may register or unregister components, so they run
+	// without holding the component lock
+	for _, controller := range controllers {
+		controller.Tick(s.currentTime)
+	}
+}
+
 func (s *Simulator) updateMetrics() {
 	s.componentMutex.RLock()
 	defer s.componentMutex.RUnlock()
@@ -200,12 +336,44 @@ func (s *Simulator) updateMetrics() {
 	defer s.metrics.mu.Unlock()
 
 	var totalCost float64
+	var staleReads, coalesced, loadSaved, shardSplits, hotShards, conflicts, lostUpdates, queueDepth, consumerLag int64
+	var oldestMessage, indexingLag time.Duration
 	for id, component := range s.components {
 		metrics := component.GetMetrics()
 		s.metrics.ComponentMetrics[id] = metrics
 		totalCost += component.GetCost()
+		staleReads += metrics.StaleReads
+		coalesced += metrics.CoalescedRequests
+		loadSaved += metrics.BackendLoadSaved
+		shardSplits += metrics.ShardSplits
+		hotShards += metrics.HotShards
+		conflicts += metrics.WriteConflicts
+		lostUpdates += metrics.LostUpdates
+		queueDepth += metrics.QueueDepth
+		consumerLag += metrics.ConsumerLag
+		if metrics.OldestMessageAge > oldestMessage {
+			oldestMessage = metrics.OldestMessageAge
+		}
+		if metrics.IndexingLag > indexingLag {
+			indexingLag = metrics.IndexingLag
+		}
 	}
 	s.metrics.TotalCost = totalCost
+	s.metrics.TotalStaleReads = staleReads
+	s.metrics.TotalCoalesced = coalesced
+	s.metrics.TotalLoadSaved = loadSaved
+	s.metrics.TotalShardSplits = shardSplits
+	s.metrics.HotShards = hotShards
+	s.metrics.TotalConflicts = conflicts
+	s.metrics.TotalLostUpdates = lostUpdates
+	s.metrics.TotalQueueDepth = queueDepth
+	s.metrics.TotalConsumerLag = consumerLag
+	s.metrics.OldestMessageAge = oldestMessage
+	s.metrics.IndexingLag = indexingLag
+	if queueDepth > s.metrics.PeakQueueDepth {
+		s.metrics.PeakQueueDepth = queueDepth
+	}
+	s.metrics.AccruedCost += totalCost * s.tickRate.Hours()
 }
 
 func (s *Simulator) GetMetrics() *AggregateMetrics {
@@ -219,30 +387,32 @@ func (s *Simulator) GetP99Latency() time.Duration {
 	s.metrics.mu.RLock()
 	defer s.metrics.mu.RUnlock()
 
-	if len(s.metrics.RecentLatencies) == 0 {
-		return 0
-	}
+	return percentile(s.metrics.RecentLatencies, 0.99)
+}
 
-	// Sort latencies to find P99
-	latencies := make([]time.Duration, len(s.metrics.RecentLatencies))
-	copy(latencies, s.metrics.RecentLatencies)
+// GetPageLoadP95 calculates the 95th percentile page load time from recent pages
+func (s *Simulator) GetPageLoadP95() time.Duration {
+	s.metrics.mu.RLock()
+	defer s.metrics.mu.RUnlock()
 
-	// Simple bubble sort for small datasets
-	for i := 0; i < len(latencies); i++ {
-		for j := i + 1; j < len(latencies); j++ {
-			if latencies[i] > latencies[j] {
-				latencies[i], latencies[j] = latencies[j], latencies[i]
-			}
-		}
+	return percentile(s.metrics.RecentPageLoads, 0.95)
+}
+
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
 	}
 
-	// Calculate 99th percentile index
-	p99Index := int(float64(len(latencies)) * 0.99)
-	if p99Index >= len(latencies) {
-		p99Index = len(latencies) - 1
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	index := int(float64(len(sorted)) * p)
+	if index >= len(sorted) {
+		index = len(sorted) - 1
 	}
 
-	return latencies[p99Index]
+	return sorted[index]
 }
 
 func (s *Simulator) GetCurrentTime() time.Time {
@@ -20,6 +20,7 @@ type Request struct {
 	Region      string
 	DataSize    int64
 	Path        string
+	Source      string
 	Headers     map[string]string
 	Metadata    map[string]interface{}
 }
@@ -31,6 +32,7 @@ type Response struct {
 	DataSize    int64
 	Error       error
 	CacheHit    bool
+	Blocked     bool // refused on purpose, e.g. by a firewall, rather than failed
 	HopsTrace   []string
 	Metadata    map[string]interface{}
 }
@@ -45,6 +47,18 @@ type Component interface {
 	SetHealthy(bool)
 }
 
+// Controller is a control loop driven by the simulator clock, e.g. an
+// autoscaler or a health checker. Tick is called once per simulator tick.
+type Controller interface {
+	Tick(now time.Time)
+}
+
+// Stopper is a component or controller with background work of its own,
+// which the simulator ends when it stops. Stop may be called more than once.
+type Stopper interface {
+	Stop()
+}
+
 type Metrics struct {
 	RequestCount    int64
 	SuccessCount    int64
@@ -57,6 +71,33 @@ type Metrics struct {
 	ErrorRate       float64
 	CacheHitRate    float64
 	DataTransferred int64
+	StaleReads      int64 // reads answered with data older than the latest write
+
+	// Stampede protection: misses that shared another's backend fetch, and
+	// all requests kept from reaching the backend
+	CoalescedRequests int64
+	BackendLoadSaved  int64
+
+	// Sharding: shards split by the player, and shards running hot now
+	ShardSplits int64
+	HotShards   int64
+
+	// Multi-leader replication: concurrent writes to a key on different
+	// leaders, and writes last-writer-wins threw away
+	WriteConflicts int64
+	LostUpdates    int64
+
+	// Queues: messages the slowest consumer group has yet to finish, the
+	// lag summed over groups, and how long the oldest has been waiting
+	QueueDepth       int64
+	ConsumerLag      int64
+	OldestMessageAge time.Duration
+
+	// Search: how long writes take on average to become searchable
+	IndexingLag time.Duration
+
+	// Firewalls: requests turned away by rules, counted apart from failures
+	BlockedRequests int64
 }
 
 type Region string
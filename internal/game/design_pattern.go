@@ -488,7 +488,8 @@ func ReadReplicasPattern() *DesignPattern {
 
 		Tradeoffs: []string{
 			"Replication lag (replicas slightly behind primary)",
-			"Eventual consistency (not strong consistency)",
+			"Stale reads: a replica may return data older than the latest write",
+			"Stronger consistency modes send more reads back to the primary",
 			"Increased infrastructure costs",
 			"Application must route reads vs writes correctly",
 		},
@@ -636,6 +637,13 @@ func ReadReplicasPattern() *DesignPattern {
 			{
 				Order:       15,
 				Type:        StepMessage,
+				Title:       "Consistency Trade-off",
+				Description: "Consistency is a per-read choice:\n\n- Eventual: any replica, may be stale\n- Read-your-writes: replicas that applied your last write\n- Bounded staleness: replicas within a lag limit\n- Strong: primary only, never stale\n\nWatch the stale read count as you change it.",
+				Duration:    4 * time.Second,
+			},
+			{
+				Order:       16,
+				Type:        StepMessage,
 				Title:       "Benefits Recap",
 				Description: "Read Replicas Pattern:\n\n✓ Nx read capacity (N replicas)\n✓ Geographic distribution\n✓ Improved availability\n✓ Offload analytics to replicas\n\nTrade-off: Eventual consistency\n\nUsed by: Instagram, GitHub, Shopify",
 				Duration:    4 * time.Second,
@@ -667,8 +675,8 @@ func ReadReplicasPattern() *DesignPattern {
 			},
 			{
 				Order:       3,
-				Instruction: "Connect: API → Primary, Primary → Replicas, API → Replicas",
-				Hint:        "Create replication connections from primary to replicas, and read connections from API to all databases",
+				Instruction: "Connect: API → Primary, Primary → Replicas",
+				Hint:        "Connecting the primary to a database makes it a replica; the primary then routes reads to its replicas",
 				Expected: StepValidation{
 					RequiredComponents: map[string]int{
 						"api-server": 1,
@@ -69,9 +69,10 @@ func (g *GameState) EvaluateLevel() *LevelResult {
 		Feedback:        make([]string, 0),
 	}
 
+	// Requests the firewall blocked were meant to be refused
 	uptime := 1.0
-	if metrics.TotalRequests > 0 {
-		uptime = float64(metrics.TotalSuccesses) / float64(metrics.TotalRequests)
+	if served := metrics.TotalRequests - metrics.TotalBlocked; served > 0 {
+		uptime = float64(metrics.TotalSuccesses) / float64(served)
 	}
 	
 	errorRate := 0.0
@@ -97,6 +98,28 @@ func (g *GameState) EvaluateLevel() *LevelResult {
 	result.MetricsAchieved["cache_hit_rate"] = cacheHitRate
 	result.MetricsAchieved["cost"] = result.CostIncurred
 
+	// Session-level metrics from users following journeys
+	completionRate := 0.0
+	if finished := metrics.JourneysCompleted + metrics.JourneysAbandoned; finished > 0 {
+		completionRate = float64(metrics.JourneysCompleted) / float64(finished)
+	}
+	result.MetricsAchieved["page_load_p95_ms"] = float64(g.Simulator.GetPageLoadP95().Milliseconds())
+	result.MetricsAchieved["journeys_started"] = float64(metrics.JourneysStarted)
+	result.MetricsAchieved["journeys_completed"] = float64(metrics.JourneysCompleted)
+	result.MetricsAchieved["journey_completion_rate"] = completionRate
+	result.MetricsAchieved["pages_abandoned"] = float64(metrics.AbandonedPages)
+	result.MetricsAchieved["scale_out_events"] = float64(metrics.ScaleOutEvents)
+	result.MetricsAchieved["scale_in_events"] = float64(metrics.ScaleInEvents)
+	result.MetricsAchieved["accrued_cost"] = metrics.AccruedCost
+	result.MetricsAchieved["stale_reads"] = float64(metrics.TotalStaleReads)
+	result.MetricsAchieved["backend_load_saved"] = float64(metrics.TotalLoadSaved)
+	result.MetricsAchieved["shard_splits"] = float64(metrics.TotalShardSplits)
+	result.MetricsAchieved["write_conflicts"] = float64(metrics.TotalConflicts)
+	result.MetricsAchieved["lost_updates"] = float64(metrics.TotalLostUpdates)
+	result.MetricsAchieved["peak_queue_depth"] = float64(metrics.PeakQueueDepth)
+	result.MetricsAchieved["indexing_lag_ms"] = float64(metrics.IndexingLag.Milliseconds())
+	result.MetricsAchieved["blocked_requests"] = float64(metrics.TotalBlocked)
+
 	req := g.CurrentLevel.Requirements
 	crit := g.CurrentLevel.SuccessCriteria
 	
@@ -178,6 +201,11 @@ func (g *GameState) EvaluateLevel() *LevelResult {
 	result.Passed = passed
 	result.Score = int(math.Max(0, float64(score)))
 
+	if metrics.JourneysAbandoned > 0 && completionRate < 0.9 {
+		result.Feedback = append(result.Feedback,
+			fmt.Sprintf("Only %.0f%% of user journeys completed; slow or failing pages drive users away", completionRate*100))
+	}
+
 	if passed {
 		g.CurrentLevel.Completed = true
 		if result.Score > g.CurrentLevel.BestScore {
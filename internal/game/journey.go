@@ -0,0 +1,390 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/engine"
+)
+
+const (
+	// Users give up on a page that takes longer than this to load
+	defaultAbandonAfter = 3 * time.Second
+	// Pause between pages while the user reads; compressed from real time
+	defaultThinkTime = 500 * time.Millisecond
+	// Number of distinct items referenced by journey paths
+	journeyItemCount = 100
+)
+
+// PageRequest is a single request issued while loading a page. Path may
+// contain a %d verb which is filled with the item the user is looking at.
+type PageRequest struct {
+	Type engine.RequestType
+	Path string
+}
+
+// JourneyStep is one page of a journey. Its requests are dependent: each one
+// is issued only after the previous one returned, so the page load time is
+// the sum of their latencies.
+type JourneyStep struct {
+	Name     string
+	Requests []PageRequest
+}
+
+// Journey is a scripted path a user takes through the application
+type Journey struct {
+	Name   string
+	Weight float64
+	Steps  []JourneyStep
+}
+
+// JourneyResult describes how a single run of a journey went
+type JourneyResult struct {
+	Journey     string
+	Completed   bool
+	AbandonedAt string
+	PageLoads   []time.Duration
+}
+
+func (j *Journey) RequestCount() int {
+	count := 0
+	for _, step := range j.Steps {
+		count += len(step.Requests)
+	}
+	return count
+}
+
+var journeyCatalog = map[ApplicationType][]*Journey{
+	AppTypeBlog: {
+		{
+			Name:   "read-article",
+			Weight: 0.8,
+			Steps: []JourneyStep{
+				{Name: "home", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/"},
+					{Type: engine.RequestTypeAPI, Path: "/static/app.js"},
+					{Type: engine.RequestTypeRead, Path: "/api/posts/recent"},
+				}},
+				{Name: "article", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/posts/%d"},
+					{Type: engine.RequestTypeAPI, Path: "/static/posts/%d/cover.jpg"},
+					{Type: engine.RequestTypeRead, Path: "/api/posts/%d/comments"},
+				}},
+			},
+		},
+		{
+			Name:   "comment",
+			Weight: 0.2,
+			Steps: []JourneyStep{
+				{Name: "article", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/posts/%d"},
+					{Type: engine.RequestTypeRead, Path: "/api/posts/%d/comments"},
+				}},
+				{Name: "post-comment", Requests: []PageRequest{
+					{Type: engine.RequestTypeWrite, Path: "/api/posts/%d/comments"},
+					{Type: engine.RequestTypeRead, Path: "/api/posts/%d/comments"},
+				}},
+			},
+		},
+	},
+	AppTypeSocialMedia: {
+		{
+			Name:   "scroll-feed",
+			Weight: 0.7,
+			Steps: []JourneyStep{
+				{Name: "feed", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/feed"},
+					{Type: engine.RequestTypeAPI, Path: "/static/media/%d.jpg"},
+					{Type: engine.RequestTypeRead, Path: "/api/notifications"},
+				}},
+				{Name: "profile", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/users/%d"},
+					{Type: engine.RequestTypeRead, Path: "/api/users/%d/posts"},
+				}},
+			},
+		},
+		{
+			Name:   "share-post",
+			Weight: 0.3,
+			Steps: []JourneyStep{
+				{Name: "feed", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/feed"},
+				}},
+				{Name: "compose", Requests: []PageRequest{
+					{Type: engine.RequestTypeWrite, Path: "/api/media"},
+					{Type: engine.RequestTypeWrite, Path: "/api/posts"},
+					{Type: engine.RequestTypeRead, Path: "/api/feed"},
+				}},
+			},
+		},
+	},
+	AppTypeEcommerce: {
+		{
+			Name:   "purchase",
+			Weight: 0.3,
+			Steps: []JourneyStep{
+				{Name: "browse", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/"},
+					{Type: engine.RequestTypeAPI, Path: "/static/app.js"},
+					{Type: engine.RequestTypeRead, Path: "/api/categories"},
+				}},
+				{Name: "search", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/search?q=%d"},
+					{Type: engine.RequestTypeAPI, Path: "/static/thumbnails/%d.jpg"},
+				}},
+				{Name: "product", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/products/%d"},
+					{Type: engine.RequestTypeRead, Path: "/api/products/%d/inventory"},
+					{Type: engine.RequestTypeRead, Path: "/api/products/%d/reviews"},
+					{Type: engine.RequestTypeAPI, Path: "/static/products/%d.jpg"},
+				}},
+				{Name: "add-to-cart", Requests: []PageRequest{
+					{Type: engine.RequestTypeWrite, Path: "/api/cart"},
+					{Type: engine.RequestTypeRead, Path: "/api/cart"},
+				}},
+				{Name: "checkout", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/products/%d/inventory"},
+					{Type: engine.RequestTypeWrite, Path: "/api/products/%d/inventory"},
+					{Type: engine.RequestTypeWrite, Path: "/api/orders"},
+					{Type: engine.RequestTypeWrite, Path: "/api/payments"},
+					{Type: engine.RequestTypeRead, Path: "/api/orders/confirmation"},
+				}},
+			},
+		},
+		{
+			Name:   "window-shopping",
+			Weight: 0.7,
+			Steps: []JourneyStep{
+				{Name: "browse", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/"},
+					{Type: engine.RequestTypeAPI, Path: "/static/app.js"},
+					{Type: engine.RequestTypeRead, Path: "/api/categories"},
+				}},
+				{Name: "search", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/search?q=%d"},
+					{Type: engine.RequestTypeAPI, Path: "/static/thumbnails/%d.jpg"},
+				}},
+				{Name: "product", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/products/%d"},
+					{Type: engine.RequestTypeRead, Path: "/api/products/%d/reviews"},
+					{Type: engine.RequestTypeAPI, Path: "/static/products/%d.jpg"},
+				}},
+			},
+		},
+	},
+	AppTypeStreaming: {
+		{
+			Name:   "watch",
+			Weight: 1.0,
+			Steps: []JourneyStep{
+				{Name: "home", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/recommendations"},
+					{Type: engine.RequestTypeAPI, Path: "/static/posters/%d.jpg"},
+				}},
+				{Name: "details", Requests: []PageRequest{
+					{Type: engine.RequestTypeRead, Path: "/api/titles/%d"},
+					{Type: engine.RequestTypeRead, Path: "/api/titles/%d/manifest"},
+				}},
+				{Name: "play", Requests: []PageRequest{
+					{Type: engine.RequestTypeAPI, Path: "/static/video/%d/segment-1.ts"},
+					{Type: engine.RequestTypeAPI, Path: "/static/video/%d/segment-2.ts"},
+					{Type: engine.RequestTypeWrite, Path: "/api/watch-history"},
+				}},
+			},
+		},
+	},
+}
+
+// defaultJourney is used by applications without a scripted catalog
+var defaultJourney = &Journey{
+	Name:   "browse",
+	Weight: 1.0,
+	Steps: []JourneyStep{
+		{Name: "home", Requests: []PageRequest{
+			{Type: engine.RequestTypeRead, Path: "/"},
+			{Type: engine.RequestTypeAPI, Path: "/static/app.js"},
+		}},
+		{Name: "detail", Requests: []PageRequest{
+			{Type: engine.RequestTypeRead, Path: "/api/items/%d"},
+			{Type: engine.RequestTypeWrite, Path: "/api/items/%d/events"},
+		}},
+	},
+}
+
+func GetJourneysForApp(appType ApplicationType) []*Journey {
+	if journeys, exists := journeyCatalog[appType]; exists {
+		return journeys
+	}
+	return []*Journey{defaultJourney}
+}
+
+// GetStaticAssets returns the paths of the static files an application's
+// journeys load, for every item a user can look at
+func GetStaticAssets(appType ApplicationType) []string {
+	seen := make(map[string]bool)
+	assets := make([]string, 0)
+	for _, j := range GetJourneysForApp(appType) {
+		for _, step := range j.Steps {
+			for _, pageReq := range step.Requests {
+				if pageReq.Type != engine.RequestTypeAPI || !strings.HasPrefix(pageReq.Path, "/static/") {
+					continue
+				}
+				paths := []string{pageReq.Path}
+				if strings.Contains(pageReq.Path, "%d") {
+					paths = make([]string, journeyItemCount)
+					for item := range paths {
+						paths[item] = fmt.Sprintf(pageReq.Path, item)
+					}
+				}
+				for _, path := range paths {
+					if !seen[path] {
+						seen[path] = true
+						assets = append(assets, path)
+					}
+				}
+			}
+		}
+	}
+	return assets
+}
+
+func selectJourney(journeys []*Journey) *Journey {
+	total := 0.0
+	for _, j := range journeys {
+		total += j.Weight
+	}
+
+	roll := rand.Float64() * total
+	for _, j := range journeys {
+		roll -= j.Weight
+		if roll < 0 {
+			return j
+		}
+	}
+	return journeys[len(journeys)-1]
+}
+
+// averageJourneyRequests is the expected number of requests a journey picked
+// from journeys will issue
+func averageJourneyRequests(journeys []*Journey) float64 {
+	total, weighted := 0.0, 0.0
+	for _, j := range journeys {
+		total += j.Weight
+		weighted += j.Weight * float64(j.RequestCount())
+	}
+	if total == 0 {
+		return 1
+	}
+	return weighted / total
+}
+
+// GenerateJourneys returns the sessions that start a journey during one
+// interval. Journeys are started at the rate that keeps the pool's request
+// volume at its configured RPS, and each user runs at most one at a time.
+func (pg *PoolTrafficGenerator) GenerateJourneys(currentTime time.Time, interval time.Duration) []*UserSession {
+	if len(pg.Journeys) == 0 {
+		return nil
+	}
+
+	expected := float64(pg.CalculateCurrentRPS(currentTime)) * interval.Seconds() / averageJourneyRequests(pg.Journeys)
+	count := int(expected)
+	if rand.Float64() < expected-float64(count) {
+		count++
+	}
+
+	sessions := make([]*UserSession, 0, count)
+	for i := 0; i < count; i++ {
+		if int(pg.activeJourneys.Load()) >= pg.Pool.UserCount {
+			break
+		}
+		pg.activeJourneys.Add(1)
+
+		session := pg.newSession()
+		session.Journey = selectJourney(pg.Journeys)
+		session.ExpectedPageViews = len(session.Journey.Steps)
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+// RunJourney walks a session through its journey against sim, blocking until
+// the journey completes, is abandoned or the simulation stops. A page that
+// fails or takes longer than AbandonAfter makes the user leave.
+func (pg *PoolTrafficGenerator) RunJourney(session *UserSession, sim *engine.Simulator) *JourneyResult {
+	defer pg.activeJourneys.Add(-1)
+
+	result := &JourneyResult{
+		Journey:   session.Journey.Name,
+		PageLoads: make([]time.Duration, 0, len(session.Journey.Steps)),
+	}
+	item := rand.Intn(journeyItemCount)
+	// In a flash sale a share of the users all go for the featured item
+	if rand.Float64() < pg.Pool.FeaturedItemShare {
+		item = 0
+	}
+
+	sim.RecordJourneyStart()
+	for i, step := range session.Journey.Steps {
+		if !sim.IsRunning() {
+			sim.RecordJourneyEnd(false)
+			return result
+		}
+		if i > 0 && pg.ThinkTime > 0 {
+			time.Sleep(pg.ThinkTime/2 + time.Duration(rand.Int63n(int64(pg.ThinkTime))))
+		}
+
+		pageLoad, ok := pg.loadPage(session, step, item, sim)
+		session.RecordRequest()
+		result.PageLoads = append(result.PageLoads, pageLoad)
+
+		abandoned := !ok || pageLoad > pg.AbandonAfter
+		sim.RecordPageLoad(pageLoad, abandoned)
+		if abandoned {
+			result.AbandonedAt = step.Name
+			sim.RecordJourneyEnd(false)
+			return result
+		}
+	}
+
+	result.Completed = true
+	sim.RecordJourneyEnd(true)
+	return result
+}
+
+// loadPage issues the page's requests one after another and returns the total
+// time the user waited. It stops at the first failed request.
+func (pg *PoolTrafficGenerator) loadPage(session *UserSession, step JourneyStep, item int, sim *engine.Simulator) (time.Duration, bool) {
+	start := time.Now()
+
+	for _, pageReq := range step.Requests {
+		path := pageReq.Path
+		if strings.Contains(path, "%d") {
+			path = fmt.Sprintf(path, item)
+		}
+
+		req := &engine.Request{
+			ID:        fmt.Sprintf("%s-req-j%d", pg.Pool.ID, pg.journeyRequests.Add(1)),
+			Type:      pageReq.Type,
+			Timestamp: time.Now(),
+			UserID:    session.SessionID,
+			Region:    config.GetRegionName(pg.Pool.Region),
+			DataSize:  session.DataPerRequest,
+			Path:      path,
+			Source:    pg.Pool.ID,
+		}
+		req.Headers = session.RequestHeaders()
+
+		resp, err := sim.Execute(req)
+		session.StoreCookies(resp)
+		session.StoreSessionToken(resp)
+		if err != nil || (resp != nil && !resp.Success) {
+			return time.Since(start), false
+		}
+	}
+
+	return time.Since(start), true
+}
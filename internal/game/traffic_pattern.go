@@ -1,8 +1,20 @@
 package game
 
 import (
+	"fmt"
 	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/javanhut/systemdesignsim/internal/components/config"
+	"github.com/javanhut/systemdesignsim/internal/components/database"
+	"github.com/javanhut/systemdesignsim/internal/components/networking"
+	"github.com/javanhut/systemdesignsim/internal/engine"
 )
 
 type TrafficGenerator struct {
@@ -67,11 +79,11 @@ func (tg *TrafficGenerator) GetRequestType() string {
 	readThreshold := tg.Pattern.ReadsPercentage
 	writeThreshold := readThreshold + tg.Pattern.WritesPercentage
 
-	rand := math.Mod(float64(time.Now().UnixNano()), 100.0)
+	roll := rand.Float64()
 
-	if rand < readThreshold {
+	if roll < readThreshold {
 		return "read"
-	} else if rand < writeThreshold {
+	} else if roll < writeThreshold {
 		return "write"
 	}
 	return "static"
@@ -103,6 +115,87 @@ type UserSession struct {
 	ExpectedPageViews int
 	DataPerRequest    int64
 	ActualPageViews   int
+	Journey           *Journey
+
+	// Cookies the browser holds, e.g. load balancer affinity cookies
+	cookies     map[string]string
+	cookieMutex sync.Mutex
+	// Log position of the session's latest write, for read-your-writes
+	sessionToken int64
+}
+
+// RequestHeaders returns the headers the session sends with each request,
+// or nil when it has none yet
+func (us *UserSession) RequestHeaders() map[string]string {
+	headers := make(map[string]string)
+	if cookie := us.CookieHeader(); cookie != "" {
+		headers["Cookie"] = cookie
+	}
+
+	us.cookieMutex.Lock()
+	if us.sessionToken > 0 {
+		headers[database.SessionTokenHeader] = strconv.FormatInt(us.sessionToken, 10)
+	}
+	us.cookieMutex.Unlock()
+
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+// StoreSessionToken keeps the token a database returned for a write
+func (us *UserSession) StoreSessionToken(resp *engine.Response) {
+	if resp == nil || resp.Metadata == nil {
+		return
+	}
+	token, ok := resp.Metadata["session_token"].(int64)
+	if !ok {
+		return
+	}
+
+	us.cookieMutex.Lock()
+	defer us.cookieMutex.Unlock()
+
+	if token > us.sessionToken {
+		us.sessionToken = token
+	}
+}
+
+// CookieHeader renders the session's cookies as a Cookie request header
+func (us *UserSession) CookieHeader() string {
+	us.cookieMutex.Lock()
+	defer us.cookieMutex.Unlock()
+
+	parts := make([]string, 0, len(us.cookies))
+	for name, value := range us.cookies {
+		parts = append(parts, name+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
+
+// StoreCookies keeps any cookie the response set
+func (us *UserSession) StoreCookies(resp *engine.Response) {
+	if resp == nil || resp.Metadata == nil {
+		return
+	}
+	setCookie, ok := resp.Metadata["Set-Cookie"].(string)
+	if !ok {
+		return
+	}
+	name, value, found := strings.Cut(setCookie, "=")
+	if !found {
+		return
+	}
+
+	us.cookieMutex.Lock()
+	defer us.cookieMutex.Unlock()
+
+	if us.cookies == nil {
+		us.cookies = make(map[string]string)
+	}
+	us.cookies[name] = value
 }
 
 func (us *UserSession) IsActive() bool {
@@ -130,11 +223,159 @@ func (us *UserSession) RecordRequest() {
 	us.ActualPageViews++
 }
 
+// UsersInRegion returns the share of totalUsers located in region according
+// to the profile's geographic mix. Without a mix every user is assumed local.
+func (up *UserProfile) UsersInRegion(totalUsers int, region string) int {
+	if len(up.GeographicMix) == 0 {
+		return totalUsers
+	}
+
+	users := int(math.Round(float64(totalUsers) * up.GeographicMix[config.GetRegionName(region)]))
+	if users < 1 {
+		users = 1
+	}
+	return users
+}
+
 func generateSessionID() string {
 	return time.Now().Format("20060102150405") + "-" +
 		string(rune('A'+time.Now().UnixNano()%26))
 }
 
+// maxPoolRPS bounds the request rate a single pool submits so very large
+// audiences stay within what the simulator can process in real time.
+const maxPoolRPS = 500
+
+var defaultSessionProfile = SessionProfile{
+	DurationMinutes: 5,
+	PageViews:       5,
+	DataPerRequest:  1024,
+}
+
+// PoolTrafficGenerator drives the traffic of a single user pool. The pool's
+// users are modeled as sessions that follow the scenario's session profile;
+// a session is replaced once it expires or has made all its page views.
+// When Journeys are set, sessions instead walk through scripted journeys
+// (see GenerateJourneys and RunJourney).
+type PoolTrafficGenerator struct {
+	Pool         *networking.UserPool
+	Generator    *TrafficGenerator
+	Session      SessionProfile
+	Journeys     []*Journey
+	AbandonAfter time.Duration
+	ThinkTime    time.Duration
+	sessions     []*UserSession
+	next         int
+	counter      int
+	created      int
+
+	activeJourneys  atomic.Int64
+	journeyRequests atomic.Int64
+}
+
+func NewPoolTrafficGenerator(pool *networking.UserPool, generator *TrafficGenerator) *PoolTrafficGenerator {
+	session := defaultSessionProfile
+	if generator != nil && generator.UserProfile != nil && generator.UserProfile.AverageSession.PageViews > 0 {
+		session = generator.UserProfile.AverageSession
+	}
+
+	return &PoolTrafficGenerator{
+		Pool:         pool,
+		Generator:    generator,
+		Session:      session,
+		AbandonAfter: defaultAbandonAfter,
+		ThinkTime:    defaultThinkTime,
+		sessions:     make([]*UserSession, 0),
+	}
+}
+
+func (pg *PoolTrafficGenerator) CalculateCurrentRPS(currentTime time.Time) int {
+	rps := float64(pg.Pool.GetTotalRequestRate())
+	if pg.Generator != nil {
+		rps *= pg.Generator.getDailyMultiplier(currentTime.Hour())
+	}
+
+	if rps > maxPoolRPS {
+		rps = maxPoolRPS
+	}
+	return int(rps)
+}
+
+// GenerateRequests returns the requests the pool's users issue during one
+// interval starting at currentTime.
+func (pg *PoolTrafficGenerator) GenerateRequests(currentTime time.Time, interval time.Duration) []*engine.Request {
+	expected := float64(pg.CalculateCurrentRPS(currentTime)) * interval.Seconds()
+	count := int(expected)
+	if rand.Float64() < expected-float64(count) {
+		count++
+	}
+
+	requests := make([]*engine.Request, 0, count)
+	for i := 0; i < count; i++ {
+		session := pg.nextSession()
+		session.RecordRequest()
+		pg.counter++
+
+		reqType := engine.RequestTypeRead
+		if pg.Generator != nil {
+			switch pg.Generator.GetRequestType() {
+			case "write":
+				reqType = engine.RequestTypeWrite
+			case "static":
+				reqType = engine.RequestTypeAPI
+			}
+		}
+
+		requests = append(requests, &engine.Request{
+			ID:        fmt.Sprintf("%s-req-%d", pg.Pool.ID, pg.counter),
+			Type:      reqType,
+			Timestamp: currentTime,
+			UserID:    session.SessionID,
+			Region:    config.GetRegionName(pg.Pool.Region),
+			DataSize:  session.DataPerRequest,
+			Path:      fmt.Sprintf("/data/%d", pg.counter%100),
+			Source:    pg.Pool.ID,
+		})
+	}
+
+	return requests
+}
+
+// nextSession hands out sessions round-robin, keeping at most one session per
+// user in the pool and replacing sessions that are finished.
+func (pg *PoolTrafficGenerator) nextSession() *UserSession {
+	if len(pg.sessions) < pg.Pool.UserCount {
+		session := pg.newSession()
+		pg.sessions = append(pg.sessions, session)
+		return session
+	}
+	if len(pg.sessions) > pg.Pool.UserCount && pg.Pool.UserCount > 0 {
+		pg.sessions = pg.sessions[:pg.Pool.UserCount]
+	}
+	if len(pg.sessions) == 0 {
+		return pg.newSession()
+	}
+
+	pg.next = (pg.next + 1) % len(pg.sessions)
+	session := pg.sessions[pg.next]
+	if !session.IsActive() || session.ActualPageViews >= session.ExpectedPageViews {
+		session = pg.newSession()
+		pg.sessions[pg.next] = session
+	}
+	return session
+}
+
+func (pg *PoolTrafficGenerator) newSession() *UserSession {
+	pg.created++
+	return &UserSession{
+		SessionID:         fmt.Sprintf("%s-session-%d", pg.Pool.ID, pg.created),
+		StartTime:         time.Now(),
+		DurationMinutes:   pg.Session.DurationMinutes,
+		ExpectedPageViews: pg.Session.PageViews,
+		DataPerRequest:    pg.Session.DataPerRequest,
+	}
+}
+
 type LoadProjector struct {
 	GrowthProjection *GrowthProjection
 	InitialLoad      int
@@ -185,12 +426,12 @@ func NewGeographicDistributor(dist GeographicDistribution) *GeographicDistributo
 }
 
 func (gd *GeographicDistributor) SelectRegion() string {
-	rand := math.Mod(float64(time.Now().UnixNano()), 1.0)
+	roll := rand.Float64()
 
 	cumulative := 0.0
 	for region, percentage := range gd.Distribution {
 		cumulative += percentage
-		if rand < cumulative {
+		if roll < cumulative {
 			return region
 		}
 	}
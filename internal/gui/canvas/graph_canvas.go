@@ -274,11 +274,32 @@ func (r *graphCanvasRenderer) Refresh() {
 	canvas.Refresh(r.canvas)
 }
 
+// nodeReporter is implemented by clustered components made of nodes
+type nodeReporter interface {
+	GetNodeCounts() (int, int)
+}
+
+// outlierReporter is implemented by load balancers doing outlier detection
+type outlierReporter interface {
+	IsOutlier(backendID string) (bool, bool)
+	GetEjectedCount() int
+}
+
 func (r *graphCanvasRenderer) renderConnection(conn *gui.Connection) {
 	fromCenter := conn.From.GetCenter()
 	toCenter := conn.To.GetCenter()
 
-	line := canvas.NewLine(conn.Color)
+	lineColor := conn.Color
+	if reporter, ok := conn.From.Component.(outlierReporter); ok && conn.To.Component != nil {
+		ejected, warming := reporter.IsOutlier(conn.To.Component.GetID())
+		if ejected {
+			lineColor = color.RGBA{R: 231, G: 76, B: 60, A: 200}
+		} else if warming {
+			lineColor = color.RGBA{R: 243, G: 156, B: 18, A: 200}
+		}
+	}
+
+	line := canvas.NewLine(lineColor)
 	line.Position1 = fromCenter
 	line.Position2 = toCenter
 	line.StrokeWidth = conn.Thickness + 1
@@ -341,6 +362,19 @@ func (r *graphCanvasRenderer) renderComponent(comp *gui.VisualComponent) {
 	if comp.Component != nil {
 		metrics := comp.Component.GetMetrics()
 		statusText := fmt.Sprintf("thr: %.0f rps", metrics.Throughput)
+		if comp.HealthStatus == gui.HealthStatusOutOfService {
+			statusText = "out of service"
+		}
+		if reporter, ok := comp.Component.(outlierReporter); ok {
+			if ejected := reporter.GetEjectedCount(); ejected > 0 {
+				statusText += fmt.Sprintf(" | %d ejected", ejected)
+			}
+		}
+		if reporter, ok := comp.Component.(nodeReporter); ok {
+			if up, total := reporter.GetNodeCounts(); up < total {
+				statusText += fmt.Sprintf(" | %d/%d nodes", up, total)
+			}
+		}
 		statusLabel := canvas.NewText(statusText, color.White)
 		statusLabel.TextSize = 9
 		statusLabelPos := fyne.NewPos(
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image/color"
 	"strconv"
+	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -13,9 +14,16 @@ import (
 	"github.com/javanhut/systemdesignsim/internal/components/api"
 	"github.com/javanhut/systemdesignsim/internal/components/cache"
 	"github.com/javanhut/systemdesignsim/internal/components/cdn"
+	"github.com/javanhut/systemdesignsim/internal/components/config"
 	"github.com/javanhut/systemdesignsim/internal/components/database"
 	"github.com/javanhut/systemdesignsim/internal/components/loadbalancer"
 	"github.com/javanhut/systemdesignsim/internal/components/networking"
+	"github.com/javanhut/systemdesignsim/internal/components/pubsub"
+	"github.com/javanhut/systemdesignsim/internal/components/queue"
+	"github.com/javanhut/systemdesignsim/internal/components/search"
+	"github.com/javanhut/systemdesignsim/internal/components/storage"
+	"github.com/javanhut/systemdesignsim/internal/components/worker"
+	"github.com/javanhut/systemdesignsim/internal/deployment"
 	"github.com/javanhut/systemdesignsim/internal/engine"
 	"github.com/javanhut/systemdesignsim/internal/game"
 	"github.com/javanhut/systemdesignsim/internal/gui"
@@ -47,6 +55,9 @@ type GameScreen struct {
 	running          bool
 	stopChan         chan bool
 	trafficGenerator *game.TrafficGenerator
+	poolTraffic      []*game.PoolTrafficGenerator
+	scalingGroups    []*engine.AutoScalingGroup
+	healthChecker    *engine.HealthChecker
 
 	networkSettings    networkConfig
 	securitySettings   securityConfig
@@ -79,9 +90,13 @@ type deploymentConfig struct {
 	strategy        string
 	batchSize       int
 	healthGraceSecs int
+	healthInterval  int
 	autoScaling     bool
 	minInstances    int
 	maxInstances    int
+	scalingMetric   string
+	cooldownSecs    int
+	startupSecs     int
 }
 
 type monitoringConfig struct {
@@ -118,9 +133,13 @@ func NewGameScreen(window fyne.Window, level *game.Level) *GameScreen {
 			strategy:        "Rolling",
 			batchSize:       2,
 			healthGraceSecs: 30,
+			healthInterval:  2,
 			autoScaling:     true,
 			minInstances:    2,
 			maxInstances:    6,
+			scalingMetric:   "CPU",
+			cooldownSecs:    10,
+			startupSecs:     3,
 		},
 		monitoringSettings: monitoringConfig{
 			metrics: true, alerts: true, synthetic: true, backups: true, drRegion: "us-west-1",
@@ -172,17 +191,86 @@ func (gs *GameScreen) linkComponents(from, to *gui.VisualComponent) {
 		if c, ok := fromComp.(*cache.Cache); ok {
 			c.SetBackend(toComp)
 		}
+	case "cache-cluster":
+		if c, ok := fromComp.(*cache.Cluster); ok {
+			c.SetBackend(toComp)
+		}
 	case "cdn":
 		if c, ok := fromComp.(*cdn.CDN); ok {
 			c.SetOrigin(toComp)
 		}
+	case "queue":
+		// Connecting a queue to a component makes it a consumer group
+		// delivering there. Workers pull from their group instead.
+		if q, ok := fromComp.(*queue.Queue); ok {
+			if w, isWorker := toComp.(*worker.Worker); isWorker {
+				w.SetSource(q)
+			} else {
+				q.AddConsumerGroup(toComp.GetID(), q.DefaultTopic, toComp)
+			}
+		}
+	case "pubsub":
+		// Connecting pub/sub to a component subscribes it to the default
+		// topic, pushing every message there
+		if ps, ok := fromComp.(*pubsub.PubSub); ok {
+			ps.AddSubscription(toComp.GetID(), ps.DefaultTopic, toComp)
+		}
+	case "worker":
+		if w, ok := fromComp.(*worker.Worker); ok {
+			switch toComp.GetType() {
+			case "database-sql", "database-nosql", "database-key-value", "database-document":
+				w.SetDatabase(toComp)
+			case "cache-redis", "cache-memcached", "cache-cluster":
+				w.SetCache(toComp)
+			default:
+				w.AddService(toComp)
+			}
+		}
+	case "gateway":
+		if g, ok := fromComp.(*networking.Gateway); ok {
+			g.AddBackend(toComp)
+		}
+	case "firewall":
+		if f, ok := fromComp.(*networking.Firewall); ok {
+			f.SetBackend(toComp)
+		}
+	case "user-pool":
+		if pool, ok := fromComp.(*networking.UserPool); ok {
+			pool.AddTarget(toComp)
+		}
+	case "database-sql", "database-nosql", "database-key-value", "database-document":
+		// Connecting a database to another makes the target a read replica,
+		// or in multi-leader mode another leader
+		primary, ok := fromComp.(*database.Database)
+		if index, isSearch := toComp.(*search.SearchIndex); ok && isSearch {
+			// The index follows the database's writes through change data capture
+			primary.AddChangeFeed(index)
+			return
+		}
+		replica, isDB := toComp.(*database.Database)
+		if ok && isDB {
+			if primary.MultiLeader {
+				primary.AddLeader(replica)
+			} else {
+				primary.AddReplica(replica)
+			}
+		}
 	case "api-server":
 		if apiServer, ok := fromComp.(*api.APIServer); ok {
 			switch toComp.GetType() {
 			case "database-sql", "database-nosql", "database-key-value", "database-document":
+				// The primary routes reads to its replicas, so a replica
+				// does not replace the server's primary
+				if db, ok := toComp.(*database.Database); ok && !db.IsPrimary && apiServer.Database != nil {
+					return
+				}
 				apiServer.SetDatabase(toComp)
-			case "cache-redis", "cache-memcached":
+			case "cache-redis", "cache-memcached", "cache-cluster":
 				apiServer.SetCache(toComp)
+			case "queue", "pubsub":
+				apiServer.SetQueue(toComp)
+			case "search":
+				apiServer.SetSearch(toComp)
 			}
 		}
 	}
@@ -239,12 +327,42 @@ func (gs *GameScreen) createToolbox() *widget.Card {
 	dbDesc := widget.NewLabel("Persistent storage. SQL/NoSQL. ~10ms reads")
 	dbDesc.Wrapping = fyne.TextWrapWord
 
+	quorumBtn := widget.NewButton("Quorum KV Store", func() {
+		gs.addComponent(gui.ComponentTypeQuorumStore)
+	})
+	quorumDesc := widget.NewLabel("Leaderless replicas across zones. Tunable N/R/W")
+	quorumDesc.Wrapping = fyne.TextWrapWord
+
 	cacheBtn := widget.NewButton("Cache", func() {
 		gs.addComponent(gui.ComponentTypeCache)
 	})
 	cacheDesc := widget.NewLabel("In-memory fast reads. Redis/Memcached. ~1-2ms")
 	cacheDesc.Wrapping = fyne.TextWrapWord
 
+	clusterBtn := widget.NewButton("Cache Cluster", func() {
+		gs.addComponent(gui.ComponentTypeCacheCluster)
+	})
+	clusterDesc := widget.NewLabel("Sharded cache nodes on a hash ring. Replicas")
+	clusterDesc.Wrapping = fyne.TextWrapWord
+
+	queueBtn := widget.NewButton("Queue", func() {
+		gs.addComponent(gui.ComponentTypeQueue)
+	})
+	queueDesc := widget.NewLabel("Async messages in ordered partitions. Levels load")
+	queueDesc.Wrapping = fyne.TextWrapWord
+
+	workerBtn := widget.NewButton("Worker", func() {
+		gs.addComponent(gui.ComponentTypeWorker)
+	})
+	workerDesc := widget.NewLabel("Background jobs pulled from a queue. Off the request path")
+	workerDesc.Wrapping = fyne.TextWrapWord
+
+	pubsubBtn := widget.NewButton("Pub/Sub", func() {
+		gs.addComponent(gui.ComponentTypePubSub)
+	})
+	pubsubDesc := widget.NewLabel("Fans each publish out to many subscribers. Retries")
+	pubsubDesc.Wrapping = fyne.TextWrapWord
+
 	lbBtn := widget.NewButton("Load Balancer", func() {
 		gs.addComponent(gui.ComponentTypeLoadBalancer)
 	})
@@ -257,16 +375,28 @@ func (gs *GameScreen) createToolbox() *widget.Card {
 	cdnDesc := widget.NewLabel("Edge caching, global distribution. Static content")
 	cdnDesc.Wrapping = fyne.TextWrapWord
 
+	storageBtn := widget.NewButton("Object Storage", func() {
+		gs.addComponent(gui.ComponentTypeStorage)
+	})
+	storageDesc := widget.NewLabel("Blobs in buckets. Storage classes, lifecycle. CDN origin")
+	storageDesc.Wrapping = fyne.TextWrapWord
+
+	searchBtn := widget.NewButton("Search Index", func() {
+		gs.addComponent(gui.ComponentTypeSearch)
+	})
+	searchDesc := widget.NewLabel("Full-text search. Shards, replicas. Writes searchable after refresh")
+	searchDesc.Wrapping = fyne.TextWrapWord
+
 	gatewayBtn := widget.NewButton("Gateway", func() {
 		gs.addComponent(gui.ComponentTypeGateway)
 	})
-	gatewayDesc := widget.NewLabel("Internet/API gateway. Entry point. ~1ms")
+	gatewayDesc := widget.NewLabel("API gateway. Auth, quotas, path routing. Priced per request")
 	gatewayDesc.Wrapping = fyne.TextWrapWord
 
 	firewallBtn := widget.NewButton("Firewall", func() {
 		gs.addComponent(gui.ComponentTypeFirewall)
 	})
-	firewallDesc := widget.NewLabel("Security filtering layer. WAF rules. ~2ms")
+	firewallDesc := widget.NewLabel("Allow/deny rules on source, port, region. WAF mode. ~2ms")
 	firewallDesc.Wrapping = fyne.TextWrapWord
 
 	natBtn := widget.NewButton("NAT", func() {
@@ -284,7 +414,7 @@ func (gs *GameScreen) createToolbox() *widget.Card {
 	userPoolBtn := widget.NewButton("User Pool", func() {
 		gs.addComponent(gui.ComponentTypeUserPool)
 	})
-	userPoolDesc := widget.NewLabel("Simulated users. Traffic source. Configurable")
+	userPoolDesc := widget.NewLabel("Regional users. Connect to your entry point")
 	userPoolDesc.Wrapping = fyne.TextWrapWord
 
 	helpBtn := widget.NewButton("? Help", func() {
@@ -300,15 +430,36 @@ func (gs *GameScreen) createToolbox() *widget.Card {
 		dbBtn,
 		dbDesc,
 		widget.NewSeparator(),
+		quorumBtn,
+		quorumDesc,
+		widget.NewSeparator(),
 		cacheBtn,
 		cacheDesc,
 		widget.NewSeparator(),
+		clusterBtn,
+		clusterDesc,
+		widget.NewSeparator(),
+		queueBtn,
+		queueDesc,
+		widget.NewSeparator(),
+		workerBtn,
+		workerDesc,
+		widget.NewSeparator(),
+		pubsubBtn,
+		pubsubDesc,
+		widget.NewSeparator(),
 		lbBtn,
 		lbDesc,
 		widget.NewSeparator(),
 		cdnBtn,
 		cdnDesc,
 		widget.NewSeparator(),
+		storageBtn,
+		storageDesc,
+		widget.NewSeparator(),
+		searchBtn,
+		searchDesc,
+		widget.NewSeparator(),
 		widget.NewLabel("Network & Users"),
 		widget.NewSeparator(),
 		gatewayBtn,
@@ -425,6 +576,7 @@ func (gs *GameScreen) showScenarioHelp() {
 			"Health Colors:\n" +
 			"Green = Healthy | Yellow = Busy | Orange = Critical | Red = Failing\n\n" +
 			"Valid Connections:\n" +
+			"User Pool → Gateway/CDN/Load Balancer/API Server\n" +
 			"Load Balancer → API Server\n" +
 			"API Server → Database/Cache\n" +
 			"Cache → Database\n" +
@@ -803,6 +955,14 @@ func (gs *GameScreen) deploymentTab() fyne.CanvasObject {
 		}
 	}
 
+	intervalEntry := widget.NewEntry()
+	intervalEntry.SetText(fmt.Sprintf("%d", gs.deploymentSettings.healthInterval))
+	intervalEntry.OnChanged = func(val string) {
+		if v, err := strconv.Atoi(val); err == nil && v > 0 {
+			gs.deploymentSettings.healthInterval = v
+		}
+	}
+
 	autoScale := widget.NewCheck("Enable Auto-scaling", func(c bool) { gs.deploymentSettings.autoScaling = c })
 	autoScale.SetChecked(gs.deploymentSettings.autoScaling)
 
@@ -821,7 +981,25 @@ func (gs *GameScreen) deploymentTab() fyne.CanvasObject {
 		}
 	}
 
-	info := widget.NewLabel("Choose rollout style and health grace. Auto-scaling bounds control elasticity. Canary/Blue-Green reduce blast radius.")
+	metricSelect := widget.NewSelect([]string{"CPU", "Request Rate", "Queue Depth"}, func(s string) { gs.deploymentSettings.scalingMetric = s })
+	metricSelect.SetSelected(gs.deploymentSettings.scalingMetric)
+
+	cooldownEntry := widget.NewEntry()
+	cooldownEntry.SetText(fmt.Sprintf("%d", gs.deploymentSettings.cooldownSecs))
+	cooldownEntry.OnChanged = func(val string) {
+		if v, err := strconv.Atoi(val); err == nil {
+			gs.deploymentSettings.cooldownSecs = v
+		}
+	}
+	startupEntry := widget.NewEntry()
+	startupEntry.SetText(fmt.Sprintf("%d", gs.deploymentSettings.startupSecs))
+	startupEntry.OnChanged = func(val string) {
+		if v, err := strconv.Atoi(val); err == nil {
+			gs.deploymentSettings.startupSecs = v
+		}
+	}
+
+	info := widget.NewLabel("Choose rollout style and health grace. Auto-scaling bounds control elasticity: API servers behind each load balancer scale on the chosen metric. Canary/Blue-Green reduce blast radius.")
 	info.Wrapping = fyne.TextWrapWord
 
 	return container.NewVBox(
@@ -831,11 +1009,19 @@ func (gs *GameScreen) deploymentTab() fyne.CanvasObject {
 		batchEntry,
 		widget.NewLabel("Health Grace (sec)"),
 		healthEntry,
+		widget.NewLabel("Health Check Interval (sec)"),
+		intervalEntry,
 		autoScale,
 		widget.NewLabel("Min Instances"),
 		minEntry,
 		widget.NewLabel("Max Instances"),
 		maxEntry,
+		widget.NewLabel("Scaling Metric"),
+		metricSelect,
+		widget.NewLabel("Cooldown (sec)"),
+		cooldownEntry,
+		widget.NewLabel("Instance Startup (sec)"),
+		startupEntry,
 		widget.NewSeparator(),
 		info,
 	)
@@ -933,13 +1119,27 @@ func (gs *GameScreen) addComponent(compType gui.ComponentType) {
 	case gui.ComponentTypeAPIServer:
 		comp = api.NewAPIServer(id, "us-east", api.SizeMedium)
 	case gui.ComponentTypeDatabase:
-		comp = database.NewDatabase(id, database.DatabaseTypeSQL, "us-east", 10*1024*1024*1024)
+		comp = database.NewDatabase(id, database.DatabaseTypeSQL, "us-east", config.GetDatabaseInstanceType("db.t3.medium"))
+	case gui.ComponentTypeQuorumStore:
+		comp = database.NewQuorumStore(id, database.DatabaseTypeKeyValue, "us-east", 6)
 	case gui.ComponentTypeCache:
 		comp = cache.NewCache(id, "redis", "us-east", 1024*1024*1024, cache.EvictionLRU, time.Hour)
+	case gui.ComponentTypeCacheCluster:
+		comp = cache.NewCluster(id, "redis", "us-east", 3, 512*1024*1024, cache.EvictionLRU, time.Hour)
+	case gui.ComponentTypeQueue:
+		comp = queue.NewQueue(id, "us-east")
+	case gui.ComponentTypeWorker:
+		comp = worker.NewWorker(id, "us-east", 2)
+	case gui.ComponentTypePubSub:
+		comp = pubsub.NewPubSub(id, "us-east")
 	case gui.ComponentTypeLoadBalancer:
 		comp = loadbalancer.NewLoadBalancer(id, "us-east", loadbalancer.StrategyRoundRobin)
 	case gui.ComponentTypeCDN:
 		comp = cdn.NewCDN(id, []string{"us-east", "us-west", "europe"})
+	case gui.ComponentTypeStorage:
+		comp = storage.NewObjectStorage(id, "us-east")
+	case gui.ComponentTypeSearch:
+		comp = search.NewSearchIndex(id, "us-east", 3)
 	case gui.ComponentTypeGateway:
 		comp = networking.NewGateway(id, "us-east")
 	case gui.ComponentTypeFirewall:
@@ -949,7 +1149,16 @@ func (gs *GameScreen) addComponent(compType gui.ComponentType) {
 	case gui.ComponentTypeRouter:
 		comp = networking.NewRouter(id, "us-east")
 	case gui.ComponentTypeUserPool:
-		comp = networking.NewUserPool(id, "us-east", gs.level.PeakUsers)
+		users := gs.level.PeakUsers
+		pool := networking.NewUserPool(id, "us-east", users)
+		if gs.level.Scenario != nil {
+			profile := gs.level.Scenario.UserProfile
+			pool.UsersForRegion = func(region string) int {
+				return profile.UsersInRegion(users, region)
+			}
+			pool.UserCount = pool.UsersForRegion(pool.Region)
+		}
+		comp = pool
 	}
 
 	visualComp.SetComponent(comp)
@@ -982,6 +1191,24 @@ func (gs *GameScreen) startSimulation() {
 		)
 	}
 
+	// Every user pool on the canvas drives its own traffic from its region
+	gs.poolTraffic = nil
+	for _, vc := range gs.canvas.GetComponents() {
+		if pool, ok := vc.GetComponent().(*networking.UserPool); ok {
+			pg := game.NewPoolTrafficGenerator(pool, gs.trafficGenerator)
+			pg.Journeys = game.GetJourneysForApp(gs.level.AppType)
+			gs.poolTraffic = append(gs.poolTraffic, pg)
+		}
+	}
+
+	gs.setupHealthChecks()
+	gs.setupAutoScaling()
+	gs.setupCaches()
+	gs.setupDatabases()
+	gs.setupQueues()
+	gs.setupStorage()
+	gs.setupSearch()
+
 	gs.running = true
 	gs.playButton.Disable()
 	gs.stopButton.Enable()
@@ -989,10 +1216,266 @@ func (gs *GameScreen) startSimulation() {
 	gs.statusLabel.SetText("Status: Running")
 
 	go gs.updateMetrics()
-	go gs.simulateTraffic()
+	if len(gs.poolTraffic) > 0 {
+		for _, pg := range gs.poolTraffic {
+			go gs.simulatePoolTraffic(pg)
+		}
+	} else {
+		go gs.simulateTraffic()
+	}
 	go gs.animateParticles()
 }
 
+// setupHealthChecks probes everything behind load balancers and user pools,
+// so routing reacts to failures after a few failed probes rather than
+// instantly
+func (gs *GameScreen) setupHealthChecks() {
+	cfg := deployment.NewDefaultDeploymentConfig().HealthCheck
+	gs.healthChecker = engine.NewHealthChecker("health-checks", engine.HealthCheckPolicy{
+		Interval:           time.Duration(gs.deploymentSettings.healthInterval) * time.Second,
+		Timeout:            time.Duration(cfg.TimeoutSeconds) * time.Second,
+		HealthyThreshold:   cfg.HealthyThreshold,
+		UnhealthyThreshold: cfg.UnhealthyThreshold,
+	})
+	gs.healthChecker.OnChange = func(change engine.HealthChange) {
+		fyne.Do(func() {
+			gs.statusLabel.SetText(fmt.Sprintf("Health check: %s marked %s (%s)", change.Component.GetID(), change.State, change.Reason))
+		})
+	}
+
+	for _, vc := range gs.canvas.GetComponents() {
+		switch comp := vc.GetComponent().(type) {
+		case *loadbalancer.LoadBalancer:
+			comp.SetHealthChecker(gs.healthChecker)
+		case *networking.UserPool:
+			comp.SetHealthChecker(gs.healthChecker)
+		}
+		vc.HealthChecker = gs.healthChecker
+	}
+
+	gs.gameState.Simulator.AddController(gs.healthChecker)
+}
+
+// setupCaches lets caches flush write-back data on the simulator's clock
+func (gs *GameScreen) setupCaches() {
+	for _, vc := range gs.canvas.GetComponents() {
+		switch c := vc.GetComponent().(type) {
+		case *cache.Cache:
+			gs.gameState.Simulator.AddController(c)
+		case *cache.Cluster:
+			gs.gameState.Simulator.AddController(c)
+		}
+	}
+}
+
+// setupQueues applies retention and runs consumer groups, workers and
+// pub/sub deliveries on the simulator's clock
+func (gs *GameScreen) setupQueues() {
+	for _, vc := range gs.canvas.GetComponents() {
+		switch c := vc.GetComponent().(type) {
+		case *queue.Queue:
+			gs.gameState.Simulator.AddController(c)
+		case *worker.Worker:
+			gs.gameState.Simulator.AddController(c)
+		case *pubsub.PubSub:
+			gs.gameState.Simulator.AddController(c)
+		}
+	}
+}
+
+// setupStorage fills object stores with the static files journeys load and
+// applies their lifecycle rules on the simulator's clock
+func (gs *GameScreen) setupStorage() {
+	for _, vc := range gs.canvas.GetComponents() {
+		store, ok := vc.GetComponent().(*storage.ObjectStorage)
+		if !ok {
+			continue
+		}
+		if gs.level.Scenario != nil {
+			// Static files are the scenario's blobs, the largest items it has
+			size := int64(0)
+			for _, data := range gs.level.Scenario.DataRequirements.Types {
+				if data.SizePerItem > size {
+					size = data.SizePerItem
+				}
+			}
+			store.Seed(game.GetStaticAssets(gs.level.AppType), size)
+		}
+		gs.gameState.Simulator.AddController(store)
+	}
+}
+
+// setupSearch indexes the scenario's data and refreshes search indexes on
+// the simulator's clock
+func (gs *GameScreen) setupSearch() {
+	for _, vc := range gs.canvas.GetComponents() {
+		index, ok := vc.GetComponent().(*search.SearchIndex)
+		if !ok {
+			continue
+		}
+		if gs.level.Scenario != nil {
+			for _, data := range gs.level.Scenario.DataRequirements.Types {
+				index.Seed(strings.ToLower(strings.ReplaceAll(data.Name, " ", "-")), data.Count, data.SizePerItem)
+			}
+		}
+		gs.gameState.Simulator.AddController(index)
+	}
+}
+
+// setupDatabases drives database failover, resharding and hinted handoff on
+// the simulator's clock
+func (gs *GameScreen) setupDatabases() {
+	for _, vc := range gs.canvas.GetComponents() {
+		if store, ok := vc.GetComponent().(*database.QuorumStore); ok {
+			gs.gameState.Simulator.AddController(store)
+		}
+		if db, ok := vc.GetComponent().(*database.Database); ok {
+			db.OnFailover = func(event database.FailoverEvent) {
+				fyne.Do(func() {
+					gs.statusLabel.SetText(fmt.Sprintf("Failover: %s promoted in place of %s after %.1fs, %d writes lost",
+						event.NewPrimary, event.OldPrimary, event.Duration.Seconds(), event.LostWrites))
+				})
+			}
+			gs.gameState.Simulator.AddController(db)
+		}
+	}
+}
+
+// setupAutoScaling puts the API servers behind each load balancer into an
+// autoscaling group that follows the deployment settings
+func (gs *GameScreen) setupAutoScaling() {
+	gs.scalingGroups = nil
+	if !gs.deploymentSettings.autoScaling {
+		return
+	}
+
+	cfg := deployment.NewDefaultDeploymentConfig().AutoScaling
+	cfg.Enabled = true
+	cfg.MinInstances = gs.deploymentSettings.minInstances
+	cfg.MaxInstances = gs.deploymentSettings.maxInstances
+	cfg.CooldownPeriod = time.Duration(gs.deploymentSettings.cooldownSecs) * time.Second
+
+	metric := engine.ScalingMetricCPU
+	switch gs.deploymentSettings.scalingMetric {
+	case "Request Rate":
+		metric = engine.ScalingMetricRequestRate
+	case "Queue Depth":
+		metric = engine.ScalingMetricQueueDepth
+	}
+
+	for _, lbVC := range gs.canvas.GetComponents() {
+		lb, ok := lbVC.GetComponent().(*loadbalancer.LoadBalancer)
+		if !ok {
+			continue
+		}
+
+		servers := make([]*api.APIServer, 0)
+		for _, backend := range lb.GetBackends() {
+			if server, ok := backend.(*api.APIServer); ok {
+				servers = append(servers, server)
+			}
+		}
+		if len(servers) == 0 {
+			continue
+		}
+		template := servers[0]
+
+		policy := engine.ScalingPolicy{
+			Metric:             metric,
+			MinInstances:       cfg.MinInstances,
+			MaxInstances:       cfg.MaxInstances,
+			ScaleUpThreshold:   cfg.ScaleUpThreshold,
+			ScaleDownThreshold: cfg.ScaleDownThreshold,
+			// Assume ~100ms per request, so a server sustains 10 requests/sec
+			// for each concurrent slot
+			TargetRequestRate: float64(template.MaxConcurrent) * 10,
+			TargetQueueDepth:  template.MaxConcurrent,
+			Cooldown:          cfg.CooldownPeriod,
+			StartupDelay:      time.Duration(gs.deploymentSettings.startupSecs) * time.Second,
+			HealthCheckGrace:  time.Duration(gs.deploymentSettings.healthGraceSecs) * time.Second,
+		}
+
+		asg := engine.NewAutoScalingGroup(lb.ID+"-asg", gs.gameState.Simulator, lb, policy, func(id string) engine.Component {
+			server := api.NewAPIServer(id, template.Region, template.Size)
+			server.SetDatabase(template.Database)
+			server.SetCache(template.Cache)
+			server.SetQueue(template.Queue)
+			server.SetSearch(template.Search)
+			return server
+		})
+		asg.HealthChecker = gs.healthChecker
+		// Scaling on queue depth follows the queue whose consumers are
+		// behind this load balancer
+		for _, vc := range gs.canvas.GetComponents() {
+			if q, ok := vc.GetComponent().(*queue.Queue); ok && q.HasConsumer(lb) {
+				asg.QueueSource = q
+			}
+		}
+		for _, server := range servers {
+			asg.AddInstance(server)
+		}
+
+		asg.OnScale = func(event engine.ScalingEvent) {
+			fyne.Do(func() {
+				gs.handleScalingEvent(lbVC, template.ID, event)
+			})
+		}
+
+		gs.gameState.Simulator.AddController(asg)
+		gs.scalingGroups = append(gs.scalingGroups, asg)
+	}
+}
+
+// handleScalingEvent mirrors an autoscaling group's fleet changes on the
+// canvas. Booting instances appear unconnected and join the load balancer
+// once they are ready.
+func (gs *GameScreen) handleScalingEvent(lbVC *gui.VisualComponent, templateID string, event engine.ScalingEvent) {
+	id := event.Instance.GetID()
+
+	switch event.Action {
+	case engine.ScalingActionScaleOut:
+		var template *gui.VisualComponent
+		for _, vc := range gs.canvas.GetComponents() {
+			if vc.ID == templateID {
+				template = vc
+				break
+			}
+		}
+
+		pos := fyne.NewPos(lbVC.Position.X+float32(event.Capacity*30), lbVC.Position.Y+120)
+		if template != nil {
+			pos = fyne.NewPos(template.Position.X+float32(event.Capacity*30), template.Position.Y+float32(event.Capacity*20))
+		}
+
+		vc := gui.NewVisualComponent(id, gui.ComponentTypeAPIServer, pos)
+		vc.SetComponent(event.Instance)
+		vc.HealthChecker = gs.healthChecker
+		gs.canvas.AddComponent(vc)
+
+		// Copy the template's links to its database and cache
+		if template != nil {
+			for _, conn := range template.Connections {
+				if conn.From.ID == template.ID {
+					gs.canvas.AddConnection(vc, conn.To)
+				}
+			}
+		}
+
+	case engine.ScalingActionReady:
+		for _, vc := range gs.canvas.GetComponents() {
+			if vc.ID == id {
+				gs.canvas.AddConnection(lbVC, vc)
+				break
+			}
+		}
+
+	case engine.ScalingActionScaleIn:
+		gs.canvas.RemoveComponent(id)
+	}
+
+	gs.statusLabel.SetText(fmt.Sprintf("Auto-scaling: %s %s (%s)", event.Action, id, event.Reason))
+}
+
 func (gs *GameScreen) stopSimulation() {
 	gs.running = false
 	gs.stopChan <- true
@@ -1012,7 +1495,7 @@ func (gs *GameScreen) submitSolution() {
 	gs.running = false
 
 	resultText := fmt.Sprintf(
-		"Level %s\n\n%s\n\nScore: %d\n\nMetrics:\n- Uptime: %.2f%%\n- Avg Latency: %.0fms\n- Error Rate: %.2f%%\n- Cost: $%.2f\n\nFeedback:\n",
+		"Level %s\n\n%s\n\nScore: %d\n\nMetrics:\n- Uptime: %.2f%%\n- Avg Latency: %.0fms\n- Error Rate: %.2f%%\n- Cost: $%.2f\n- Accrued Cost: $%.4f\n- Scale Out/In: %.0f / %.0f\n- Stale Cache Reads: %.0f\n- Backend Load Saved: %.0f\n- Shard Splits: %.0f\n- Write Conflicts: %.0f (%.0f updates lost)\n- Peak Queue Depth: %.0f\n\nSession Metrics:\n- Page Load P95: %.0fms\n- Journeys Completed: %.0f (%.1f%%)\n- Pages Abandoned: %.0f\n\nFeedback:\n",
 		result.Level.Name,
 		map[bool]string{true: "PASSED", false: "FAILED"}[result.Passed],
 		result.Score,
@@ -1020,6 +1503,19 @@ func (gs *GameScreen) submitSolution() {
 		result.MetricsAchieved["avg_latency_ms"],
 		result.MetricsAchieved["error_rate"]*100,
 		result.CostIncurred,
+		result.MetricsAchieved["accrued_cost"],
+		result.MetricsAchieved["scale_out_events"],
+		result.MetricsAchieved["scale_in_events"],
+		result.MetricsAchieved["stale_reads"],
+		result.MetricsAchieved["backend_load_saved"],
+		result.MetricsAchieved["shard_splits"],
+		result.MetricsAchieved["write_conflicts"],
+		result.MetricsAchieved["lost_updates"],
+		result.MetricsAchieved["peak_queue_depth"],
+		result.MetricsAchieved["page_load_p95_ms"],
+		result.MetricsAchieved["journeys_completed"],
+		result.MetricsAchieved["journey_completion_rate"]*100,
+		result.MetricsAchieved["pages_abandoned"],
 	)
 
 	for _, feedback := range result.Feedback {
@@ -1057,6 +1553,28 @@ func (gs *GameScreen) updateMetrics() {
 
 			metrics := gs.gameState.Simulator.GetMetrics()
 			p99Latency := gs.gameState.Simulator.GetP99Latency()
+			pageLoadP95 := gs.gameState.Simulator.GetPageLoadP95()
+
+			inService, outOfService := 0, 0
+			if gs.healthChecker != nil {
+				inService, outOfService = gs.healthChecker.GetCounts()
+			}
+
+			instances, booting := 0, 0
+			for _, asg := range gs.scalingGroups {
+				ready, pending := asg.GetCapacity()
+				instances += ready
+				booting += pending
+			}
+
+			ejections, ejected := 0, 0
+			for _, vc := range gs.canvas.GetComponents() {
+				if lb, ok := vc.GetComponent().(*loadbalancer.LoadBalancer); ok {
+					stats := lb.GetOutlierStats()
+					ejections += stats.TotalEjections
+					ejected += stats.Ejected
+				}
+			}
 
 			// Calculate traffic metrics
 			successRate := 0.0
@@ -1066,6 +1584,9 @@ func (gs *GameScreen) updateMetrics() {
 				successRate = (float64(metrics.TotalSuccesses) / float64(metrics.TotalRequests)) * 100
 				errorRate = (float64(metrics.TotalFailures) / float64(metrics.TotalRequests)) * 100
 				uptime = successRate
+				if served := metrics.TotalRequests - metrics.TotalBlocked; served > 0 {
+					uptime = (float64(metrics.TotalSuccesses) / float64(served)) * 100
+				}
 			}
 
 			avgLatency := int64(0)
@@ -1075,7 +1596,13 @@ func (gs *GameScreen) updateMetrics() {
 
 			// Estimate current RPS
 			currentRPS := "0"
-			if gs.trafficGenerator != nil {
+			if len(gs.poolTraffic) > 0 {
+				rps := 0
+				for _, pg := range gs.poolTraffic {
+					rps += pg.CalculateCurrentRPS(time.Now())
+				}
+				currentRPS = fmt.Sprintf("%d", rps)
+			} else if gs.trafficGenerator != nil {
 				rps := gs.trafficGenerator.CalculateCurrentRPS(time.Now())
 				currentRPS = fmt.Sprintf("%d", rps)
 			}
@@ -1106,7 +1633,22 @@ func (gs *GameScreen) updateMetrics() {
 					"Error Rate: %.1f%%\n"+
 					"Avg Latency: %dms\n"+
 					"P99 Latency: %dms %s\n"+
-					"Uptime: %.1f%% %s",
+					"Uptime: %.1f%% %s\n\n"+
+					"Session Metrics:\n"+
+					"Page Load P95: %dms\n"+
+					"Journeys: %d completed / %d abandoned\n\n"+
+					"Health Checks: %d in service / %d out\n"+
+					"Outlier Ejections: %d (%d ejected now)\n"+
+					"Stale Cache Reads: %d\n"+
+					"Coalesced Misses: %d (backend load saved %d)\n"+
+					"Shards: %d hot, %d split\n"+
+					"Write Conflicts: %d (%d updates lost)\n"+
+					"Queues: %d deep, lag %d, oldest %dms\n"+
+					"Search: indexing lag %dms\n"+
+					"Firewall: %d blocked\n"+
+					"Auto-scaling:\n"+
+					"Instances: %d (+%d booting)\n"+
+					"Scale Out/In: %d / %d",
 				statusIcon,
 				statusText,
 				metrics.TotalRequests,
@@ -1119,8 +1661,31 @@ func (gs *GameScreen) updateMetrics() {
 				gs.getCheckmark(passedLatency),
 				uptime,
 				gs.getCheckmark(passedUptime),
+				pageLoadP95.Milliseconds(),
+				metrics.JourneysCompleted,
+				metrics.JourneysAbandoned,
+				inService,
+				outOfService,
+				ejections,
+				ejected,
+				metrics.TotalStaleReads,
+				metrics.TotalCoalesced,
+				metrics.TotalLoadSaved,
+				metrics.HotShards,
+				metrics.TotalShardSplits,
+				metrics.TotalConflicts,
+				metrics.TotalLostUpdates,
+				metrics.TotalQueueDepth,
+				metrics.TotalConsumerLag,
+				metrics.OldestMessageAge.Milliseconds(),
+				metrics.IndexingLag.Milliseconds(),
+				metrics.TotalBlocked,
+				instances,
+				booting,
+				metrics.ScaleOutEvents,
+				metrics.ScaleInEvents,
 			)
-			costText := fmt.Sprintf("Cost: $%.2f/hr %s", metrics.TotalCost, gs.getCheckmark(passedBudget))
+			costText := fmt.Sprintf("Cost: $%.2f/hr %s (accrued $%.4f)", metrics.TotalCost, gs.getCheckmark(passedBudget), metrics.AccruedCost)
 
 			// Calculate simulated user count based on request volume
 			// Assume ~50 requests per user session, so users ≈ total requests / 50
@@ -1151,6 +1716,13 @@ func (gs *GameScreen) simulateTraffic() {
 
 	requestCounter := 0
 
+	var regions *game.GeographicDistributor
+	if gs.level.Scenario != nil && len(gs.level.Scenario.UserProfile.GeographicMix) > 0 {
+		regions = game.NewGeographicDistributor(game.GeographicDistribution{
+			Distribution: gs.level.Scenario.UserProfile.GeographicMix,
+		})
+	}
+
 	for {
 		select {
 		case <-gs.stopChan:
@@ -1188,12 +1760,17 @@ func (gs *GameScreen) simulateTraffic() {
 					}
 				}
 
+				region := "us-east"
+				if regions != nil {
+					region = regions.SelectRegion()
+				}
+
 				req := &engine.Request{
 					ID:        fmt.Sprintf("req-%d", requestCounter),
 					Type:      reqType,
 					Timestamp: time.Now(),
 					UserID:    fmt.Sprintf("user-%d", requestCounter%1000),
-					Region:    "us-east",
+					Region:    region,
 					DataSize:  1024,
 					Path:      fmt.Sprintf("/data/%d", requestCounter%100),
 				}
@@ -1215,6 +1792,60 @@ func (gs *GameScreen) simulateTraffic() {
 	}
 }
 
+// simulatePoolTraffic submits the traffic of a single user pool. Pools run
+// concurrently, each entering the system through its own connections.
+func (gs *GameScreen) simulatePoolTraffic(pg *game.PoolTrafficGenerator) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	requestCounter := 0
+
+	for {
+		select {
+		case <-gs.stopChan:
+			return
+		case <-ticker.C:
+			if !gs.running {
+				return
+			}
+
+			// Users following journeys wait on each page before moving on,
+			// so every journey runs in its own goroutine
+			if len(pg.Journeys) > 0 {
+				for _, session := range pg.GenerateJourneys(time.Now(), 100*time.Millisecond) {
+					go pg.RunJourney(session, gs.gameState.Simulator)
+					gs.spawnPoolParticles(pg)
+				}
+				continue
+			}
+
+			for _, req := range pg.GenerateRequests(time.Now(), 100*time.Millisecond) {
+				requestCounter++
+				gs.gameState.Simulator.SubmitRequest(req)
+
+				if requestCounter%3 == 0 {
+					gs.spawnPoolParticles(pg)
+				}
+			}
+		}
+	}
+}
+
+// spawnPoolParticles sends particles out of the pool and along the rest of the
+// graph, but not along the links of other pools
+func (gs *GameScreen) spawnPoolParticles(pg *game.PoolTrafficGenerator) {
+	for _, comp := range gs.canvas.GetComponents() {
+		if comp.Type == gui.ComponentTypeUserPool && comp.ID != pg.Pool.ID {
+			continue
+		}
+		for _, conn := range comp.Connections {
+			if conn.From.ID == comp.ID {
+				gs.canvas.SpawnParticle(conn.From.ID, conn.To.ID)
+			}
+		}
+	}
+}
+
 func (gs *GameScreen) animateParticles() {
 	ticker := time.NewTicker(50 * time.Millisecond)
 	defer ticker.Stop()
@@ -1256,7 +1887,7 @@ func (gs *GameScreen) getArchitecturalHints() string {
 	for _, comp := range gs.canvas.GetComponents() {
 		totalComponents++
 		switch comp.Type {
-		case gui.ComponentTypeCache:
+		case gui.ComponentTypeCache, gui.ComponentTypeCacheCluster:
 			hasCache = true
 		case gui.ComponentTypeLoadBalancer:
 			hasLoadBalancer = true
@@ -1266,7 +1897,7 @@ func (gs *GameScreen) getArchitecturalHints() string {
 			hasGateway = true
 		case gui.ComponentTypeFirewall:
 			hasFirewall = true
-		case gui.ComponentTypeDatabase:
+		case gui.ComponentTypeDatabase, gui.ComponentTypeQuorumStore:
 			hasDatabase = true
 		case gui.ComponentTypeAPIServer:
 			apiServerCount++
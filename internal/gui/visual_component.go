@@ -13,8 +13,15 @@ type ComponentType string
 const (
 	ComponentTypeAPIServer    ComponentType = "api-server"
 	ComponentTypeDatabase     ComponentType = "database"
+	ComponentTypeQuorumStore  ComponentType = "quorum-store"
 	ComponentTypeCache        ComponentType = "cache"
+	ComponentTypeCacheCluster ComponentType = "cache-cluster"
 	ComponentTypeCDN          ComponentType = "cdn"
+	ComponentTypeQueue        ComponentType = "queue"
+	ComponentTypeWorker       ComponentType = "worker"
+	ComponentTypePubSub       ComponentType = "pubsub"
+	ComponentTypeStorage      ComponentType = "object-storage"
+	ComponentTypeSearch       ComponentType = "search"
 	ComponentTypeLoadBalancer ComponentType = "load-balancer"
 	ComponentTypeDNS          ComponentType = "dns"
 	ComponentTypeGateway      ComponentType = "gateway"
@@ -36,6 +43,7 @@ type VisualComponent struct {
 	DragOffset    fyne.Position
 	HealthStatus  HealthStatus
 	Properties    map[string]interface{}
+	HealthChecker *engine.HealthChecker
 	mu            sync.RWMutex
 }
 
@@ -63,6 +71,7 @@ const (
 	HealthStatusWarning
 	HealthStatusCritical
 	HealthStatusDown
+	HealthStatusOutOfService // working, but failing its health checks
 )
 
 func NewVisualComponent(id string, compType ComponentType, pos fyne.Position) *VisualComponent {
@@ -131,6 +140,11 @@ func (vc *VisualComponent) UpdateHealthStatus() {
 		return
 	}
 
+	if vc.HealthChecker != nil && !vc.HealthChecker.IsInService(vc.Component) {
+		vc.HealthStatus = HealthStatusOutOfService
+		return
+	}
+
 	metrics := vc.Component.GetMetrics()
 	if metrics.ErrorRate > 0.1 {
 		vc.HealthStatus = HealthStatusCritical
@@ -151,6 +165,8 @@ func (vc *VisualComponent) GetColor() color.Color {
 		return color.RGBA{R: 230, G: 126, B: 34, A: 255}
 	case HealthStatusDown:
 		return color.RGBA{R: 231, G: 76, B: 60, A: 255}
+	case HealthStatusOutOfService:
+		return color.RGBA{R: 155, G: 89, B: 182, A: 255}
 	default:
 		return color.RGBA{R: 149, G: 165, B: 166, A: 255}
 	}
@@ -162,10 +178,24 @@ func (vc *VisualComponent) GetTypeColor() color.Color {
 		return color.RGBA{R: 52, G: 152, B: 219, A: 255} // Blue
 	case ComponentTypeDatabase:
 		return color.RGBA{R: 155, G: 89, B: 182, A: 255} // Purple
+	case ComponentTypeQuorumStore:
+		return color.RGBA{R: 108, G: 52, B: 131, A: 255} // Dark purple
 	case ComponentTypeCache:
 		return color.RGBA{R: 26, G: 188, B: 156, A: 255} // Teal
+	case ComponentTypeCacheCluster:
+		return color.RGBA{R: 17, G: 122, B: 101, A: 255} // Dark teal
 	case ComponentTypeCDN:
 		return color.RGBA{R: 52, G: 73, B: 94, A: 255} // Dark blue-gray
+	case ComponentTypeQueue:
+		return color.RGBA{R: 230, G: 126, B: 34, A: 255} // Orange
+	case ComponentTypeWorker:
+		return color.RGBA{R: 211, G: 84, B: 0, A: 255} // Dark orange
+	case ComponentTypePubSub:
+		return color.RGBA{R: 243, G: 156, B: 18, A: 255} // Amber
+	case ComponentTypeStorage:
+		return color.RGBA{R: 127, G: 96, B: 62, A: 255} // Brown
+	case ComponentTypeSearch:
+		return color.RGBA{R: 41, G: 128, B: 185, A: 255} // Steel blue
 	case ComponentTypeLoadBalancer:
 		return color.RGBA{R: 241, G: 196, B: 15, A: 255} // Yellow
 	case ComponentTypeDNS:
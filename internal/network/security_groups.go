@@ -2,6 +2,7 @@ package network
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 )
@@ -154,7 +155,7 @@ func (sg *SecurityGroup) IsTrafficAllowed(protocol Protocol, port int, sourceIP
 	for _, rule := range sg.IngressRules {
 		if rule.Protocol == ProtocolAll || rule.Protocol == protocol {
 			if port >= rule.PortRange.From && port <= rule.PortRange.To {
-				if matchesSource(sourceIP, rule.Source) {
+				if MatchesSource(sourceIP, rule.Source) {
 					return true
 				}
 			}
@@ -163,7 +164,9 @@ func (sg *SecurityGroup) IsTrafficAllowed(protocol Protocol, port int, sourceIP
 	return false
 }
 
-func matchesSource(ip, source string) bool {
+// MatchesSource reports whether an IP is the source address or falls in
+// the source CIDR block
+func MatchesSource(ip, source string) bool {
 	if source == "0.0.0.0/0" || source == "::/0" {
 		return true
 	}
@@ -173,7 +176,9 @@ func matchesSource(ip, source string) bool {
 	}
 
 	if strings.Contains(source, "/") {
-		return true
+		_, block, err := net.ParseCIDR(source)
+		addr := net.ParseIP(ip)
+		return err == nil && addr != nil && block.Contains(addr)
 	}
 
 	return ip == source